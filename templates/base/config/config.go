@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultEnvPrefix is the default prefix of the environment variables.
+const defaultEnvPrefix = "APP"
+
+// Configuration contains the configuration for the application.
+// Add fields with the struct tags config, default, usage and required
+// to make them configurable with flags, environment variables and
+// a configuration file.
+type Configuration struct{}
+
+// New returns a new Configuration loaded from defaults, an optional
+// configuration file, environment variables and the command-line
+// arguments args, in that order of precedence.
+func New(args []string, options ...Option) (Configuration, error) {
+	cfg := Configuration{}
+	l := newLoader(filepath.Base(os.Args[0]), defaultEnvPrefix, options...)
+	if err := l.load(&cfg, args); err != nil {
+		return Configuration{}, err
+	}
+	return cfg, nil
+}
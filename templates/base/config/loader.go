@@ -0,0 +1,560 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the flag and environment variable (without prefix) that
+// holds the path to the configuration file.
+const (
+	fileFlag = "config"
+	fileEnv  = "CONFIG_FILE"
+)
+
+// versionFlag is the name of the flag that requests the version.
+const versionFlag = "version"
+
+var (
+	// ErrHelp is returned when the help flag (-h or --help) is provided.
+	ErrHelp = flag.ErrHelp
+	// ErrVersion is returned when the version flag (--version) is provided.
+	ErrVersion = errors.New("version requested")
+)
+
+// loader loads configuration into a struct from defaults, a configuration
+// file, environment variables and flags. Sources are applied in that
+// order, so flags have the highest precedence.
+//
+// Fields are configured with struct tags:
+//   - config: the name of the field in the configuration file. Flags and
+//     environment variables are derived from it, the name readTimeout in
+//     the struct tls gives the flag --tls-read-timeout and the environment
+//     variable <PREFIX>_TLS_READ_TIMEOUT.
+//   - default: the default value of the field.
+//   - usage: the description of the field shown in the help output.
+//   - required: if "true" the field must have a non-zero value.
+//   - restart: if "true" a change of the field requires a restart, and
+//     is reported as such when the configuration is reloaded.
+//
+// Fields of type Secret can also be read from files, see SecretProvider.
+// A secret from a file takes precedence over the configuration file, but
+// not over the environment variable itself or flags.
+type loader struct {
+	name      string
+	envPrefix string
+	file      string
+	output    io.Writer
+	lookupEnv func(string) (string, bool)
+	secrets   *SecretProvider
+	path      string
+}
+
+// Option is a function that configures the loader.
+type Option func(*loader)
+
+// newLoader returns a new loader.
+func newLoader(name, envPrefix string, options ...Option) *loader {
+	l := &loader{
+		name:      name,
+		envPrefix: envPrefix,
+		output:    os.Stderr,
+		lookupEnv: os.LookupEnv,
+	}
+	for _, option := range options {
+		option(l)
+	}
+	if l.secrets == nil {
+		l.secrets = NewSecretProvider()
+	}
+	return l
+}
+
+// field is a configurable field in a struct.
+type field struct {
+	path     []string
+	value    reflect.Value
+	def      string
+	usage    string
+	required bool
+	restart  bool
+}
+
+// key returns the name of the field in the configuration file.
+func (f field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+// flag returns the flag name of the field.
+func (f field) flag() string {
+	parts := make([]string, len(f.path))
+	for i, p := range f.path {
+		parts[i] = strings.ToLower(strings.Join(splitWords(p), "-"))
+	}
+	return strings.Join(parts, "-")
+}
+
+// env returns the environment variable name of the field.
+func (f field) env(prefix string) string {
+	parts := make([]string, len(f.path))
+	for i, p := range f.path {
+		parts[i] = strings.ToUpper(strings.Join(splitWords(p), "_"))
+	}
+	return envName(prefix, strings.Join(parts, "_"))
+}
+
+// load loads configuration into v, that must be a pointer to a struct,
+// with the given command-line arguments. All errors are collected and
+// returned together.
+func (l *loader) load(v any, args []string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("configuration must be a pointer to a struct")
+	}
+	fields := collectFields(rv.Elem(), nil)
+
+	fs, flags := l.flagSet(fields)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	if setFlags[versionFlag] {
+		return ErrVersion
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if len(f.def) == 0 {
+			continue
+		}
+		if err := setValue(f.value, f.def); err != nil {
+			errs = append(errs, fmt.Errorf("default %s: %w", f.key(), err))
+		}
+	}
+
+	file := l.resolveFile(flags[fileFlag], setFlags[fileFlag])
+	if len(file) > 0 {
+		errs = append(errs, loadFile(file, fields)...)
+	}
+	l.path = file
+
+	for _, f := range fields {
+		name := f.env(l.envPrefix)
+		val, ok := l.lookupEnv(name)
+		if isSecret(f.value) {
+			if _, hasFile := l.lookupEnv(name + secretFileSuffix); ok && hasFile {
+				errs = append(errs, fmt.Errorf("environment variables %s and %s%s must not both be set", name, name, secretFileSuffix))
+				continue
+			}
+			if !ok {
+				secret, found, err := l.secrets.lookup(f.key(), name)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				val, ok = secret.Value(), found
+			}
+		}
+		if ok {
+			if err := setValue(f.value, val); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: %w", name, err))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if !setFlags[f.flag()] {
+			continue
+		}
+		if err := setValue(f.value, flags[f.flag()].value); err != nil {
+			errs = append(errs, fmt.Errorf("flag --%s: %w", f.flag(), err))
+		}
+	}
+
+	for _, f := range fields {
+		if f.required && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required (flag --%s or environment variable %s)", f.key(), f.flag(), f.env(l.envPrefix)))
+		}
+	}
+	if v, ok := v.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// filePath returns the path of the configuration file for v, that must be
+// a pointer to a struct, with the given command-line arguments.
+func (l *loader) filePath(v any, args []string) string {
+	fs, flags := l.flagSet(collectFields(reflect.ValueOf(v).Elem(), nil))
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	if err := fs.Parse(args); err != nil {
+		return ""
+	}
+	var set bool
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == fileFlag
+	})
+	return l.resolveFile(flags[fileFlag], set)
+}
+
+// resolveFile returns the path of the configuration file from the flag
+// if it is set, otherwise from the environment variable or the option.
+func (l *loader) resolveFile(flag *flagValue, set bool) string {
+	if set {
+		return flag.value
+	}
+	if path, ok := l.lookupEnv(envName(l.envPrefix, fileEnv)); ok && len(path) > 0 {
+		return path
+	}
+	return l.file
+}
+
+// flagSet returns a flag.FlagSet with a flag for every field. The values of
+// the flags are kept as strings so they can be applied after the other sources.
+func (l *loader) flagSet(fields []field) (*flag.FlagSet, map[string]*flagValue) {
+	fs := flag.NewFlagSet(l.name, flag.ContinueOnError)
+	fs.SetOutput(l.output)
+
+	flags := make(map[string]*flagValue, len(fields)+2)
+	flags[fileFlag] = &flagValue{value: l.file, typ: "string", def: l.file}
+	fs.Var(flags[fileFlag], fileFlag, "Path to configuration file (YAML or JSON).")
+	flags[versionFlag] = &flagValue{typ: "bool"}
+	fs.Var(flags[versionFlag], versionFlag, "Print version information and exit.")
+	for _, f := range fields {
+		fv := &flagValue{typ: typeName(f.value), def: f.def}
+		flags[f.flag()] = fv
+		fs.Var(fv, f.flag(), f.usage)
+	}
+
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage of %s:\n", l.name)
+		fs.VisitAll(func(f *flag.Flag) {
+			fv := flags[f.Name]
+			fmt.Fprintf(w, "  --%s", f.Name)
+			if fv.typ != "bool" {
+				fmt.Fprintf(w, " %s", fv.typ)
+			}
+			fmt.Fprintf(w, "\n    \t%s", f.Usage)
+			if len(fv.def) > 0 {
+				fmt.Fprintf(w, " (default %q)", fv.def)
+			}
+			fmt.Fprintln(w)
+		})
+		fmt.Fprintf(w, "\nEnvironment variables:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "  %s\t%s\n", envName(l.envPrefix, fileEnv), "Path to configuration file (YAML or JSON).")
+		for _, f := range fields {
+			fmt.Fprintf(tw, "  %s\t%s\n", f.env(l.envPrefix), f.usage)
+			if isSecret(f.value) {
+				fmt.Fprintf(tw, "  %s%s\t%s\n", f.env(l.envPrefix), secretFileSuffix, "Path to file containing the value of "+f.env(l.envPrefix)+".")
+			}
+		}
+		tw.Flush()
+	}
+	return fs, flags
+}
+
+// flagValue is a flag.Value that keeps the value as a string.
+type flagValue struct {
+	value string
+	typ   string
+	def   string
+}
+
+// String returns the value of the flag.
+func (v *flagValue) String() string {
+	return v.value
+}
+
+// Set sets the value of the flag.
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+// IsBoolFlag reports whether the flag can be used without a value.
+func (v *flagValue) IsBoolFlag() bool {
+	return v.typ == "bool"
+}
+
+// typeName returns the name of the type of v shown in the help output.
+func typeName(v reflect.Value) string {
+	if isTextUnmarshaler(v) {
+		return "string"
+	}
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice:
+		return "list"
+	}
+	return "string"
+}
+
+// loadFile loads the configuration file at path into the fields.
+// The format is determined by the file extension.
+func loadFile(path string, fields []field) []error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("configuration file: %w", err)}
+	}
+
+	var values map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	default:
+		return []error{fmt.Errorf("configuration file: unsupported format %q, must be YAML or JSON", ext)}
+	}
+	if err != nil {
+		return []error{fmt.Errorf("configuration file: %w", err)}
+	}
+
+	known := make(map[string]field, len(fields))
+	for _, f := range fields {
+		known[f.key()] = f
+	}
+
+	flat := flattenValues(values, "")
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		val := flat[key]
+		f, ok := known[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("configuration file: unknown key %s", key))
+			continue
+		}
+		if err := setValue(f.value, val); err != nil {
+			errs = append(errs, fmt.Errorf("configuration file: %s: %w", key, err))
+		}
+	}
+	return errs
+}
+
+// flattenValues flattens nested maps into a map with keys separated
+// by dots. Lists are joined with commas.
+func flattenValues(values map[string]any, prefix string) map[string]string {
+	flat := map[string]string{}
+	for k, v := range values {
+		key := k
+		if len(prefix) > 0 {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			for k, v := range flattenValues(v, key) {
+				flat[k] = v
+			}
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			flat[key] = strings.Join(items, ",")
+		case nil:
+			flat[key] = ""
+		default:
+			flat[key] = fmt.Sprint(v)
+		}
+	}
+	return flat
+}
+
+// collectFields returns the configurable fields of the struct v.
+func collectFields(v reflect.Value, path []string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := sf.Tag.Lookup("config")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		p := append(append([]string{}, path...), name)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct && !isTextUnmarshaler(fv) {
+			fields = append(fields, collectFields(fv, p)...)
+			continue
+		}
+		fields = append(fields, field{
+			path:     p,
+			value:    fv,
+			def:      sf.Tag.Get("default"),
+			usage:    sf.Tag.Get("usage"),
+			required: sf.Tag.Get("required") == "true",
+			restart:  sf.Tag.Get("restart") == "true",
+		})
+	}
+	return fields
+}
+
+// isTextUnmarshaler returns true if a pointer to v implements
+// encoding.TextUnmarshaler.
+func isTextUnmarshaler(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// isSecret returns true if v is a Secret.
+func isSecret(v reflect.Value) bool {
+	return v.Type() == reflect.TypeOf(Secret(""))
+}
+
+// setValue parses s and sets it to v.
+func setValue(v reflect.Value, s string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", s)
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// envName returns the name of the environment variable with the prefix.
+func envName(prefix, name string) string {
+	if len(prefix) == 0 {
+		return name
+	}
+	return prefix + "_" + name
+}
+
+// splitWords splits a camel case name into words.
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			words = append(words, string(word))
+			word = nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// WithEnvPrefix sets the prefix of the environment variables.
+func WithEnvPrefix(prefix string) Option {
+	return func(l *loader) {
+		l.envPrefix = prefix
+	}
+}
+
+// WithFile sets the path to the configuration file used when it is
+// not provided with a flag or environment variable.
+func WithFile(path string) Option {
+	return func(l *loader) {
+		l.file = path
+	}
+}
+
+// WithOutput sets the output of the help and flag errors.
+func WithOutput(w io.Writer) Option {
+	return func(l *loader) {
+		l.output = w
+	}
+}
+
+// WithSecretProvider sets the SecretProvider used to resolve fields of
+// type Secret from files. Defaults to a SecretProvider for /run/secrets.
+func WithSecretProvider(p *SecretProvider) Option {
+	return func(l *loader) {
+		l.secrets = p
+	}
+}
@@ -1,5 +1,24 @@
 package main
 
-func main() {
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/RedeployAB/go-template/templates/base/config"
+	"github.com/RedeployAB/go-template/templates/base/version"
+)
 
+func main() {
+	if _, err := config.New(os.Args[1:]); err != nil {
+		if errors.Is(err, config.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, config.ErrVersion) {
+			fmt.Println(version.Get())
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err)
+		os.Exit(1)
+	}
 }
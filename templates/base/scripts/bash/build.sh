@@ -46,10 +46,13 @@ if [ $? -ne 0 ]; then
   exit 1
 fi
 
+module=$(go list -m)
+build_time=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+
 CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build \
   -o $bin_path \
-  -ldflags="-s -w" \
-  -trimpath main.go
+  -ldflags="-s -w -X $module/version.version=$version -X $module/version.buildTime=$build_time" \
+  -trimpath .
 
 if [ $container -eq 1 ] && [ "$os" == "linux" ]; then
   docker build -t $bin:$version --platform $os/$arch .
@@ -0,0 +1,131 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewInfo(t *testing.T) {
+	buildInfo := &debug.BuildInfo{
+		GoVersion: "go1.22.2",
+		Main:      debug.Module{Version: "v1.1.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "abc123"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	var tests = []struct {
+		name  string
+		input struct {
+			version   string
+			revision  string
+			buildTime string
+			buildInfo *debug.BuildInfo
+		}
+		want Info
+	}{
+		{
+			name: "without build information",
+			want: Info{
+				Version:   defaultVersion,
+				GoVersion: runtime.Version(),
+			},
+		},
+		{
+			name: "from build information",
+			input: struct {
+				version   string
+				revision  string
+				buildTime string
+				buildInfo *debug.BuildInfo
+			}{
+				buildInfo: buildInfo,
+			},
+			want: Info{
+				Version:   "v1.1.0",
+				Revision:  "abc123",
+				Modified:  true,
+				GoVersion: "go1.22.2",
+			},
+		},
+		{
+			name: "from ldflags",
+			input: struct {
+				version   string
+				revision  string
+				buildTime string
+				buildInfo *debug.BuildInfo
+			}{
+				version:   "1.0.0",
+				revision:  "def456",
+				buildTime: "2024-01-01T00:00:00Z",
+				buildInfo: buildInfo,
+			},
+			want: Info{
+				Version:   "1.0.0",
+				Revision:  "def456",
+				Modified:  true,
+				BuildTime: "2024-01-01T00:00:00Z",
+				GoVersion: "go1.22.2",
+			},
+		},
+		{
+			name: "development build",
+			input: struct {
+				version   string
+				revision  string
+				buildTime string
+				buildInfo *debug.BuildInfo
+			}{
+				buildInfo: &debug.BuildInfo{GoVersion: "go1.22.2", Main: debug.Module{Version: "(devel)"}},
+			},
+			want: Info{
+				Version:   defaultVersion,
+				GoVersion: "go1.22.2",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newInfo(test.input.version, test.input.revision, test.input.buildTime, func() (*debug.BuildInfo, bool) {
+				return test.input.buildInfo, test.input.buildInfo != nil
+			})
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("newInfo() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestInfo_String(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input Info
+		want  string
+	}{
+		{
+			name:  "version only",
+			input: Info{Version: "dev", GoVersion: "go1.22.2"},
+			want:  "dev with go1.22.2",
+		},
+		{
+			name:  "all",
+			input: Info{Version: "1.0.0", Revision: "abc123", Modified: true, BuildTime: "2024-01-01T00:00:00Z", GoVersion: "go1.22.2"},
+			want:  "1.0.0 (revision abc123, modified) built 2024-01-01T00:00:00Z with go1.22.2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, test.input.String()); diff != "" {
+				t.Errorf("String() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
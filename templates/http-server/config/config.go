@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultEnvPrefix is the default prefix of the environment variables.
+const defaultEnvPrefix = "SERVER"
+
+// Configuration contains the configuration for the application.
+type Configuration struct {
+	Host         string        `config:"host" default:"0.0.0.0" restart:"true" usage:"Host (IP) to listen on."`
+	Port         int           `config:"port" default:"8080" restart:"true" usage:"Port to listen on."`
+	ReadTimeout  time.Duration `config:"readTimeout" default:"15s" usage:"Maximum duration for reading a request."`
+	WriteTimeout time.Duration `config:"writeTimeout" default:"15s" usage:"Maximum duration before timing out writes of a response."`
+	IdleTimeout  time.Duration `config:"idleTimeout" default:"30s" restart:"true" usage:"Maximum duration to wait for the next request with keep-alives enabled."`
+	TLS          TLS           `config:"tls"`
+	Proxy        Proxy         `config:"proxy"`
+	Log          Log           `config:"log"`
+	Tracing      Tracing       `config:"tracing"`
+	Metrics      Metrics       `config:"metrics"`
+}
+
+// TLS contains the TLS configuration for the application.
+type TLS struct {
+	Certificate string `config:"certificate" restart:"true" usage:"Path to TLS certificate, or PEM encoded certificate."`
+	Key         Secret `config:"key" restart:"true" usage:"Path to TLS key, or PEM encoded key."`
+}
+
+// Proxy contains the configuration of the PROXY protocol.
+type Proxy struct {
+	Trusted       []string      `config:"trusted" restart:"true" usage:"CIDRs of the load balancers that send a PROXY protocol header (disabled if empty)."`
+	HeaderTimeout time.Duration `config:"headerTimeout" default:"5s" restart:"true" usage:"Maximum duration for reading a PROXY protocol header."`
+}
+
+// Metrics contains the configuration of the metrics endpoint.
+type Metrics struct {
+	Address string `config:"address" restart:"true" usage:"Address to serve metrics on at /metrics (disabled if empty)."`
+}
+
+// Tracing contains the tracing configuration for the application.
+type Tracing struct {
+	Enabled     bool   `config:"enabled" restart:"true" usage:"Start a span for every request and propagate the trace context."`
+	Endpoint    string `config:"endpoint" restart:"true" usage:"URL of an OTLP/HTTP collector traces endpoint (spans are not exported if empty)."`
+	ServiceName string `config:"serviceName" default:"http-server" restart:"true" usage:"Service name of the exported spans."`
+	Headers     Secret `config:"headers" restart:"true" usage:"Headers of the export requests, as comma separated key=value pairs."`
+}
+
+// HeaderMap returns the headers of the export requests.
+func (t Tracing) HeaderMap() (map[string]string, error) {
+	if len(t.Headers) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(t.Headers.Value(), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || len(key) == 0 {
+			return nil, errors.New("tracing headers must be key=value pairs")
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// Log contains the logging configuration for the application.
+type Log struct {
+	Level slog.Level `config:"level" default:"info" usage:"Log level (debug, info, warn or error)."`
+}
+
+// New returns a new Configuration loaded from defaults, an optional
+// configuration file, environment variables and the command-line
+// arguments args, in that order of precedence.
+func New(args []string, options ...Option) (Configuration, error) {
+	cfg := Configuration{}
+	l := newLoader(filepath.Base(os.Args[0]), defaultEnvPrefix, options...)
+	if err := l.load(&cfg, args); err != nil {
+		return Configuration{}, err
+	}
+	return cfg, nil
+}
+
+// Validate the Configuration. All errors are returned together.
+func (c Configuration) Validate() error {
+	var errs []error
+	if len(c.Host) == 0 {
+		errs = append(errs, errors.New("host must be specified"))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, errors.New("port must be between 1 and 65535"))
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative"))
+	}
+	if (len(c.TLS.Certificate) == 0) != (len(c.TLS.Key) == 0) {
+		errs = append(errs, errors.New("both TLS certificate and key must be specified"))
+	}
+	for _, cidr := range c.Proxy.Trusted {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid trusted proxy: %w", err))
+		}
+	}
+	if len(c.Tracing.Endpoint) > 0 {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			errs = append(errs, errors.New("tracing endpoint must be an http or https URL"))
+		}
+	}
+	if _, err := c.Tracing.HeaderMap(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   []string
+		want    Configuration
+		wantErr []string
+	}{
+		{
+			name:  "defaults",
+			input: []string{},
+			want: Configuration{
+				Host:         "0.0.0.0",
+				Port:         8080,
+				ReadTimeout:  15 * time.Second,
+				WriteTimeout: 15 * time.Second,
+				IdleTimeout:  30 * time.Second,
+				Proxy: Proxy{
+					HeaderTimeout: 5 * time.Second,
+				},
+				Log: Log{
+					Level: slog.LevelInfo,
+				},
+				Tracing: Tracing{
+					ServiceName: "http-server",
+				},
+			},
+		},
+		{
+			name:  "with flags",
+			input: []string{"--host", "localhost", "--port", "8081", "--tls-certificate", "cert.pem", "--tls-key", "key.pem", "--proxy-trusted", "10.0.0.0/8", "--log-level", "debug", "--tracing-enabled", "--tracing-endpoint", "http://localhost:4318/v1/traces", "--tracing-headers", "Authorization=token", "--metrics-address", "127.0.0.1:9090"},
+			want: Configuration{
+				Host:         "localhost",
+				Port:         8081,
+				ReadTimeout:  15 * time.Second,
+				WriteTimeout: 15 * time.Second,
+				IdleTimeout:  30 * time.Second,
+				TLS: TLS{
+					Certificate: "cert.pem",
+					Key:         "key.pem",
+				},
+				Proxy: Proxy{
+					Trusted:       []string{"10.0.0.0/8"},
+					HeaderTimeout: 5 * time.Second,
+				},
+				Log: Log{
+					Level: slog.LevelDebug,
+				},
+				Tracing: Tracing{
+					Enabled:     true,
+					Endpoint:    "http://localhost:4318/v1/traces",
+					ServiceName: "http-server",
+					Headers:     "Authorization=token",
+				},
+				Metrics: Metrics{
+					Address: "127.0.0.1:9090",
+				},
+			},
+		},
+		{
+			name:  "invalid",
+			input: []string{"--host", "", "--port", "0", "--read-timeout", "-1s", "--tls-certificate", "cert.pem", "--proxy-trusted", "10.0.0.0", "--tracing-endpoint", "localhost:4318", "--tracing-headers", "Authorization"},
+			wantErr: []string{
+				"host must be specified",
+				"port must be between 1 and 65535",
+				"timeouts must not be negative",
+				"both TLS certificate and key must be specified",
+				`invalid trusted proxy: netip.ParsePrefix("10.0.0.0"): no '/'`,
+				"tracing endpoint must be an http or https URL",
+				"tracing headers must be key=value pairs",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := New(test.input, WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{}))
+
+			if len(test.wantErr) > 0 {
+				if gotErr == nil {
+					t.Fatalf("New() = nil; want error")
+				}
+				if diff := cmp.Diff(test.wantErr, strings.Split(gotErr.Error(), "\n")); diff != "" {
+					t.Errorf("New() = unexpected error (-want +got):\n%s\n", diff)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("New() = unexpected error: %v", gotErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("New() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "log:\n  level: info\n")
+
+	args := []string{"--config", path}
+	options := []Option{WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{})}
+	cfg, err := New(args, options...)
+	if err != nil {
+		t.Fatalf("New() = unexpected error: %v", err)
+	}
+
+	logs := []string{}
+	w := NewWatcher(cfg, args, &mockLogger{logs: &logs}, options...)
+	var got []Event
+	w.Subscribe(func(e Event) {
+		got = append(got, e)
+	})
+
+	writeConfig(t, path, "log:\n  level: debug\n")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() = unexpected error: %v", err)
+	}
+	writeConfig(t, path, "log:\n  level: verbose\n")
+	if err := w.Reload(); err == nil {
+		t.Errorf("Reload() = nil; want error")
+	}
+	if err := w.Reload(); err == nil {
+		t.Errorf("Reload() = nil; want error")
+	}
+
+	want := []Event{
+		{
+			Previous: cfg,
+			Current:  w.Current(),
+			Changes:  []Change{{Key: "log.level", Previous: "INFO", Current: "DEBUG"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Reload() = unexpected events (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(slog.LevelDebug, w.Current().Log.Level); diff != "" {
+		t.Errorf("Current() = unexpected log level (-want +got):\n%s\n", diff)
+	}
+	wantLogs := []string{"Configuration reloaded.", "Failed to reload configuration.", "Failed to reload configuration."}
+	if diff := cmp.Diff(wantLogs, logs); diff != "" {
+		t.Errorf("Reload() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestWatcher_Reload_Secret(t *testing.T) {
+	dir := t.TempDir()
+	path, keyPath := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "key")
+	writeConfig(t, path, "tls:\n  certificate: cert.pem\n")
+	writeConfig(t, keyPath, "first")
+	t.Setenv("CONFIG_TEST_TLS_KEY_FILE", keyPath)
+
+	args := []string{"--config", path}
+	options := []Option{WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{}), WithSecretProvider(NewSecretProvider())}
+	cfg, err := New(args, options...)
+	if err != nil {
+		t.Fatalf("New() = unexpected error: %v", err)
+	}
+
+	w := NewWatcher(cfg, args, &mockLogger{logs: &[]string{}}, options...)
+	writeConfig(t, keyPath, "second")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() = unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff("second", w.Current().TLS.Key.Value()); diff != "" {
+		t.Errorf("Reload() = unexpected secret (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestWatcher_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "log:\n  level: info\n")
+
+	args := []string{"--config", path}
+	options := []Option{WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{})}
+	cfg, err := New(args, options...)
+	if err != nil {
+		t.Fatalf("New() = unexpected error: %v", err)
+	}
+
+	w := NewWatcher(cfg, args, &mockLogger{logs: &[]string{}}, options...)
+	w.interval = 10 * time.Millisecond
+	eventCh := make(chan Event, 1)
+	w.Subscribe(func(e Event) {
+		eventCh <- e
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+
+	writeConfig(t, path, "log:\n  level: error\n")
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(path, modTime, modTime)
+
+	select {
+	case got := <-eventCh:
+		if diff := cmp.Diff(slog.LevelError, got.Current.Log.Level); diff != "" {
+			t.Errorf("Watch() = unexpected log level (-want +got):\n%s\n", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Watch() = no event received")
+	}
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+}
+
+type mockLogger struct {
+	mu   sync.Mutex
+	logs *[]string
+}
+
+func (l *mockLogger) Info(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.logs = append(*l.logs, msg)
+}
+
+func (l *mockLogger) Error(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.logs = append(*l.logs, msg)
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecret(t *testing.T) {
+	secret := Secret("hunter2")
+	v := struct {
+		Password Secret `json:"password" yaml:"password"`
+	}{
+		Password: secret,
+	}
+
+	t.Run("fmt", func(t *testing.T) {
+		for _, format := range []string{"%v", "%s", "%#v", "%+v"} {
+			if got := fmt.Sprintf(format, v); strings.Contains(got, "hunter2") {
+				t.Errorf("Sprintf(%q) = unexpected result, secret not redacted: %s", format, got)
+			}
+			if got := fmt.Sprintf(format, secret); got != redacted {
+				t.Errorf("Sprintf(%q) = unexpected result, want: %s, got: %s", format, redacted, got)
+			}
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		got, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(`{"password":"[REDACTED]"}`, string(got)); diff != "" {
+			t.Errorf("Marshal() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		got, err := yaml.Marshal(v)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff("password: '[REDACTED]'\n", string(got)); diff != "" {
+			t.Errorf("Marshal() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		log := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))
+		log.Info("Test.", "password", secret, "config", v)
+
+		want := `{"level":"INFO","msg":"Test.","password":"[REDACTED]","config":{"password":"[REDACTED]"}}` + "\n"
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("Info() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("value", func(t *testing.T) {
+		if got := secret.Value(); got != "hunter2" {
+			t.Errorf("Value() = unexpected result, want: %s, got: %s", "hunter2", got)
+		}
+	})
+}
+
+func TestSecretProvider_Lookup(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			name  string
+			env   map[string]string
+			files map[string]string
+		}
+		want struct {
+			secret Secret
+			ok     bool
+		}
+	}{
+		{
+			name: "from file in environment variable",
+			input: struct {
+				name  string
+				env   map[string]string
+				files map[string]string
+			}{
+				name:  "API_KEY",
+				env:   map[string]string{"API_KEY_FILE": "key.txt"},
+				files: map[string]string{"key.txt": "key\n", "API_KEY": "dir"},
+			},
+			want: struct {
+				secret Secret
+				ok     bool
+			}{secret: "key", ok: true},
+		},
+		{
+			name: "from directory",
+			input: struct {
+				name  string
+				env   map[string]string
+				files map[string]string
+			}{
+				name:  "API_KEY",
+				files: map[string]string{"API_KEY": "dir\r\n"},
+			},
+			want: struct {
+				secret Secret
+				ok     bool
+			}{secret: "dir", ok: true},
+		},
+		{
+			name: "from directory with lower case name",
+			input: struct {
+				name  string
+				env   map[string]string
+				files map[string]string
+			}{
+				name:  "API_KEY",
+				files: map[string]string{"api_key": "dir"},
+			},
+			want: struct {
+				secret Secret
+				ok     bool
+			}{secret: "dir", ok: true},
+		},
+		{
+			name: "not found",
+			input: struct {
+				name  string
+				env   map[string]string
+				files map[string]string
+			}{
+				name: "API_KEY",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.input.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+					t.Fatalf("unexpected error writing file: %v", err)
+				}
+			}
+			p := NewSecretProvider(dir)
+			p.lookupEnv = func(key string) (string, bool) {
+				v, ok := test.input.env[key]
+				if ok {
+					v = filepath.Join(dir, v)
+				}
+				return v, ok
+			}
+
+			secret, ok, err := p.Lookup(test.input.name)
+			if err != nil {
+				t.Fatalf("Lookup() = unexpected error: %v", err)
+			}
+			got := struct {
+				secret Secret
+				ok     bool
+			}{secret: secret, ok: ok}
+
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(struct {
+				secret Secret
+				ok     bool
+			}{})); diff != "" {
+				t.Errorf("Lookup() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestSecretProvider_Path(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password.txt")
+	if err := os.WriteFile(path, []byte("password"), 0600); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+
+	lookupEnv := func(key string) (string, bool) {
+		if key == "TEST_PASSWORD_FILE" {
+			return path, true
+		}
+		return "", false
+	}
+	p := NewSecretProvider(dir)
+	p.lookupEnv = lookupEnv
+	l := newLoader("test", "TEST", WithOutput(&bytes.Buffer{}), WithSecretProvider(p))
+	l.lookupEnv = lookupEnv
+
+	cfg := testConfiguration{}
+	if err := l.load(&cfg, []string{"--token", "token"}); err != nil {
+		t.Fatalf("load() = unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(Secret("password"), cfg.Password); diff != "" {
+		t.Errorf("load() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	got, ok := p.Path("password")
+	if !ok {
+		t.Fatalf("Path() = not found")
+	}
+	if diff := cmp.Diff(path, got); diff != "" {
+		t.Errorf("Path() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if _, ok := p.Path("token"); ok {
+		t.Errorf("Path() = found; want not found")
+	}
+}
+
+func TestSecretProvider_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "API_KEY")
+	if err := os.WriteFile(path, []byte("key1"), 0600); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+
+	p := NewSecretProvider(dir)
+	if _, _, err := p.Lookup("API_KEY"); err != nil {
+		t.Fatalf("Lookup() = unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type change struct {
+		name  string
+		value string
+	}
+	changeCh := make(chan change, 1)
+	go p.Watch(ctx, 10*time.Millisecond, func(name string, value Secret) {
+		changeCh <- change{name: name, value: value.Value()}
+	})
+
+	if err := os.WriteFile(path, []byte("key2"), 0600); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+
+	select {
+	case got := <-changeCh:
+		if diff := cmp.Diff(change{name: "API_KEY", value: "key2"}, got, cmp.AllowUnexported(change{})); diff != "" {
+			t.Errorf("Watch() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Watch() = no change received")
+	}
+
+	select {
+	case got := <-changeCh:
+		t.Errorf("Watch() = unexpected change: %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,15 +1,115 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/RedeployAB/go-template/templates/http-server/config"
 	"github.com/RedeployAB/go-template/templates/http-server/server"
+	"github.com/RedeployAB/go-template/templates/http-server/version"
+)
+
+const (
+	// healthcheckTimeout is the timeout of the healthcheck command.
+	healthcheckTimeout = 5 * time.Second
+	// secretWatchInterval is the interval at which the files of the
+	// secrets are checked for changes.
+	secretWatchInterval = 30 * time.Second
 )
 
 func main() {
-	log := server.NewLogger()
+	args := os.Args[1:]
+	healthcheck := len(args) > 0 && args[0] == "healthcheck"
+	if healthcheck {
+		args = args[1:]
+	}
+
+	secrets := config.NewSecretProvider()
+	cfg, err := config.New(args, config.WithSecretProvider(secrets))
+	if err != nil {
+		if errors.Is(err, config.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, config.ErrVersion) {
+			fmt.Println(version.Get())
+			os.Exit(0)
+		}
+		server.NewLogger().Error("Configuration error.", "error", err)
+		os.Exit(1)
+	}
+
+	level := &slog.LevelVar{}
+	level.Set(cfg.Log.Level)
+	log := server.NewLogger(server.WithLevel(level))
+
+	// A TLS key read from a secret file is passed as the path of the
+	// file, so that it is reloaded together with the certificate.
+	tlsKey := cfg.TLS.Key.Value()
+	if path, ok := secrets.Path("tls.key"); ok {
+		tlsKey = path
+	}
+
+	options := server.Options{
+		Logger:   log,
+		LogLevel: level,
+		TLSConfig: server.TLSConfig{
+			Certificate: cfg.TLS.Certificate,
+			Key:         tlsKey,
+		},
+		Proxy: server.ProxyOptions{
+			Trusted:       cfg.Proxy.Trusted,
+			HeaderTimeout: cfg.Proxy.HeaderTimeout,
+		},
+		Host:           cfg.Host,
+		Port:           cfg.Port,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MetricsAddress: cfg.Metrics.Address,
+	}
+
+	if healthcheck {
+		ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+		err := server.Healthcheck(ctx, options)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Healthcheck failed: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if cfg.Tracing.Enabled {
+		// The headers are validated with the configuration.
+		headers, _ := cfg.Tracing.HeaderMap()
+		options.Tracer = server.NewTracer(server.TracerOptions{
+			ServiceName: cfg.Tracing.ServiceName,
+			Endpoint:    cfg.Tracing.Endpoint,
+			Headers:     headers,
+			Logger:      log,
+		})
+	}
+
+	srv := server.New(server.WithOptions(options))
 
-	srv := server.New(server.WithOptions(server.Options{
-		Logger: log,
-	}))
+	watcher := config.NewWatcher(cfg, args, log, config.WithSecretProvider(secrets))
+	watcher.Subscribe(func(e config.Event) {
+		srv.Update(server.Settings{
+			LogLevel:     e.Current.Log.Level,
+			ReadTimeout:  e.Current.ReadTimeout,
+			WriteTimeout: e.Current.WriteTimeout,
+		})
+	})
+	go watcher.Watch(context.Background())
+	// A rotated secret file reloads the configuration, which resolves
+	// the secrets again and publishes the changes to the subscribers.
+	go secrets.Watch(context.Background(), secretWatchInterval, func(name string, value config.Secret) {
+		watcher.Reload()
+	})
 
 	if err := srv.Start(); err != nil {
 		log.Error("Server error.", "error", err)
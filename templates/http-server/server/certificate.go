@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/tls"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certificateCheckInterval is the minimum interval between checks
+// for changed certificate files.
+const certificateCheckInterval = 10 * time.Second
+
+// certificate holds a TLS certificate loaded from PEM encoded data or
+// files. Certificates loaded from files are reloaded when the files
+// change, so rotated certificates are served without a restart.
+type certificate struct {
+	config  TLSConfig
+	log     logger
+	now     func() time.Time
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// newCertificate returns a new certificate loaded from the TLSConfig.
+func newCertificate(config TLSConfig, log logger) (*certificate, error) {
+	c := &certificate{
+		config: config,
+		log:    log,
+		now:    time.Now,
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate returns the certificate, and is used with tls.Config.
+// The files are checked for changes at most once every
+// certificateCheckInterval. If a changed certificate fails to load the
+// current certificate is kept, and it is retried at the next check.
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := c.now(); now.Sub(c.checked) >= certificateCheckInterval {
+		c.checked = now
+		if c.lastModified().After(c.modTime) {
+			if err := c.load(); err != nil {
+				c.log.Error("Failed to reload TLS certificate.", "error", err)
+			} else {
+				c.log.Info("TLS certificate reloaded.")
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// load loads the certificate and key.
+func (c *certificate) load() error {
+	modTime := c.lastModified()
+	certPEM, err := readPEM(c.config.Certificate)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := readPEM(c.config.Key)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	c.checked = c.now()
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate
+// and key files.
+func (c *certificate) lastModified() time.Time {
+	var modTime time.Time
+	for _, s := range []string{c.config.Certificate, c.config.Key} {
+		if isPEM(s) {
+			continue
+		}
+		if info, err := os.Stat(s); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
+
+// readPEM returns s if it is PEM encoded data, otherwise it reads the
+// file at path s.
+func readPEM(s string) ([]byte, error) {
+	if isPEM(s) {
+		return []byte(s), nil
+	}
+	return os.ReadFile(s)
+}
+
+// isPEM returns true if s is PEM encoded data.
+func isPEM(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "-----BEGIN")
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewCertificate(t *testing.T) {
+	certPEM, keyPEM := generateCertificate(t, "test")
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	var tests = []struct {
+		name    string
+		input   TLSConfig
+		wantErr bool
+	}{
+		{
+			name:  "from files",
+			input: TLSConfig{Certificate: certFile, Key: keyFile},
+		},
+		{
+			name:  "from PEM encoded data",
+			input: TLSConfig{Certificate: string(certPEM), Key: string(keyPEM)},
+		},
+		{
+			name:  "certificate from file and key from PEM encoded data",
+			input: TLSConfig{Certificate: certFile, Key: string(keyPEM)},
+		},
+		{
+			name:    "missing file",
+			input:   TLSConfig{Certificate: filepath.Join(dir, "missing.pem"), Key: keyFile},
+			wantErr: true,
+		},
+		{
+			name:    "invalid key",
+			input:   TLSConfig{Certificate: certFile, Key: certFile},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := newCertificate(test.input, &mockLogger{logs: &[]string{}})
+			if test.wantErr {
+				if gotErr == nil {
+					t.Errorf("newCertificate() = nil; want error")
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("newCertificate() = unexpected error: %v", gotErr)
+			}
+			if diff := cmp.Diff("test", commonName(t, got)); diff != "" {
+				t.Errorf("newCertificate() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestCertificate_GetCertificate(t *testing.T) {
+	// The key is a secret file, as it is passed from a secret directory
+	// or SERVER_TLS_KEY_FILE.
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "SERVER_TLS_KEY")
+	certPEM, keyPEM := generateCertificate(t, "first")
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	logs := []string{}
+	cert, err := newCertificate(TLSConfig{Certificate: certFile, Key: keyFile}, &mockLogger{logs: &logs})
+	if err != nil {
+		t.Fatalf("newCertificate() = unexpected error: %v", err)
+	}
+	now := time.Now()
+	cert.now = func() time.Time {
+		return now
+	}
+
+	// Rotate the certificate, with a modification time after the
+	// first load.
+	certPEM, keyPEM = generateCertificate(t, "second")
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	modTime := cert.modTime.Add(time.Second)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+
+	if diff := cmp.Diff("first", commonName(t, cert)); diff != "" {
+		t.Errorf("GetCertificate() = unexpected result before check interval (-want +got):\n%s\n", diff)
+	}
+
+	now = now.Add(certificateCheckInterval)
+	if diff := cmp.Diff("second", commonName(t, cert)); diff != "" {
+		t.Errorf("GetCertificate() = unexpected result after check interval (-want +got):\n%s\n", diff)
+	}
+
+	// Write an invalid key, the current certificate should be kept.
+	writeFile(t, keyFile, []byte("invalid"))
+	modTime = modTime.Add(time.Second)
+	os.Chtimes(keyFile, modTime, modTime)
+
+	now = now.Add(certificateCheckInterval)
+	if diff := cmp.Diff("second", commonName(t, cert)); diff != "" {
+		t.Errorf("GetCertificate() = unexpected result after failed reload (-want +got):\n%s\n", diff)
+	}
+
+	want := []string{"TLS certificate reloaded.", "Failed to reload TLS certificate.", "error", ""}
+	if diff := cmp.Diff(want, logs); diff != "" {
+		t.Errorf("GetCertificate() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func commonName(t *testing.T, c *certificate) string {
+	t.Helper()
+	cert, err := c.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate() = unexpected error: %v", err)
+	}
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("unexpected error parsing certificate: %v", err)
+	}
+	return x509Cert.Subject.CommonName
+}
+
+func generateCertificate(t *testing.T, commonName string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// health returns a handler that responds with the health of the server.
+func (s server) health() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Status string `json:"status"`
+		}{
+			Status: "ok",
+		})
+	})
+}
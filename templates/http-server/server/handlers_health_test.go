@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_Health(t *testing.T) {
+	srv := &server{router: NewRouter()}
+	srv.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+
+	if diff := cmp.Diff(http.StatusOK, rec.Code); diff != "" {
+		t.Errorf("health() = unexpected status (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(`{"status":"ok"}`+"\n", rec.Body.String()); diff != "" {
+		t.Errorf("health() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
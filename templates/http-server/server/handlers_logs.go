@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// logs returns a handler that responds with the records in the log
+// buffer. If the request accepts text/event-stream, or has the query
+// parameter follow=true, the records are followed by new records as
+// server-sent events until the client disconnects or the server is
+// shut down.
+//
+// Records can be filtered with the query parameters level (minimum level)
+// and attr (key=value, can be repeated).
+func (s server) logs() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseLogFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !isEventStream(r) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s.logBuffer.Records(filter))
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		records, ch, unsubscribe := s.logBuffer.Subscribe(filter)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		for _, record := range records {
+			if err := writeEvent(w, record); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-s.shutdownCh:
+				return
+			case record := <-ch:
+				if !filter.match(record) {
+					continue
+				}
+				if err := writeEvent(w, record); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// parseLogFilter parses the query parameters level and attr into
+// a LogFilter.
+func parseLogFilter(r *http.Request) (LogFilter, error) {
+	filter := LogFilter{Level: slog.LevelDebug}
+	query := r.URL.Query()
+	if level := query.Get("level"); len(level) > 0 {
+		if err := filter.Level.UnmarshalText([]byte(level)); err != nil {
+			return LogFilter{}, fmt.Errorf("invalid level: %s", level)
+		}
+	}
+	for _, attr := range query["attr"] {
+		k, v, ok := strings.Cut(attr, "=")
+		if !ok || len(k) == 0 {
+			return LogFilter{}, fmt.Errorf("invalid attr: %s, must be key=value", attr)
+		}
+		if filter.Attrs == nil {
+			filter.Attrs = make(map[string]string)
+		}
+		filter.Attrs[k] = v
+	}
+	return filter, nil
+}
+
+// isEventStream reports whether the request asks for server-sent events.
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.URL.Query().Get("follow") == "true"
+}
+
+// writeEvent writes the record as a server-sent event.
+func writeEvent(w http.ResponseWriter, record LogRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", b)
+	return err
+}
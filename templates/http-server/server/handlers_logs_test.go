@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_Logs(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		want  struct {
+			status   int
+			messages []string
+		}
+	}{
+		{
+			name:  "all records",
+			input: "/admin/logs",
+			want: struct {
+				status   int
+				messages []string
+			}{
+				status:   http.StatusOK,
+				messages: []string{"first", "second", "third"},
+			},
+		},
+		{
+			name:  "filter on level",
+			input: "/admin/logs?level=error",
+			want: struct {
+				status   int
+				messages []string
+			}{
+				status:   http.StatusOK,
+				messages: []string{"second", "third"},
+			},
+		},
+		{
+			name:  "filter on attribute",
+			input: "/admin/logs?level=error&attr=path=/a",
+			want: struct {
+				status   int
+				messages []string
+			}{
+				status:   http.StatusOK,
+				messages: []string{"third"},
+			},
+		},
+		{
+			name:  "invalid level",
+			input: "/admin/logs?level=unknown",
+			want: struct {
+				status   int
+				messages []string
+			}{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			name:  "invalid attribute",
+			input: "/admin/logs?attr=path",
+			want: struct {
+				status   int
+				messages []string
+			}{
+				status: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := NewLogBuffer(10)
+			log := slog.New(NewBufferHandler(slog.NewJSONHandler(io.Discard, nil), buffer))
+			log.Info("first", "path", "/a")
+			log.Error("second", "path", "/b")
+			log.Error("third", "path", "/a")
+
+			srv := &server{router: NewRouter(), logBuffer: buffer}
+			srv.routes()
+
+			rr := httptest.NewRecorder()
+			srv.router.ServeHTTP(rr, httptest.NewRequest("GET", test.input, nil))
+
+			if test.want.status != rr.Code {
+				t.Errorf("logs() = unexpected status, want: %d, got: %d", test.want.status, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var records []LogRecord
+			if err := json.NewDecoder(rr.Body).Decode(&records); err != nil {
+				t.Fatalf("unexpected error decoding response: %v", err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.Message)
+			}
+			if diff := cmp.Diff(test.want.messages, got); diff != "" {
+				t.Errorf("logs() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestServer_Logs_Stream(t *testing.T) {
+	t.Run("stream records", func(t *testing.T) {
+		buffer := NewLogBuffer(10)
+		log := slog.New(NewBufferHandler(slog.NewJSONHandler(io.Discard, nil), buffer))
+		log.Info("first")
+
+		srv := &server{router: NewRouter(), logBuffer: buffer}
+		srv.routes()
+		ts := httptest.NewServer(requestLogger(&mockLogger{logs: &[]string{}}, srv.router))
+		defer ts.Close()
+
+		req, _ := http.NewRequest("GET", ts.URL+"/admin/logs?level=error", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Errorf("logs() = unexpected content type, want: text/event-stream, got: %s", got)
+		}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			log.Info("second")
+			log.Error("third")
+		}()
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var got LogRecord
+			if err := json.Unmarshal([]byte(data), &got); err != nil {
+				t.Fatalf("unexpected error decoding event: %v", err)
+			}
+			if got.Message != "third" {
+				t.Errorf("logs() = unexpected result, want: third, got: %s", got.Message)
+			}
+			return
+		}
+		t.Errorf("logs() = stream ended without records")
+	})
+
+	t.Run("end stream on shutdown", func(t *testing.T) {
+		srv := New(WithOptions(Options{
+			Logger:    &mockLogger{logs: &[]string{}},
+			LogBuffer: NewLogBuffer(10),
+		}))
+		srv.routes()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		go srv.httpServer.Serve(l)
+
+		req, _ := http.NewRequest("GET", "http://"+l.Addr().String()+"/admin/logs?follow=true", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := srv.httpServer.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() = unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RedeployAB/go-template/templates/http-server/version"
+)
+
+// version returns a handler that responds with the version and build
+// information of the binary.
+func (s server) version() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version.Get())
+	})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RedeployAB/go-template/templates/http-server/version"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_Version(t *testing.T) {
+	srv := &server{router: NewRouter()}
+	srv.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+
+	if diff := cmp.Diff(http.StatusOK, rec.Code); diff != "" {
+		t.Errorf("version() = unexpected status (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff("application/json", rec.Header().Get("Content-Type")); diff != "" {
+		t.Errorf("version() = unexpected content type (-want +got):\n%s\n", diff)
+	}
+
+	var got version.Info
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+	if diff := cmp.Diff(version.Get(), got); diff != "" {
+		t.Errorf("version() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// healthPath is the path of the health endpoint.
+const healthPath = "/health"
+
+// Healthcheck probes the health endpoint of a local server configured
+// with options, over HTTPS if TLS is configured. It is used by the
+// healthcheck command, since the container image has neither a shell
+// nor curl.
+func Healthcheck(ctx context.Context, options Options) error {
+	host := options.Host
+	if len(host) == 0 || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	port := defaultPort
+	if options.Port > 0 {
+		port = strconv.Itoa(options.Port)
+	}
+
+	scheme := "http"
+	client := &http.Client{}
+	if !options.TLSConfig.isEmpty() {
+		scheme = "https"
+		// The certificate is issued for the public name of the server
+		// and not for the local address, so it is not verified.
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+net.JoinHostPort(host, port)+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unhealthy: status code %d", resp.StatusCode)
+	}
+	return nil
+}
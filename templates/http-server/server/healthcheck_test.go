@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHealthcheck(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			status int
+			tls    bool
+		}
+		wantErr bool
+	}{
+		{
+			name: "healthy",
+			input: struct {
+				status int
+				tls    bool
+			}{
+				status: http.StatusOK,
+			},
+		},
+		{
+			name: "healthy over TLS",
+			input: struct {
+				status int
+				tls    bool
+			}{
+				status: http.StatusOK,
+				tls:    true,
+			},
+		},
+		{
+			name: "unhealthy",
+			input: struct {
+				status int
+				tls    bool
+			}{
+				status: http.StatusServiceUnavailable,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != healthPath {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(test.input.status)
+			})
+
+			var ts *httptest.Server
+			options := Options{}
+			if test.input.tls {
+				ts = httptest.NewTLSServer(handler)
+				options.TLSConfig = TLSConfig{Certificate: "cert.pem", Key: "key.pem"}
+			} else {
+				ts = httptest.NewServer(handler)
+			}
+			defer ts.Close()
+
+			host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+			options.Host = host
+			options.Port, _ = strconv.Atoi(port)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotErr := Healthcheck(ctx, options)
+			if test.wantErr && gotErr == nil {
+				t.Errorf("Healthcheck() = nil; want error")
+			}
+			if !test.wantErr && gotErr != nil {
+				t.Errorf("Healthcheck() = unexpected error: %v", gotErr)
+			}
+		})
+	}
+
+	t.Run("not running", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := Healthcheck(ctx, Options{Host: "127.0.0.1", Port: port}); err == nil {
+			t.Errorf("Healthcheck() = nil; want error")
+		}
+	})
+}
@@ -1,17 +1,99 @@
 package server
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"os"
 )
 
-// logger is the interface that wraps around methods Info and Error.
+// logger is the interface that wraps around methods Info and Error,
+// and their counterparts InfoContext and ErrorContext.
 type logger interface {
 	Info(msg string, args ...any)
 	Error(msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
 }
 
-// NewLogger creates a new slog with a JSON handler.
-func NewLogger() logger {
-	return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+// loggerOptions holds the configuration for the logger.
+type loggerOptions struct {
+	level    slog.Leveler
+	outputs  []io.Writer
+	sampling *SamplingOptions
+	buffer   *LogBuffer
+}
+
+// LoggerOption is a function that configures the logger.
+type LoggerOption func(*loggerOptions)
+
+// NewLogger creates a new slog with a JSON handler. Records logged with
+// a context containing a span gets the trace and span IDs added.
+func NewLogger(options ...LoggerOption) logger {
+	opts := loggerOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	var output io.Writer = os.Stderr
+	if len(opts.outputs) == 1 {
+		output = opts.outputs[0]
+	} else if len(opts.outputs) > 1 {
+		output = &multiWriter{writers: opts.outputs}
+	}
+
+	var handler slog.Handler = &traceHandler{Handler: slog.NewJSONHandler(output, &slog.HandlerOptions{Level: opts.level})}
+	if opts.buffer != nil {
+		handler = NewBufferHandler(handler, opts.buffer)
+	}
+	if opts.sampling != nil {
+		handler = NewSamplingHandler(handler, *opts.sampling)
+	}
+	return slog.New(handler)
+}
+
+// closeLogger closes the handler of the logger if it can be closed, such
+// as the handler of a logger with sampling.
+func closeLogger(log logger) error {
+	l, ok := log.(*slog.Logger)
+	if !ok {
+		return nil
+	}
+	if c, ok := l.Handler().(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// WithLevel configures the minimum level of the records to log.
+// Defaults to slog.LevelInfo.
+func WithLevel(level slog.Leveler) LoggerOption {
+	return func(o *loggerOptions) {
+		o.level = level
+	}
+}
+
+// WithOutput configures the logger to write to the given outputs
+// instead of os.Stderr. Several outputs can be provided, for example
+// os.Stderr and a FileWriter.
+func WithOutput(outputs ...io.Writer) LoggerOption {
+	return func(o *loggerOptions) {
+		o.outputs = append(o.outputs, outputs...)
+	}
+}
+
+// WithSampling configures the logger to sample messages with
+// the given SamplingOptions.
+func WithSampling(options SamplingOptions) LoggerOption {
+	return func(o *loggerOptions) {
+		o.sampling = &options
+	}
+}
+
+// WithBuffer configures the logger to keep records in the given
+// LogBuffer alongside the output.
+func WithBuffer(buffer *LogBuffer) LoggerOption {
+	return func(o *loggerOptions) {
+		o.buffer = buffer
+	}
 }
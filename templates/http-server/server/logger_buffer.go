@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the log buffer.
+const (
+	defaultLogBufferSize       = 1000
+	defaultLogSubscriberBuffer = 100
+)
+
+// LogRecord is a log record kept in a LogBuffer.
+type LogRecord struct {
+	Time    time.Time      `json:"time"`
+	Level   slog.Level     `json:"level"`
+	Message string         `json:"msg"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// LogFilter holds the criteria for filtering log records.
+type LogFilter struct {
+	// Level is the minimum level of the records.
+	Level slog.Level
+	// Attrs are attributes (key and value) that the records must have.
+	Attrs map[string]string
+}
+
+// match reports whether the record matches the filter.
+func (f LogFilter) match(r LogRecord) bool {
+	if r.Level < f.Level {
+		return false
+	}
+	for k, v := range f.Attrs {
+		val, ok := r.Attrs[k]
+		if !ok || fmt.Sprint(val) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// LogBuffer keeps the last N log records in a ring buffer and
+// publishes new records to subscribers.
+type LogBuffer struct {
+	mu          sync.RWMutex
+	records     []LogRecord
+	next        int
+	full        bool
+	subscribers map[chan LogRecord]struct{}
+}
+
+// NewLogBuffer returns a new LogBuffer that keeps the last size records.
+// Defaults to 1000 if size is 0 or less.
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = defaultLogBufferSize
+	}
+	return &LogBuffer{
+		records:     make([]LogRecord, size),
+		subscribers: make(map[chan LogRecord]struct{}),
+	}
+}
+
+// Records returns the buffered records that match the filter, oldest first.
+func (b *LogBuffer) Records(filter LogFilter) []LogRecord {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.filter(filter)
+}
+
+// Subscribe returns the buffered records that match the filter together
+// with a channel that receives new records. The returned function must
+// be called to unsubscribe. Records are dropped for subscribers that
+// are not keeping up.
+func (b *LogBuffer) Subscribe(filter LogFilter) ([]LogRecord, <-chan LogRecord, func()) {
+	ch := make(chan LogRecord, defaultLogSubscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, ch)
+		})
+	}
+	return b.filter(filter), ch, unsubscribe
+}
+
+// add adds a record to the buffer and publishes it to subscribers.
+func (b *LogBuffer) add(r LogRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.records[b.next] = r
+	b.next = (b.next + 1) % len(b.records)
+	if b.next == 0 {
+		b.full = true
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+}
+
+// filter returns the buffered records that match the filter.
+// The caller must hold the lock.
+func (b *LogBuffer) filter(filter LogFilter) []LogRecord {
+	var ordered []LogRecord
+	if b.full {
+		ordered = append(ordered, b.records[b.next:]...)
+	}
+	ordered = append(ordered, b.records[:b.next]...)
+
+	records := make([]LogRecord, 0, len(ordered))
+	for _, r := range ordered {
+		if filter.match(r) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// bufferHandler is a slog.Handler that adds records to a LogBuffer
+// before passing them to the underlying handler.
+type bufferHandler struct {
+	handler slog.Handler
+	buffer  *LogBuffer
+	attrs   map[string]any
+	group   string
+}
+
+// NewBufferHandler returns a new slog.Handler that keeps records in the
+// given LogBuffer alongside the output of the given handler.
+func NewBufferHandler(handler slog.Handler, buffer *LogBuffer) *bufferHandler {
+	return &bufferHandler{
+		handler: handler,
+		buffer:  buffer,
+		attrs:   map[string]any{},
+	}
+}
+
+// Enabled reports whether the underlying handler handles records at the given level.
+func (h *bufferHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle adds the record to the buffer and passes it to the underlying handler.
+func (h *bufferHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := make(map[string]any, len(h.attrs)+r.NumAttrs())
+	for k, v := range h.attrs {
+		attrs[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flattenAttr(attrs, h.group, a)
+		return true
+	})
+	h.buffer.add(LogRecord{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		Attrs:   attrs,
+	})
+	return h.handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new bufferHandler with the given attributes.
+func (h *bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	a := make(map[string]any, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		a[k] = v
+	}
+	for _, attr := range attrs {
+		flattenAttr(a, h.group, attr)
+	}
+	return &bufferHandler{handler: h.handler.WithAttrs(attrs), buffer: h.buffer, attrs: a, group: h.group}
+}
+
+// WithGroup returns a new bufferHandler with the given group. Attributes
+// in groups are kept with their keys qualified by the group, separated
+// by a dot.
+func (h *bufferHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	return &bufferHandler{handler: h.handler.WithGroup(name), buffer: h.buffer, attrs: h.attrs, group: qualifyKey(h.group, name)}
+}
+
+// flattenAttr adds the attribute to attrs, with the keys of grouped
+// attributes qualified by the group.
+func flattenAttr(attrs map[string]any, group string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		g := group
+		if len(a.Key) > 0 {
+			g = qualifyKey(group, a.Key)
+		}
+		for _, attr := range v.Group() {
+			flattenAttr(attrs, g, attr)
+		}
+		return
+	}
+	if len(a.Key) == 0 {
+		return
+	}
+
+	val := v.Any()
+	if err, ok := val.(error); ok {
+		val = err.Error()
+	}
+	attrs[qualifyKey(group, a.Key)] = val
+}
+
+// qualifyKey returns the key qualified by the group.
+func qualifyKey(group, key string) string {
+	if len(group) == 0 {
+		return key
+	}
+	return strings.Join([]string{group, key}, ".")
+}
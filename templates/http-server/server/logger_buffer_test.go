@@ -0,0 +1,142 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLogBuffer(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			size   int
+			log    func(log *slog.Logger)
+			filter LogFilter
+		}
+		want []LogRecord
+	}{
+		{
+			name: "records",
+			input: struct {
+				size   int
+				log    func(log *slog.Logger)
+				filter LogFilter
+			}{
+				size: 10,
+				log: func(log *slog.Logger) {
+					log.Info("first", "key", "value")
+					log.Error("second", "error", errors.New("error"))
+				},
+			},
+			want: []LogRecord{
+				{Level: slog.LevelInfo, Message: "first", Attrs: map[string]any{"key": "value"}},
+				{Level: slog.LevelError, Message: "second", Attrs: map[string]any{"error": "error"}},
+			},
+		},
+		{
+			name: "oldest records are overwritten",
+			input: struct {
+				size   int
+				log    func(log *slog.Logger)
+				filter LogFilter
+			}{
+				size: 2,
+				log: func(log *slog.Logger) {
+					log.Info("first")
+					log.Info("second")
+					log.Info("third")
+				},
+			},
+			want: []LogRecord{
+				{Level: slog.LevelInfo, Message: "second", Attrs: map[string]any{}},
+				{Level: slog.LevelInfo, Message: "third", Attrs: map[string]any{}},
+			},
+		},
+		{
+			name: "attributes and groups",
+			input: struct {
+				size   int
+				log    func(log *slog.Logger)
+				filter LogFilter
+			}{
+				size: 10,
+				log: func(log *slog.Logger) {
+					log.With("service", "test").WithGroup("request").Info("first", "path", "/", slog.Group("client", "ip", "127.0.0.1"))
+				},
+			},
+			want: []LogRecord{
+				{Level: slog.LevelInfo, Message: "first", Attrs: map[string]any{"service": "test", "request.path": "/", "request.client.ip": "127.0.0.1"}},
+			},
+		},
+		{
+			name: "filter on level and attributes",
+			input: struct {
+				size   int
+				log    func(log *slog.Logger)
+				filter LogFilter
+			}{
+				size: 10,
+				log: func(log *slog.Logger) {
+					log.Info("first", "status", 500)
+					log.Error("second", "status", 404)
+					log.Error("third", "status", 500)
+				},
+				filter: LogFilter{Level: slog.LevelError, Attrs: map[string]string{"status": "500"}},
+			},
+			want: []LogRecord{
+				{Level: slog.LevelError, Message: "third", Attrs: map[string]any{"status": int64(500)}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := NewLogBuffer(test.input.size)
+			test.input.log(slog.New(NewBufferHandler(slog.NewJSONHandler(io.Discard, nil), buffer)))
+
+			got := buffer.Records(test.input.filter)
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(LogRecord{}, "Time")); diff != "" {
+				t.Errorf("Records() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestLogBuffer_Subscribe(t *testing.T) {
+	t.Run("subscribe", func(t *testing.T) {
+		buffer := NewLogBuffer(10)
+		log := slog.New(NewBufferHandler(slog.NewJSONHandler(io.Discard, nil), buffer))
+		log.Info("first")
+
+		records, ch, unsubscribe := buffer.Subscribe(LogFilter{})
+		defer unsubscribe()
+		log.Info("second")
+
+		if len(records) != 1 || records[0].Message != "first" {
+			t.Errorf("Subscribe() = unexpected records, want: [first], got: %v", records)
+		}
+
+		select {
+		case got := <-ch:
+			if got.Message != "second" {
+				t.Errorf("Subscribe() = unexpected result, want: second, got: %s", got.Message)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Subscribe() = timed out waiting for record")
+		}
+
+		unsubscribe()
+		log.Info("third")
+		select {
+		case got := <-ch:
+			t.Errorf("Subscribe() = unexpected record after unsubscribe: %s", got.Message)
+		default:
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			options SamplingOptions
+			records []sampleRecord
+		}
+		want []string
+	}{
+		{
+			name: "keep first",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{First: 2},
+				records: repeatRecords(sampleRecord{level: slog.LevelError, msg: "error"}, 5),
+			},
+			want: []string{"error", "error", "Suppressed 3 messages."},
+		},
+		{
+			name: "keep first then sample",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{First: 1, Thereafter: 2},
+				records: repeatRecords(sampleRecord{level: slog.LevelError, msg: "error"}, 5),
+			},
+			want: []string{"error", "error", "error", "Suppressed 2 messages."},
+		},
+		{
+			name: "per message",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{First: 1},
+				records: []sampleRecord{
+					{level: slog.LevelError, msg: "first"},
+					{level: slog.LevelError, msg: "second"},
+					{level: slog.LevelError, msg: "first"},
+				},
+			},
+			want: []string{"first", "second", "Suppressed 1 messages."},
+		},
+		{
+			name: "per key",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{First: 1, Keys: []string{"path"}},
+				records: []sampleRecord{
+					{level: slog.LevelError, msg: "error", args: []any{"path", "/a"}},
+					{level: slog.LevelError, msg: "error", args: []any{"path", "/b"}},
+					{level: slog.LevelError, msg: "error", args: []any{"path", "/a"}},
+				},
+			},
+			want: []string{"error", "error", "Suppressed 1 messages."},
+		},
+		{
+			name: "per logger attributes",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{First: 1},
+				records: []sampleRecord{
+					{level: slog.LevelError, msg: "error", with: []any{"component", "a"}},
+					{level: slog.LevelError, msg: "error", with: []any{"component", "b"}},
+					{level: slog.LevelError, msg: "error", with: []any{"component", "a"}},
+				},
+			},
+			want: []string{"error", "error", "Suppressed 1 messages."},
+		},
+		{
+			name: "per level",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{
+					Levels: map[slog.Level]SamplingThreshold{
+						slog.LevelError: {First: 1},
+					},
+				},
+				records: []sampleRecord{
+					{level: slog.LevelInfo, msg: "info"},
+					{level: slog.LevelInfo, msg: "info"},
+					{level: slog.LevelError, msg: "error"},
+					{level: slog.LevelError, msg: "error"},
+				},
+			},
+			want: []string{"info", "info", "error", "Suppressed 1 messages."},
+		},
+		{
+			name: "new interval",
+			input: struct {
+				options SamplingOptions
+				records []sampleRecord
+			}{
+				options: SamplingOptions{First: 1},
+				records: []sampleRecord{
+					{level: slog.LevelError, msg: "error"},
+					{level: slog.LevelError, msg: "error"},
+					{level: slog.LevelError, msg: "error", after: time.Hour},
+				},
+			},
+			want: []string{"error", "Suppressed 1 messages.", "error"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			test.input.options.Interval = time.Minute
+			handler := NewSamplingHandler(slog.NewJSONHandler(buf, nil), test.input.options)
+
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			handler.sampler.now = func() time.Time {
+				return now
+			}
+
+			log := slog.New(handler)
+			for _, r := range test.input.records {
+				now = now.Add(r.after)
+				log.With(r.with...).Log(context.Background(), r.level, r.msg, r.args...)
+			}
+			handler.Close()
+
+			got := []string{}
+			dec := json.NewDecoder(buf)
+			for dec.More() {
+				var entry struct {
+					Msg string `json:"msg"`
+				}
+				if err := dec.Decode(&entry); err != nil {
+					t.Fatalf("unexpected error decoding log entry: %v", err)
+				}
+				got = append(got, entry.Msg)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Handle() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+type sampleRecord struct {
+	level slog.Level
+	msg   string
+	args  []any
+	with  []any
+	after time.Duration
+}
+
+func repeatRecords(r sampleRecord, n int) []sampleRecord {
+	records := make([]sampleRecord, n)
+	for i := range records {
+		records[i] = r
+	}
+	return records
+}
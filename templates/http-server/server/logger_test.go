@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"log/slog"
 	"os"
 	"testing"
@@ -18,4 +19,45 @@ func TestNewLogger(t *testing.T) {
 			t.Errorf("NewLogger() = unexpected result (-want +got):\n%s\n", diff)
 		}
 	})
+
+	t.Run("with level", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		got := NewLogger(WithOutput(buf), WithLevel(slog.LevelError))
+		got.Info("test")
+
+		if buf.Len() != 0 {
+			t.Errorf("NewLogger() = unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("with outputs", func(t *testing.T) {
+		first, second := &bytes.Buffer{}, &bytes.Buffer{}
+		got := NewLogger(WithOutput(first, second))
+		got.Info("test")
+
+		if first.Len() == 0 || first.String() != second.String() {
+			t.Errorf("NewLogger() = unexpected result, want equal output, got: %q and %q", first.String(), second.String())
+		}
+	})
+
+	t.Run("with sampling", func(t *testing.T) {
+		got := NewLogger(WithSampling(SamplingOptions{First: 10})).(*slog.Logger)
+
+		if _, ok := got.Handler().(*samplingHandler); !ok {
+			t.Errorf("NewLogger() = unexpected handler, want *samplingHandler, got: %T", got.Handler())
+		}
+	})
+}
+
+func TestCloseLogger(t *testing.T) {
+	log := NewLogger(WithSampling(SamplingOptions{First: 10}))
+	if err := closeLogger(log); err != nil {
+		t.Fatalf("closeLogger() = unexpected error: %v", err)
+	}
+
+	select {
+	case <-log.(*slog.Logger).Handler().(*samplingHandler).sampler.doneCh:
+	default:
+		t.Errorf("closeLogger() = sampler not stopped")
+	}
 }
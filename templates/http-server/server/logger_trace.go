@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+)
+
+// traceHandler is a slog.Handler that adds the trace and span IDs of the
+// span in the context to the records.
+type traceHandler struct {
+	slog.Handler
+}
+
+// Handle adds the attributes traceId and spanId to the record if the
+// context contains a span, and passes it to the underlying handler.
+func (h *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if span := SpanFromContext(ctx); span != nil {
+		sc := span.SpanContext()
+		r.AddAttrs(slog.String("traceId", sc.TraceID.String()), slog.String("spanId", sc.SpanID.String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new traceHandler with the given attributes.
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a new traceHandler with the given group.
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Buckets of the histograms.
+var (
+	durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	sizeBuckets     = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+)
+
+// metrics holds the counters and histograms of the requests of the
+// server. They are written in the Prometheus text format. A nil metrics
+// is a no-op.
+type metrics struct {
+	active    atomic.Int64
+	requests  *counterVec
+	durations *histogram
+	sizes     *histogram
+}
+
+// newMetrics returns a new metrics.
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  newCounterVec(),
+		durations: newHistogram(durationBuckets),
+		sizes:     newHistogram(sizeBuckets),
+	}
+}
+
+// started counts a started request.
+func (m *metrics) started() {
+	if m == nil {
+		return
+	}
+	m.active.Add(1)
+}
+
+// finished counts a finished request with the status code and the size
+// of the response, that took d.
+func (m *metrics) finished(status, size int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.active.Add(-1)
+	m.requests.inc(strconv.Itoa(status))
+	m.durations.observe(d.Seconds())
+	m.sizes.observe(float64(size))
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.requests.write(&b, "server_requests_total", "Number of handled requests by status code.", "code")
+	writeMetric(&b, "server_requests_active", "gauge", "Number of requests being handled.", m.active.Load())
+	m.durations.write(&b, "server_request_duration_seconds", "Duration of handled requests.")
+	m.sizes.write(&b, "server_response_size_bytes", "Size of the bodies of responses.")
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// serveMetrics serves the metrics of the server on GET /metrics on the
+// listener until it is closed.
+func (s server) serveMetrics(l net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.log.Error("Failed to serve metrics.", "error", err)
+	}
+}
+
+// writeMetric writes a metric with a single value.
+func writeMetric[T uint64 | int64](b *strings.Builder, name, typ, help string, value T) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+}
+
+// counterVec is a set of counters by label.
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// newCounterVec returns a new counterVec.
+func newCounterVec() *counterVec {
+	return &counterVec{values: make(map[string]uint64)}
+}
+
+// inc increments the counter of the label.
+func (c *counterVec) inc(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[label]++
+}
+
+// write writes the counters, sorted by label.
+func (c *counterVec) write(b *strings.Builder, name, help, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	labels := make([]string, 0, len(c.values))
+	for label := range c.values {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	for _, label := range labels {
+		fmt.Fprintf(b, "%s{%s=%q} %d\n", name, key, label, c.values[label])
+	}
+}
+
+// histogram counts observations in buckets with upper bounds.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogram returns a new histogram with the upper bounds of its
+// buckets, in increasing order.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// observe adds the value to the histogram.
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the cumulative buckets, the sum and the count of the
+// histogram.
+func (h *histogram) write(b *strings.Builder, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
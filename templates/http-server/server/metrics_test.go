@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetrics_WriteTo(t *testing.T) {
+	m := newMetrics()
+	m.started()
+	m.started()
+	m.finished(http.StatusOK, 100, 50*time.Millisecond)
+
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() = unexpected error: %v", err)
+	}
+
+	want := []string{
+		`server_requests_total{code="200"} 1`,
+		"server_requests_active 1",
+		`server_request_duration_seconds_bucket{le="0.025"} 0`,
+		`server_request_duration_seconds_bucket{le="0.05"} 1`,
+		`server_request_duration_seconds_bucket{le="+Inf"} 1`,
+		"server_request_duration_seconds_sum 0.05",
+		"server_request_duration_seconds_count 1",
+		`server_response_size_bytes_bucket{le="64"} 0`,
+		`server_response_size_bytes_bucket{le="256"} 1`,
+		"server_response_size_bytes_count 1",
+	}
+	lines := strings.Split(b.String(), "\n")
+	for _, line := range want {
+		if !slices.Contains(lines, line) {
+			t.Errorf("WriteTo() = missing %q in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *metrics
+	m.started()
+	m.finished(http.StatusOK, 1, time.Second)
+}
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := newMetrics()
+	m.started()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if diff := cmp.Diff("text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type")); diff != "" {
+		t.Errorf("ServeHTTP() = unexpected content type (-want +got):\n%s\n", diff)
+	}
+	if !slices.Contains(strings.Split(rec.Body.String(), "\n"), "server_requests_active 1") {
+		t.Errorf("ServeHTTP() = unexpected body:\n%s", rec.Body.String())
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	m := newMetrics()
+	handler := instrument(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	want := []string{
+		`server_requests_total{code="200"} 2`,
+		`server_requests_total{code="404"} 1`,
+		"server_requests_active 0",
+		"server_response_size_bytes_sum 23",
+	}
+	lines := strings.Split(b.String(), "\n")
+	for _, line := range want {
+		if !slices.Contains(lines, line) {
+			t.Errorf("instrument() = missing %q in:\n%s", line, b.String())
+		}
+	}
+}
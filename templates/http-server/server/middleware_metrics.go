@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// instrument is a middleware that counts the incoming request in the
+// metrics, with the status code, duration and size of the response.
+func instrument(m *metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.started()
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w}
+		defer func() {
+			status := lw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			m.finished(status, lw.length, time.Since(start))
+		}()
+		next.ServeHTTP(lw, r)
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeouts holds the read and write timeouts of requests that can be
+// updated while the server is running.
+type timeouts struct {
+	mu    sync.RWMutex
+	read  time.Duration
+	write time.Duration
+}
+
+// newTimeouts returns a new timeouts.
+func newTimeouts(read, write time.Duration) *timeouts {
+	return &timeouts{read: read, write: write}
+}
+
+// get returns the read and write timeouts.
+func (t *timeouts) get() (time.Duration, time.Duration) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.read, t.write
+}
+
+// set sets the read and write timeouts. Values less than or equal
+// to zero are ignored.
+func (t *timeouts) set(read, write time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if read > 0 {
+		t.read = read
+	}
+	if write > 0 {
+		t.write = write
+	}
+}
+
+// deadlines sets the read and write deadlines of every request from the
+// timeouts. The deadlines replace the ones set by http.Server from its
+// ReadTimeout and WriteTimeout, so that updated timeouts take effect
+// without a restart.
+func deadlines(t *timeouts, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		read, write := t.get()
+		now := time.Now()
+		rc := http.NewResponseController(w)
+		if read > 0 {
+			rc.SetReadDeadline(now.Add(read))
+		}
+		if write > 0 {
+			rc.SetWriteDeadline(now.Add(write))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
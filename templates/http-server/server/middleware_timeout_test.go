@@ -0,0 +1,67 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeadlines(t *testing.T) {
+	to := newTimeouts(time.Second, 10*time.Millisecond)
+	ts := httptest.NewServer(deadlines(to, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})))
+	defer ts.Close()
+
+	t.Run("write timeout exceeded", func(t *testing.T) {
+		resp, err := http.Get(ts.URL)
+		if err == nil {
+			defer resp.Body.Close()
+			if _, err := io.ReadAll(resp.Body); err == nil {
+				t.Errorf("Get() = nil; want error")
+			}
+		}
+	})
+
+	t.Run("updated write timeout", func(t *testing.T) {
+		to.set(0, time.Second)
+
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Get() = unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		got, _ := io.ReadAll(resp.Body)
+		if diff := cmp.Diff("ok", string(got)); diff != "" {
+			t.Errorf("Get() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+}
+
+func TestServer_Update(t *testing.T) {
+	level := &slog.LevelVar{}
+	srv := New(WithOptions(Options{
+		Logger:   NewLogger(WithLevel(level)),
+		LogLevel: level,
+	}))
+
+	srv.Update(Settings{
+		LogLevel:     slog.LevelDebug,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 0,
+	})
+
+	if diff := cmp.Diff(slog.LevelDebug, level.Level()); diff != "" {
+		t.Errorf("Update() = unexpected log level (-want +got):\n%s\n", diff)
+	}
+	read, write := srv.timeouts.get()
+	if diff := cmp.Diff([]time.Duration{5 * time.Second, defaultWriteTimeout}, []time.Duration{read, write}); diff != "" {
+		t.Errorf("Update() = unexpected timeouts (-want +got):\n%s\n", diff)
+	}
+}
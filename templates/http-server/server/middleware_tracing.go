@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// tracing is a middleware that starts a span for the incoming request.
+// The span continues the trace from the traceparent and tracestate headers
+// if present, and is named by the route pattern that matches the request.
+func tracing(tracer *Tracer, router *router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := extractSpanContext(r.Header)
+		route := routePattern(router, r)
+
+		ctx, span := tracer.start(r.Context(), spanName(r.Method, route), SpanKindServer, parent)
+		defer span.End()
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("server.address", r.Host)
+		span.SetAttribute("client.address", resolveIP(r))
+		if len(route) > 0 {
+			span.SetAttribute("http.route", route)
+		}
+
+		lw := &loggingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r.WithContext(ctx))
+
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(nil)
+		}
+	})
+}
+
+// routePattern returns the pattern in the router that matches the request.
+func routePattern(router *router, r *http.Request) string {
+	if router == nil {
+		return ""
+	}
+	return router.match(r)
+}
+
+// spanName returns the name of a span for the method and route pattern.
+// Patterns that already are qualified with a method are used as is.
+func spanName(method, route string) string {
+	if len(route) == 0 {
+		return method
+	}
+	if m, _, ok := strings.Cut(route, " "); ok && m == method {
+		return route
+	}
+	return method + " " + route
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTracing(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			path        string
+			traceparent string
+		}
+		want struct {
+			name    string
+			traceID string
+			parent  string
+		}
+	}{
+		{
+			name: "new trace",
+			input: struct {
+				path        string
+				traceparent string
+			}{
+				path: "/items/1",
+			},
+			want: struct {
+				name    string
+				traceID string
+				parent  string
+			}{
+				name: "GET /items/{id}",
+			},
+		},
+		{
+			name: "continue trace",
+			input: struct {
+				path        string
+				traceparent string
+			}{
+				path:        "/items/1",
+				traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			want: struct {
+				name    string
+				traceID string
+				parent  string
+			}{
+				name:    "GET /items/{id}",
+				traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				parent:  "00f067aa0ba902b7",
+			},
+		},
+		{
+			name: "route without method",
+			input: struct {
+				path        string
+				traceparent string
+			}{
+				path: "/health",
+			},
+			want: struct {
+				name    string
+				traceID string
+				parent  string
+			}{
+				name: "GET /health",
+			},
+		},
+		{
+			name: "no route",
+			input: struct {
+				path        string
+				traceparent string
+			}{
+				path: "/unknown",
+			},
+			want: struct {
+				name    string
+				traceID string
+				parent  string
+			}{
+				name: "GET",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracer := NewTracer(TracerOptions{})
+			router := NewRouter()
+
+			router.Handle("GET /items/{id}", http.NotFoundHandler())
+			router.Handle("/health", http.NotFoundHandler())
+
+			var span *Span
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				span = SpanFromContext(r.Context())
+				router.ServeHTTP(w, r)
+			})
+
+			req := httptest.NewRequest("GET", test.input.path, nil)
+			if len(test.input.traceparent) > 0 {
+				req.Header.Set("traceparent", test.input.traceparent)
+			}
+			tracing(tracer, router, handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			if span == nil {
+				t.Fatalf("tracing() = span not found in context")
+			}
+			if diff := cmp.Diff(test.want.name, span.name); diff != "" {
+				t.Errorf("tracing() = unexpected name (-want +got):\n%s\n", diff)
+			}
+			if len(test.want.traceID) > 0 && test.want.traceID != span.SpanContext().TraceID.String() {
+				t.Errorf("tracing() = unexpected trace ID, want: %s, got: %s", test.want.traceID, span.SpanContext().TraceID)
+			}
+			if len(test.want.parent) > 0 && test.want.parent != span.parent.String() {
+				t.Errorf("tracing() = unexpected parent, want: %s, got: %s", test.want.parent, span.parent)
+			}
+		})
+	}
+}
+
+func TestTracing_Logs(t *testing.T) {
+	t.Run("trace and span IDs in logs", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		log := NewLogger(WithOutput(buf))
+		tracer := NewTracer(TracerOptions{})
+
+		var span *Span
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span = SpanFromContext(r.Context())
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		tracing(tracer, nil, requestLogger(log, handler)).ServeHTTP(httptest.NewRecorder(), req)
+
+		var got struct {
+			TraceID string `json:"traceId"`
+			SpanID  string `json:"spanId"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("unexpected error decoding log: %v", err)
+		}
+		if got.TraceID != span.SpanContext().TraceID.String() || got.SpanID != span.SpanContext().SpanID.String() {
+			t.Errorf("tracing() = unexpected IDs in log, want: %s %s, got: %s %s", span.SpanContext().TraceID, span.SpanContext().SpanID, got.TraceID, got.SpanID)
+		}
+	})
+
+	t.Run("request log of server", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		router := NewRouter()
+		router.Handle("GET /items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv := New(WithOptions(Options{
+			Router: router,
+			Logger: NewLogger(WithOutput(buf)),
+			Tracer: NewTracer(TracerOptions{}),
+		}))
+
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		srv.httpServer.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		var got struct {
+			Msg     string `json:"msg"`
+			TraceID string `json:"traceId"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("unexpected error decoding log: %v", err)
+		}
+		if got.Msg != "Request received." || got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("New() = unexpected request log, want trace ID 4bf92f3577b34da6a3ce929d0e0e4736, got: %s", buf.String())
+		}
+	})
+
+	t.Run("no span", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		log := NewLogger(WithOutput(buf))
+		log.InfoContext(context.Background(), "test")
+
+		if bytes.Contains(buf.Bytes(), []byte("traceId")) {
+			t.Errorf("InfoContext() = unexpected traceId in log: %s", buf.String())
+		}
+	})
+}
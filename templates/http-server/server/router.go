@@ -1,41 +1,371 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"unicode"
 )
 
+var (
+	// ErrInvalidPattern is returned when a pattern cannot be parsed.
+	ErrInvalidPattern = errors.New("invalid pattern")
+	// ErrPatternConflict is returned when a pattern is already registered,
+	// or conflicts with a registered pattern.
+	ErrPatternConflict = errors.New("pattern conflict")
+)
+
+// SlashPolicy is the policy of a router for the trailing slashes of
+// paths.
+type SlashPolicy int
+
+const (
+	// SlashBoth serves patterns both with and without a trailing slash. A
+	// pattern without a trailing slash is also served as a subtree, so that
+	// sub routers can be added once for both.
+	SlashBoth SlashPolicy = iota
+	// SlashRedirect redirects requests with the other form of the trailing
+	// slash to the path of the pattern, with http.StatusPermanentRedirect.
+	SlashRedirect
+	// SlashStrict serves patterns only as they are registered, without the
+	// redirect of http.ServeMux from a path without a trailing slash to
+	// the pattern with it.
+	SlashStrict
+)
+
+// RouterOption is a function that configures the router.
+type RouterOption func(*router)
+
 // NewRouter creates a new router.
-func NewRouter() *router {
-	return &router{
+func NewRouter(options ...RouterOption) *router {
+	r := &router{
 		ServeMux: http.NewServeMux(),
+		routes:   make(map[string]*route),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// WithSlashPolicy configures the policy of the router for trailing
+// slashes. Defaults to SlashBoth.
+func WithSlashPolicy(policy SlashPolicy) RouterOption {
+	return func(r *router) {
+		r.policy = policy
 	}
 }
 
 // router is a custom router that implements the http.Handler interface.
 type router struct {
 	*http.ServeMux
+	mu       sync.RWMutex
+	policy   SlashPolicy
+	routes   map[string]*route
+	patterns []string
 }
 
 // ServeHTTP wraps the http.ServeMux ServeHTTP method.
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.ServeMux.ServeHTTP(w, req)
+	r.mux().ServeHTTP(w, req)
+}
+
+// match returns the pattern that matches the request.
+func (r *router) match(req *http.Request) string {
+	_, pattern := r.mux().Handler(req)
+	return pattern
+}
+
+// mux returns the ServeMux of the router, which is replaced when it is
+// rebuilt.
+func (r *router) mux() *http.ServeMux {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ServeMux
+}
+
+// Handle registers the handler for the pattern, in the syntax of
+// http.ServeMux with an optional method and host, and for the other form
+// of its trailing slash according to the SlashPolicy of the router. It
+// returns ErrInvalidPattern if the pattern cannot be parsed, and
+// ErrPatternConflict if it is already registered or conflicts with an
+// explicitly registered pattern. A pattern that was only registered as
+// the other form of another pattern can be registered with its own
+// handler, and other forms never cause a pattern to be rejected.
+func (r *router) Handle(pattern string, handler http.Handler) error {
+	if handler == nil {
+		return fmt.Errorf("%w: nil handler for %q", ErrInvalidPattern, pattern)
+	}
+	p, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routes == nil {
+		r.routes = make(map[string]*route)
+	}
+	if err := r.register(p.String(), handler, true); err != nil {
+		return err
+	}
+	if path, handler, ok := p.variant(r.policy, handler); ok {
+		// The other form is skipped if it conflicts with a registered
+		// pattern, since that pattern serves it.
+		r.register(p.withPath(path), handler, false)
+	}
+	return nil
+}
+
+// HandleFunc registers the handler function for the pattern, as Handle.
+func (r *router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) error {
+	if handler == nil {
+		return fmt.Errorf("%w: nil handler for %q", ErrInvalidPattern, pattern)
+	}
+	return r.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// register the handler for the pattern in the ServeMux. A pattern that
+// was registered implicitly, as the other form of another pattern, has
+// its handler replaced when it is registered explicitly. If an explicit
+// pattern conflicts with the ServeMux, it is rebuilt.
+func (r *router) register(pattern string, handler http.Handler, explicit bool) error {
+	if rt, ok := r.routes[pattern]; ok {
+		if !explicit {
+			return nil
+		}
+		if rt.explicit {
+			return fmt.Errorf("%w: %q is already registered", ErrPatternConflict, pattern)
+		}
+		rt.set(handler)
+		return nil
+	}
+
+	rt := &route{handler: handler, explicit: explicit}
+	err := handle(r.ServeMux, pattern, rt)
+	if explicit && errors.Is(err, ErrPatternConflict) {
+		err = r.rebuild(pattern, rt)
+	}
+	if err != nil {
+		return err
+	}
+	r.routes[pattern] = rt
+	r.patterns = append(r.patterns, pattern)
+	return nil
+}
+
+// rebuild the ServeMux with the explicitly registered patterns and the
+// pattern, followed by the implicitly registered patterns that do not
+// conflict with them, since patterns cannot be removed from a ServeMux.
+// The ServeMux is kept if the pattern conflicts with an explicitly
+// registered pattern.
+func (r *router) rebuild(pattern string, rt *route) error {
+	mux := http.NewServeMux()
+	for _, p := range r.patterns {
+		if r.routes[p].explicit {
+			// The explicit patterns have been registered together before.
+			handle(mux, p, r.routes[p])
+		}
+	}
+	if err := handle(mux, pattern, rt); err != nil {
+		return err
+	}
+
+	patterns := make([]string, 0, len(r.patterns)+1)
+	for _, p := range r.patterns {
+		if !r.routes[p].explicit {
+			if err := handle(mux, p, r.routes[p]); err != nil {
+				delete(r.routes, p)
+				continue
+			}
+		}
+		patterns = append(patterns, p)
+	}
+	r.ServeMux, r.patterns = mux, patterns
+	return nil
+}
+
+// handle registers the handler for the pattern in the ServeMux, and
+// returns its panic as an error. The pattern has been checked by
+// parsePattern, so the panic is from a conflicting pattern.
+func handle(mux *http.ServeMux, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPatternConflict, r)
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+// route is the handler of a pattern in the ServeMux. Its handler can be
+// replaced, since patterns cannot be removed from a ServeMux.
+type route struct {
+	mu       sync.RWMutex
+	handler  http.Handler
+	explicit bool
+}
+
+// set the handler of an explicitly registered pattern.
+func (rt *route) set(handler http.Handler) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.handler = handler
+	rt.explicit = true
+}
+
+// ServeHTTP calls the handler of the route.
+func (rt *route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mu.RLock()
+	handler := rt.handler
+	rt.mu.RUnlock()
+	handler.ServeHTTP(w, r)
+}
+
+// pattern is a pattern of http.ServeMux, "[METHOD ][HOST]/[PATH]".
+type pattern struct {
+	method string
+	host   string
+	path   string
+}
+
+// parsePattern parses the method, host and path of a pattern, and checks
+// them with the rules of http.ServeMux.
+func parsePattern(s string) (pattern, error) {
+	s = strings.TrimSpace(s)
+	var p pattern
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		p.method, s = s[:i], strings.TrimLeft(s[i:], " \t")
+	}
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return pattern{}, fmt.Errorf("%w: %q has no path", ErrInvalidPattern, s)
+	}
+	p.host, p.path = s[:i], s[i:]
+	if err := p.validate(); err != nil {
+		return pattern{}, fmt.Errorf("%w: %q %v", ErrInvalidPattern, p, err)
+	}
+	return p, nil
+}
+
+// validate checks the method, host and wildcards of the pattern.
+func (p pattern) validate() error {
+	if strings.IndexFunc(p.method, isNotToken) >= 0 {
+		return errors.New("has an invalid method")
+	}
+	if strings.Contains(p.host, "{") {
+		return errors.New("has a wildcard in the host")
+	}
+
+	names := make(map[string]bool)
+	segments := strings.Split(p.path[1:], "/")
+	for i, segment := range segments {
+		if !strings.Contains(segment, "{") {
+			continue
+		}
+		if segment[0] != '{' || segment[len(segment)-1] != '}' {
+			return fmt.Errorf("has a wildcard %q that is not a whole segment", segment)
+		}
+		name, last := segment[1:len(segment)-1], i == len(segments)-1
+		if name == "$" {
+			if !last {
+				return errors.New("has {$} before the end")
+			}
+			continue
+		}
+		name, rest := strings.CutSuffix(name, "...")
+		if rest && !last {
+			return fmt.Errorf("has a wildcard %q before the end", segment)
+		}
+		if !isWildcardName(name) {
+			return fmt.Errorf("has a wildcard %q with an invalid name", segment)
+		}
+		if names[name] {
+			return fmt.Errorf("has a duplicate wildcard %q", name)
+		}
+		names[name] = true
+	}
+	return nil
 }
 
-// Handle wraps the http.ServeMux Handle method that adds handlers for patterns with
-// and without trailing slashes. This to support adding sub routers (handlers) once for
-// both patterns.
-func (r *router) Handle(pattern string, handler http.Handler) {
-	r.ServeMux.Handle(pattern, handler)
-	if pattern == "/{$}" {
-		return
+// isNotToken reports whether r is not a character of an HTTP token.
+func isNotToken(r rune) bool {
+	return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r))
+}
+
+// isWildcardName reports whether s is a valid name of a wildcard, a Go
+// identifier.
+func isWildcardName(s string) bool {
+	if len(s) == 0 {
+		return false
 	}
-	if strings.HasSuffix(pattern, "/") {
-		trimmedPattern := strings.TrimSuffix(pattern, "/")
-		if len(trimmedPattern) > 0 {
-			r.ServeMux.Handle(trimmedPattern, handler)
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
 		}
-	} else {
-		r.ServeMux.Handle(pattern+"/", handler)
 	}
+	return true
+}
+
+// String returns the pattern.
+func (p pattern) String() string {
+	return p.withPath(p.path)
+}
+
+// withPath returns the pattern with the method and host of p and the
+// path.
+func (p pattern) withPath(path string) string {
+	if len(p.method) > 0 {
+		return p.method + " " + p.host + path
+	}
+	return p.host + path
+}
+
+// variant returns the path of the other form of the trailing slash of
+// the pattern and its handler for the policy, and false if it has none.
+// The root path and paths that end with a wildcard that matches the
+// rest of the path have none.
+func (p pattern) variant(policy SlashPolicy, handler http.Handler) (string, http.Handler, bool) {
+	switch {
+	case p.path == "/" || p.path == "/{$}" || strings.HasSuffix(p.path, "...}"):
+		return "", nil, false
+	case strings.HasSuffix(p.path, "/{$}"), strings.HasSuffix(p.path, "/"):
+		// A path with a trailing slash, that http.ServeMux redirects to
+		// from the path without it.
+		path := strings.TrimSuffix(strings.TrimSuffix(p.path, "{$}"), "/")
+		switch policy {
+		case SlashBoth:
+			return path, handler, true
+		case SlashRedirect:
+			return path, redirectSlash(true), true
+		case SlashStrict:
+			return path, http.NotFoundHandler(), true
+		}
+	default:
+		switch policy {
+		case SlashBoth:
+			return p.path + "/", handler, true
+		case SlashRedirect:
+			return p.path + "/{$}", redirectSlash(false), true
+		}
+	}
+	return "", nil, false
+}
+
+// redirectSlash returns a handler that redirects to the path of the
+// request with a trailing slash added, or removed. The method and body
+// of the request are kept with http.StatusPermanentRedirect.
+func redirectSlash(add bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		if add {
+			u.Path += "/"
+		} else {
+			u.Path = strings.TrimSuffix(u.Path, "/")
+		}
+		u.RawPath = ""
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+	})
 }
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRouter_Handle(t *testing.T) {
+	type response struct {
+		Status   int
+		Body     string
+		Location string
+	}
+
+	var tests = []struct {
+		name     string
+		policy   SlashPolicy
+		patterns []string
+		requests []string
+		want     []response
+	}{
+		{
+			name:     "both",
+			policy:   SlashBoth,
+			patterns: []string{"/a", "/b/", "GET /items/{id}", "/c/{$}"},
+			requests: []string{"GET /a", "GET /a/", "GET /a/x", "GET /b", "GET /b/", "GET /items/1/", "POST /items/1", "GET /c", "GET /c/x"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "/b/"},
+				{Status: http.StatusOK, Body: "/b/"},
+				{Status: http.StatusOK, Body: "GET /items/{id}"},
+				{Status: http.StatusMethodNotAllowed},
+				{Status: http.StatusOK, Body: "/c/{$}"},
+				{Status: http.StatusNotFound},
+			},
+		},
+		{
+			name:     "both with separate patterns",
+			policy:   SlashBoth,
+			patterns: []string{"/a", "/a/"},
+			requests: []string{"GET /a", "GET /a/", "GET /a/x"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "/a/"},
+				{Status: http.StatusOK, Body: "/a/"},
+			},
+		},
+		{
+			name:     "redirect",
+			policy:   SlashRedirect,
+			patterns: []string{"/a", "POST /b/{$}", "example.com/c", "/d/"},
+			requests: []string{"GET /a/?q=1", "GET /a/x", "POST /b", "GET http://example.com/c/", "GET /d"},
+			want: []response{
+				{Status: http.StatusPermanentRedirect, Location: "/a?q=1"},
+				{Status: http.StatusNotFound},
+				{Status: http.StatusPermanentRedirect, Location: "/b/"},
+				{Status: http.StatusPermanentRedirect, Location: "http://example.com/c"},
+				{Status: http.StatusPermanentRedirect, Location: "/d/"},
+			},
+		},
+		{
+			name:     "strict",
+			policy:   SlashStrict,
+			patterns: []string{"/a", "/b/", "/c/{$}"},
+			requests: []string{"GET /a", "GET /a/", "GET /b", "GET /b/x", "GET /c"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusNotFound},
+				{Status: http.StatusNotFound},
+				{Status: http.StatusOK, Body: "/b/"},
+				{Status: http.StatusNotFound},
+			},
+		},
+		{
+			name:     "strict with separate patterns",
+			policy:   SlashStrict,
+			patterns: []string{"/b/", "/b"},
+			requests: []string{"GET /b", "GET /b/"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/b"},
+				{Status: http.StatusOK, Body: "/b/"},
+			},
+		},
+		{
+			name:     "both with other form conflict",
+			policy:   SlashBoth,
+			patterns: []string{"/a", "GET /{x}/"},
+			requests: []string{"GET /a", "GET /a/", "GET /b/"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+			},
+		},
+		{
+			name:     "both with other form conflict in reverse order",
+			policy:   SlashBoth,
+			patterns: []string{"GET /{x}/", "/a"},
+			requests: []string{"GET /a", "GET /a/", "GET /b/"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+			},
+		},
+		{
+			name:     "redirect with other form conflict",
+			policy:   SlashRedirect,
+			patterns: []string{"/a", "GET /{x}/"},
+			requests: []string{"GET /a", "GET /a/", "GET /a/?q=1", "GET /b/"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+			},
+		},
+		{
+			name:     "redirect with other form conflict in reverse order",
+			policy:   SlashRedirect,
+			patterns: []string{"GET /{x}/", "/a"},
+			requests: []string{"GET /a", "GET /a/", "GET /a/?q=1", "GET /b/"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/a"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+				{Status: http.StatusOK, Body: "GET /{x}/"},
+			},
+		},
+		{
+			name:     "strict with other form conflict",
+			policy:   SlashStrict,
+			patterns: []string{"/a/", "GET /{x}"},
+			requests: []string{"GET /a", "GET /a/", "GET /b"},
+			want: []response{
+				{Status: http.StatusOK, Body: "GET /{x}"},
+				{Status: http.StatusOK, Body: "/a/"},
+				{Status: http.StatusOK, Body: "GET /{x}"},
+			},
+		},
+		{
+			name:     "strict with other form conflict in reverse order",
+			policy:   SlashStrict,
+			patterns: []string{"GET /{x}", "/a/"},
+			requests: []string{"GET /a", "GET /a/", "GET /b"},
+			want: []response{
+				{Status: http.StatusOK, Body: "GET /{x}"},
+				{Status: http.StatusOK, Body: "/a/"},
+				{Status: http.StatusOK, Body: "GET /{x}"},
+			},
+		},
+		{
+			name:     "root and rest wildcard",
+			policy:   SlashBoth,
+			patterns: []string{"/{$}", "/files/{path...}"},
+			requests: []string{"GET /", "GET /x", "GET /files/a/b"},
+			want: []response{
+				{Status: http.StatusOK, Body: "/{$}"},
+				{Status: http.StatusNotFound},
+				{Status: http.StatusOK, Body: "/files/{path...}"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := NewRouter(WithSlashPolicy(test.policy))
+			for _, pattern := range test.patterns {
+				if err := router.Handle(pattern, echoPattern(pattern)); err != nil {
+					t.Fatalf("Handle(%q) = unexpected error: %v", pattern, err)
+				}
+			}
+
+			var got []response
+			for _, request := range test.requests {
+				method, target, _ := strings.Cut(request, " ")
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+				resp := response{Status: rec.Code, Location: rec.Header().Get("Location")}
+				if rec.Code == http.StatusOK {
+					b, _ := io.ReadAll(rec.Body)
+					resp.Body = string(b)
+				}
+				got = append(got, resp)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Handle() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestRouter_Handle_Errors(t *testing.T) {
+	var tests = []struct {
+		name     string
+		patterns []string
+		want     error
+	}{
+		{
+			name:     "duplicate pattern",
+			patterns: []string{"/a", "/a"},
+			want:     ErrPatternConflict,
+		},
+		{
+			name:     "conflicting pattern",
+			patterns: []string{"/items/{id}", "/items/{name}"},
+			want:     ErrPatternConflict,
+		},
+		{
+			name:     "conflicting pattern with other forms",
+			patterns: []string{"/a", "GET /{x}/", "GET /{y}/"},
+			want:     ErrPatternConflict,
+		},
+		{
+			name:     "no path",
+			patterns: []string{"GET"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "invalid wildcard",
+			patterns: []string{"/items/{id"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "invalid method",
+			patterns: []string{"GE(T /a"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "wildcard in host",
+			patterns: []string{"{host}/a"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "wildcard not a whole segment",
+			patterns: []string{"/items/id{id}"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "invalid wildcard name",
+			patterns: []string{"/items/{1d}"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "rest wildcard before the end",
+			patterns: []string{"/items/{rest...}/a"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "end of path before the end",
+			patterns: []string{"/{$}/a"},
+			want:     ErrInvalidPattern,
+		},
+		{
+			name:     "duplicate wildcard",
+			patterns: []string{"/{id}/{id}"},
+			want:     ErrInvalidPattern,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := NewRouter()
+			var err error
+			for _, pattern := range test.patterns {
+				if err = router.Handle(pattern, echoPattern(pattern)); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, test.want) {
+				t.Errorf("Handle() = unexpected error, want: %v, got: %v", test.want, err)
+			}
+		})
+	}
+}
+
+func echoPattern(pattern string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, pattern)
+	})
+}
@@ -1,3 +1,16 @@
 package server
 
-func (s server) routes() {}
+import "errors"
+
+// routes registers the handlers of the server in the router. All errors
+// are returned together.
+func (s server) routes() error {
+	errs := []error{
+		s.router.Handle("GET /health", s.health()),
+		s.router.Handle("GET /version", s.version()),
+	}
+	if s.logBuffer != nil {
+		errs = append(errs, s.router.Handle("GET /admin/logs", s.logs()))
+	}
+	return errors.Join(errs...)
+}
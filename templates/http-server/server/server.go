@@ -3,12 +3,16 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"syscall"
 	"time"
+
+	"github.com/RedeployAB/go-template/templates/http-server/version"
 )
 
 // Defaults for server configuration.
@@ -22,15 +26,26 @@ const (
 
 // server holds an http.Server, a router and it's configured options.
 type server struct {
-	httpServer *http.Server
-	router     *router
-	tls        TLSConfig
-	log        logger
-	stopCh     chan os.Signal
-	errCh      chan error
+	httpServer     *http.Server
+	router         *router
+	tls            TLSConfig
+	proxy          ProxyOptions
+	log            logger
+	level          *slog.LevelVar
+	logBuffer      *LogBuffer
+	tracer         *Tracer
+	timeouts       *timeouts
+	metrics        *metrics
+	metricsAddress string
+	shutdownCh     chan struct{}
+	stopCh         chan os.Signal
+	errCh          chan error
 }
 
 // TLSConfig holds the configuration for the server's TLS settings.
+// Certificate and Key are either paths to PEM encoded files, or PEM
+// encoded data. Certificates loaded from files are reloaded when the
+// files change.
 type TLSConfig struct {
 	Certificate string
 	Key         string
@@ -43,14 +58,27 @@ func (c TLSConfig) isEmpty() bool {
 
 // Options holds the configuration for the server.
 type Options struct {
-	Router       *router
-	TLSConfig    TLSConfig
-	Logger       logger
-	Host         string
-	Port         int
+	Router         *router
+	TLSConfig      TLSConfig
+	Proxy          ProxyOptions
+	Logger         logger
+	LogLevel       *slog.LevelVar
+	LogBuffer      *LogBuffer
+	Tracer         *Tracer
+	MetricsAddress string
+	Host           string
+	Port           int
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+}
+
+// Settings holds the settings of the server that can be updated
+// while it is running.
+type Settings struct {
+	LogLevel     slog.Level
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
 }
 
 // Option is a function that configures the server.
@@ -64,12 +92,19 @@ func New(options ...Option) *server {
 			WriteTimeout: defaultWriteTimeout,
 			IdleTimeout:  defaultIdleTimeout,
 		},
-		stopCh: make(chan os.Signal),
-		errCh:  make(chan error),
+		metrics:    newMetrics(),
+		shutdownCh: make(chan struct{}),
+		stopCh:     make(chan os.Signal),
+		errCh:      make(chan error),
 	}
 	for _, option := range options {
 		option(s)
 	}
+	// Handlers that do not return by themselves, such as streams of
+	// server-sent events, end when the server is shut down.
+	s.httpServer.RegisterOnShutdown(func() {
+		close(s.shutdownCh)
+	})
 
 	if s.router == nil {
 		s.router = NewRouter()
@@ -83,13 +118,37 @@ func New(options ...Option) *server {
 	if s.httpServer.Handler == nil {
 		s.httpServer.Handler = s.router
 	}
+	// The request logger and the metrics are wrapped by the tracing, so
+	// that the requests are logged with their trace and span IDs.
+	s.httpServer.Handler = instrument(s.metrics, requestLogger(s.log, s.httpServer.Handler))
+	if s.tracer != nil {
+		s.httpServer.Handler = tracing(s.tracer, s.router, s.httpServer.Handler)
+	}
+	s.timeouts = newTimeouts(s.httpServer.ReadTimeout, s.httpServer.WriteTimeout)
 
 	return s
 }
 
-// Start the server.
+// Start the server. An error is returned if the routes cannot be
+// registered. The metrics are served on the metrics address if it is
+// configured. The logger is closed when the server stops, if it can be
+// closed.
 func (s server) Start() error {
-	s.routes()
+	defer closeLogger(s.log)
+	if err := s.routes(); err != nil {
+		return err
+	}
+	if len(s.metricsAddress) > 0 {
+		l, err := net.Listen("tcp", s.metricsAddress)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go s.serveMetrics(l)
+	}
+	if s.timeouts != nil {
+		s.httpServer.Handler = deadlines(s.timeouts, s.httpServer.Handler)
+	}
 
 	go func() {
 		if err := s.listenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -101,7 +160,7 @@ func (s server) Start() error {
 		s.stop()
 	}()
 
-	s.log.Info("Server started.", "address", s.httpServer.Addr)
+	s.log.Info("Server started.", "address", s.httpServer.Addr, "version", version.Get().Version)
 	for {
 		select {
 		case err := <-s.errCh:
@@ -115,14 +174,47 @@ func (s server) Start() error {
 	}
 }
 
-// listenAndServe wraps around http.Server ListenAndServe and
-// ListenAndServeTLS depending on TLS configuration.
+// Update the settings of the running server. The log level is only
+// updated if the server is configured with a LogLevel. Timeouts less
+// than or equal to zero are ignored.
+func (s server) Update(settings Settings) {
+	if s.level != nil {
+		s.level.Set(settings.LogLevel)
+	}
+	if s.timeouts != nil {
+		s.timeouts.set(settings.ReadTimeout, settings.WriteTimeout)
+	}
+}
+
+// listenAndServe listens on the address of the http.Server, with the
+// PROXY protocol if it is configured, and serves with or without TLS
+// depending on TLS configuration.
 func (s *server) listenAndServe() error {
+	l, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	if !s.proxy.isEmpty() {
+		pl, err := newProxyListener(l, s.proxy)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		l = pl
+		s.httpServer.ConnContext = proxyConnContext
+	}
+
 	if !s.tls.isEmpty() {
+		cert, err := newCertificate(s.tls, s.log)
+		if err != nil {
+			l.Close()
+			return err
+		}
 		s.httpServer.TLSConfig = newTLSConfig()
-		return s.httpServer.ListenAndServeTLS(s.tls.Certificate, s.tls.Key)
+		s.httpServer.TLSConfig.GetCertificate = cert.GetCertificate
+		return s.httpServer.ServeTLS(l, "", "")
 	}
-	return s.httpServer.ListenAndServe()
+	return s.httpServer.Serve(l)
 }
 
 // stop the server.
@@ -138,6 +230,11 @@ func (s server) stop() {
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		s.errCh <- err
 	}
+	if s.tracer != nil {
+		if err := s.tracer.Shutdown(ctx); err != nil {
+			s.log.Error("Could not export spans.", "error", err)
+		}
+	}
 
 	s.stopCh <- sig
 }
@@ -152,9 +249,24 @@ func WithOptions(options Options) Option {
 		if !options.TLSConfig.isEmpty() {
 			s.tls = options.TLSConfig
 		}
+		if !options.Proxy.isEmpty() {
+			s.proxy = options.Proxy
+		}
 		if options.Logger != nil {
 			s.log = options.Logger
 		}
+		if options.LogLevel != nil {
+			s.level = options.LogLevel
+		}
+		if options.LogBuffer != nil {
+			s.logBuffer = options.LogBuffer
+		}
+		if options.Tracer != nil {
+			s.tracer = options.Tracer
+		}
+		if len(options.MetricsAddress) > 0 {
+			s.metricsAddress = options.MetricsAddress
+		}
 		if len(options.Host) > 0 || options.Port > 0 {
 			s.httpServer.Addr = options.Host + ":" + strconv.Itoa(options.Port)
 		}
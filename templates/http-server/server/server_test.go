@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/RedeployAB/go-template/templates/http-server/version"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
@@ -32,8 +33,9 @@ func TestNew(t *testing.T) {
 					WriteTimeout: defaultWriteTimeout,
 					IdleTimeout:  defaultIdleTimeout,
 				},
-				router: &router{ServeMux: http.NewServeMux()},
-				log:    NewLogger(),
+				router:   &router{ServeMux: http.NewServeMux()},
+				log:      NewLogger(),
+				timeouts: newTimeouts(defaultReadTimeout, defaultWriteTimeout),
 			},
 		},
 		{
@@ -47,6 +49,7 @@ func TestNew(t *testing.T) {
 					ReadTimeout:  10 * time.Second,
 					WriteTimeout: 10 * time.Second,
 					IdleTimeout:  15 * time.Second,
+					Proxy:        ProxyOptions{Trusted: []string{"10.0.0.0/8"}},
 				}),
 			},
 			want: &server{
@@ -57,8 +60,10 @@ func TestNew(t *testing.T) {
 					WriteTimeout: 10 * time.Second,
 					IdleTimeout:  15 * time.Second,
 				},
-				router: &router{ServeMux: http.NewServeMux()},
-				log:    NewLogger(),
+				router:   &router{ServeMux: http.NewServeMux()},
+				proxy:    ProxyOptions{Trusted: []string{"10.0.0.0/8"}},
+				log:      NewLogger(),
+				timeouts: newTimeouts(10*time.Second, 10*time.Second),
 			},
 		},
 	}
@@ -70,7 +75,7 @@ func TestNew(t *testing.T) {
 				t.Errorf("New(%v) = nil; want %v", test.input, test.want)
 			}
 
-			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(server{}), cmpopts.IgnoreUnexported(http.Server{}, http.ServeMux{}, slog.Logger{}), cmpopts.IgnoreFields(server{}, "stopCh", "errCh")); diff != "" {
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(server{}, timeouts{}), cmpopts.IgnoreUnexported(http.Server{}, http.ServeMux{}, router{}, slog.Logger{}), cmpopts.IgnoreFields(http.Server{}, "Handler"), cmpopts.IgnoreFields(server{}, "metrics", "shutdownCh", "stopCh", "errCh"), cmpopts.IgnoreFields(timeouts{}, "mu")); diff != "" {
 				t.Errorf("New(%v) = unexpected result (-want +got):\n%s\n", test.input, diff)
 			}
 		})
@@ -84,6 +89,7 @@ func TestServer_Start(t *testing.T) {
 			httpServer: &http.Server{
 				Addr: "localhost:8080",
 			},
+			router: NewRouter(),
 			log: &mockLogger{
 				logs: &logs,
 			},
@@ -100,6 +106,8 @@ func TestServer_Start(t *testing.T) {
 			"Server started.",
 			"address",
 			"localhost:8080",
+			"version",
+			version.Get().Version,
 			"Server stopped.",
 			"reason",
 			"interrupt",
@@ -118,6 +126,7 @@ func TestServer_Start_Error(t *testing.T) {
 			httpServer: &http.Server{
 				Addr: "localhost:8080",
 			},
+			router: NewRouter(),
 			log: &mockLogger{
 				logs: &logs,
 			},
@@ -183,3 +192,11 @@ func (l *mockLogger) Error(msg string, args ...any) {
 	}
 	*l.logs = append(*l.logs, messages...)
 }
+
+func (l *mockLogger) InfoContext(ctx context.Context, msg string, args ...any) {
+	l.Info(msg, args...)
+}
+
+func (l *mockLogger) ErrorContext(ctx context.Context, msg string, args ...any) {
+	l.Error(msg, args...)
+}
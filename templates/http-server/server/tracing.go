@@ -0,0 +1,479 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header names for W3C Trace Context.
+const (
+	headerTraceparent = "traceparent"
+	headerTracestate  = "tracestate"
+)
+
+// Defaults for the tracer.
+const (
+	defaultTracerServiceName   = "http-server"
+	defaultTracerBatchSize     = 512
+	defaultTracerFlushInterval = 5 * time.Second
+	defaultTracerTimeout       = 10 * time.Second
+)
+
+// tracerErrorInterval is the minimum interval between logs of failed
+// exports.
+const tracerErrorInterval = time.Minute
+
+// flagSampled is the trace flag for a sampled trace.
+const flagSampled byte = 0x01
+
+// TraceID is the ID of a trace.
+type TraceID [16]byte
+
+// String returns the hex encoded TraceID.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// isValid returns true if the TraceID is not all zeros.
+func (id TraceID) isValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID is the ID of a span.
+type SpanID [8]byte
+
+// String returns the hex encoded SpanID.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// isValid returns true if the SpanID is not all zeros.
+func (id SpanID) isValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext holds the parts of a span that are propagated
+// between services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	TraceFlags byte
+	TraceState string
+}
+
+// IsValid returns true if both TraceID and SpanID are valid.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.isValid() && c.SpanID.isValid()
+}
+
+// IsSampled returns true if the sampled flag is set.
+func (c SpanContext) IsSampled() bool {
+	return c.TraceFlags&flagSampled == flagSampled
+}
+
+// traceparent returns the SpanContext formatted as a traceparent header value.
+func (c SpanContext) traceparent() string {
+	return "00-" + c.TraceID.String() + "-" + c.SpanID.String() + "-" + hex.EncodeToString([]byte{c.TraceFlags})
+}
+
+// errInvalidTraceparent is returned when a traceparent header is invalid.
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// parseTraceparent parses a traceparent header value according to
+// W3C Trace Context.
+func parseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	// Version 00 has exactly four parts. Later versions may append fields.
+	if version[0] == 0 && len(parts) != 4 {
+		return SpanContext{}, errInvalidTraceparent
+	}
+
+	var sc SpanContext
+	if len(parts[1]) != 32 || !isLowerHex(parts[1]) {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	if len(parts[2]) != 16 || !isLowerHex(parts[2]) {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	if len(parts[3]) != 2 || !isLowerHex(parts[3]) {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	sc.TraceFlags = flags[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// isLowerHex returns true if s only contains lower case hex characters.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// extractSpanContext extracts a SpanContext from the traceparent and
+// tracestate headers.
+func extractSpanContext(header http.Header) (SpanContext, bool) {
+	sc, err := parseTraceparent(strings.TrimSpace(header.Get(headerTraceparent)))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = strings.Join(header.Values(headerTracestate), ",")
+	return sc, true
+}
+
+// injectSpanContext sets the traceparent and tracestate headers from
+// the SpanContext.
+func injectSpanContext(header http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(headerTraceparent, sc.traceparent())
+	if len(sc.TraceState) > 0 {
+		header.Set(headerTracestate, sc.TraceState)
+	} else {
+		header.Del(headerTracestate)
+	}
+}
+
+// SpanKind is the kind of a span.
+type SpanKind int
+
+// Span kinds, with values according to OpenTelemetry.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// spanStatusCode is the status code of a span.
+type spanStatusCode int
+
+// Span status codes, with values according to OpenTelemetry.
+const (
+	spanStatusUnset spanStatusCode = 0
+	spanStatusOK    spanStatusCode = 1
+	spanStatusError spanStatusCode = 2
+)
+
+// spanAttribute is a key value pair set on a span.
+type spanAttribute struct {
+	key   string
+	value any
+}
+
+// Span represents a single operation within a trace.
+type Span struct {
+	tracer     *Tracer
+	name       string
+	kind       SpanKind
+	context    SpanContext
+	parent     SpanID
+	start      time.Time
+	end        time.Time
+	mu         sync.Mutex
+	attributes []spanAttribute
+	status     spanStatusCode
+	message    string
+	ended      bool
+}
+
+// SpanContext returns the SpanContext of the span.
+func (s *Span) SpanContext() SpanContext {
+	return s.context
+}
+
+// SetName sets the name of the span.
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttribute sets an attribute on the span. Supported values are
+// strings, booleans, integers and floats. Other values are formatted
+// as strings when exported.
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, spanAttribute{key: key, value: value})
+}
+
+// SetError sets the status of the span to error with the error
+// as message.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = spanStatusError
+	if err != nil {
+		s.message = err.Error()
+	}
+}
+
+// End ends the span and queues it for export if it is sampled.
+// Calls after the first have no effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = s.tracer.now()
+	s.mu.Unlock()
+
+	if s.context.IsSampled() {
+		s.tracer.queue(s)
+	}
+}
+
+// spanContextKey is the key for the span in a context.
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx with the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span from the context, or nil
+// if there is no span.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// TracerOptions holds the configuration for a Tracer.
+type TracerOptions struct {
+	// ServiceName is set as the resource attribute service.name.
+	ServiceName string
+	// Endpoint is the URL of an OTLP/HTTP collector traces endpoint,
+	// for example http://localhost:4318/v1/traces. If empty spans
+	// are not exported, but trace context is still propagated.
+	Endpoint string
+	// Headers are added to the export requests, for example for
+	// authentication.
+	Headers map[string]string
+	// BatchSize is the maximum number of spans in an export request.
+	BatchSize int
+	// FlushInterval is the interval at which queued spans are exported.
+	FlushInterval time.Duration
+	// Timeout is the timeout for an export request.
+	Timeout time.Duration
+	// Logger logs failed exports, at most once every minute with the
+	// number of failed exports and spans since the last log. Defaults
+	// to NewLogger().
+	Logger logger
+}
+
+// Tracer creates spans and exports them in batches over OTLP/HTTP.
+type Tracer struct {
+	options  TracerOptions
+	exporter exporter
+	log      logger
+	now      func() time.Time
+	failures exportFailures
+	spanCh   chan *Span
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	once     sync.Once
+}
+
+// exporter is the interface that wraps around method export.
+type exporter interface {
+	export(ctx context.Context, spans []*Span) error
+}
+
+// NewTracer returns a new Tracer. If an Endpoint is configured,
+// spans are exported in the background until Shutdown is called.
+func NewTracer(options TracerOptions) *Tracer {
+	if len(options.ServiceName) == 0 {
+		options.ServiceName = defaultTracerServiceName
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultTracerBatchSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = defaultTracerFlushInterval
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = defaultTracerTimeout
+	}
+	if options.Logger == nil {
+		options.Logger = NewLogger()
+	}
+
+	t := &Tracer{
+		options: options,
+		log:     options.Logger,
+		now:     time.Now,
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	if len(options.Endpoint) == 0 {
+		close(t.doneCh)
+		return t
+	}
+	t.exporter = newOTLPExporter(options)
+	t.spanCh = make(chan *Span, options.BatchSize*4)
+	go t.run()
+	return t
+}
+
+// Start starts a new span as a child of the span in ctx, if any.
+// The returned context contains the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.SpanContext()
+	}
+	return t.start(ctx, name, kind, parent)
+}
+
+// start starts a new span with the given parent. If the parent is
+// not valid a new trace is started.
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  t.now(),
+	}
+	if parent.IsValid() {
+		span.context = SpanContext{
+			TraceID:    parent.TraceID,
+			TraceFlags: parent.TraceFlags,
+			TraceState: parent.TraceState,
+		}
+		span.parent = parent.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.TraceFlags = flagSampled
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown exports the queued spans and stops the tracer.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() {
+		close(t.stopCh)
+	})
+	select {
+	case <-t.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queue queues the span for export. Spans are dropped if the
+// queue is full or if the tracer has no exporter.
+func (t *Tracer) queue(span *Span) {
+	if t.spanCh == nil {
+		return
+	}
+	select {
+	case <-t.stopCh:
+	case t.spanCh <- span:
+	default:
+	}
+}
+
+// run exports spans in batches until the tracer is shut down.
+func (t *Tracer) run() {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(t.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.options.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.options.Timeout)
+		defer cancel()
+		if err := t.exporter.export(ctx, batch); err != nil {
+			t.exportFailed(err, len(batch), false)
+		}
+		batch = make([]*Span, 0, t.options.BatchSize)
+	}
+
+	for {
+		select {
+		case span := <-t.spanCh:
+			batch = append(batch, span)
+			if len(batch) >= t.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stopCh:
+			for {
+				select {
+				case span := <-t.spanCh:
+					batch = append(batch, span)
+					if len(batch) >= t.options.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					t.exportFailed(nil, 0, true)
+					return
+				}
+			}
+		}
+	}
+}
+
+// exportFailures holds the failed exports since the last log.
+type exportFailures struct {
+	exports int
+	spans   int
+	err     error
+	logged  time.Time
+}
+
+// exportFailed counts a failed export of n spans, and logs the failed
+// exports at most once every tracerErrorInterval, or if flush is true.
+func (t *Tracer) exportFailed(err error, n int, flush bool) {
+	f := &t.failures
+	if err != nil {
+		f.exports++
+		f.spans += n
+		f.err = err
+	}
+	now := t.now()
+	if f.exports == 0 || (!flush && !f.logged.IsZero() && now.Sub(f.logged) < tracerErrorInterval) {
+		return
+	}
+	t.log.Error("Could not export spans.", "error", f.err, "exports", f.exports, "spans", f.spans)
+	*f = exportFailures{logged: now}
+}
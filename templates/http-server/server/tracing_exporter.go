@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// tracerScopeName is the instrumentation scope name of exported spans.
+const tracerScopeName = "server"
+
+// otlpExporter exports spans to an OTLP/HTTP collector with
+// JSON encoding.
+type otlpExporter struct {
+	httpClient  *http.Client
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+}
+
+// newOTLPExporter returns a new otlpExporter.
+func newOTLPExporter(options TracerOptions) *otlpExporter {
+	return &otlpExporter{
+		httpClient:  &http.Client{Timeout: options.Timeout},
+		endpoint:    options.Endpoint,
+		headers:     options.Headers,
+		serviceName: options.ServiceName,
+	}
+}
+
+// export sends the spans to the collector.
+func (e *otlpExporter) export(ctx context.Context, spans []*Span) error {
+	b, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("export spans: unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// request returns the OTLP export request for the spans.
+func (e *otlpExporter) request(spans []*Span) otlpExportRequest {
+	scopeSpans := otlpScopeSpans{
+		Scope: otlpScope{Name: tracerScopeName},
+		Spans: make([]otlpSpan, 0, len(spans)),
+	}
+	for _, span := range spans {
+		scopeSpans.Spans = append(scopeSpans.Spans, newOTLPSpan(span))
+	}
+
+	return otlpExportRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{newOTLPKeyValue("service.name", e.serviceName)},
+				},
+				ScopeSpans: []otlpScopeSpans{scopeSpans},
+			},
+		},
+	}
+}
+
+// otlpExportRequest is the JSON representation of an OTLP
+// ExportTraceServiceRequest.
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    spanStatusCode `json:"code"`
+	Message string         `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// newOTLPSpan returns the OTLP representation of the span.
+func newOTLPSpan(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	s := otlpSpan{
+		TraceID:           span.context.TraceID.String(),
+		SpanID:            span.context.SpanID.String(),
+		TraceState:        span.context.TraceState,
+		Name:              span.name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Status:            otlpStatus{Code: span.status, Message: span.message},
+	}
+	if span.parent.isValid() {
+		s.ParentSpanID = span.parent.String()
+	}
+	for _, attr := range span.attributes {
+		s.Attributes = append(s.Attributes, newOTLPKeyValue(attr.key, attr.value))
+	}
+	return s
+}
+
+// newOTLPKeyValue returns the OTLP representation of an attribute.
+func newOTLPKeyValue(key string, value any) otlpKeyValue {
+	var v otlpValue
+	switch val := value.(type) {
+	case string:
+		v.StringValue = &val
+	case bool:
+		v.BoolValue = &val
+	case int:
+		s := strconv.Itoa(val)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &val
+	default:
+		s := fmt.Sprint(val)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
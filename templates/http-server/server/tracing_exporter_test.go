@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTracer_Export(t *testing.T) {
+	t.Run("export spans to collector", func(t *testing.T) {
+		collector := newMockCollector()
+		defer collector.Close()
+
+		tracer := NewTracer(TracerOptions{
+			ServiceName: "test",
+			Endpoint:    collector.URL + "/v1/traces",
+			Headers:     map[string]string{"Authorization": "token"},
+		})
+
+		ctx, parent := tracer.Start(context.Background(), "parent", SpanKindServer)
+		parent.SetAttribute("http.response.status_code", 500)
+		parent.SetError(errors.New("error"))
+		_, child := tracer.Start(ctx, "child", SpanKindClient)
+		child.End()
+		parent.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := tracer.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown() = unexpected error: %v", err)
+		}
+
+		reqs := collector.requests()
+		if len(reqs) != 1 {
+			t.Fatalf("Shutdown() = unexpected number of requests, want: 1, got: %d", len(reqs))
+		}
+		if reqs[0].header.Get("Authorization") != "token" {
+			t.Errorf("export() = missing header Authorization")
+		}
+
+		got := reqs[0].body
+		if diff := cmp.Diff("test", *got.ResourceSpans[0].Resource.Attributes[0].Value.StringValue); diff != "" {
+			t.Errorf("export() = unexpected service name (-want +got):\n%s\n", diff)
+		}
+
+		spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+		if len(spans) != 2 {
+			t.Fatalf("export() = unexpected number of spans, want: 2, got: %d", len(spans))
+		}
+		if spans[0].Name != "child" || spans[0].ParentSpanID != parent.SpanContext().SpanID.String() {
+			t.Errorf("export() = unexpected child span: %+v", spans[0])
+		}
+		if spans[1].TraceID != parent.SpanContext().TraceID.String() || len(spans[1].ParentSpanID) != 0 {
+			t.Errorf("export() = unexpected parent span: %+v", spans[1])
+		}
+		if diff := cmp.Diff(otlpStatus{Code: spanStatusError, Message: "error"}, spans[1].Status); diff != "" {
+			t.Errorf("export() = unexpected status (-want +got):\n%s\n", diff)
+		}
+		if diff := cmp.Diff("500", *spans[1].Attributes[0].Value.IntValue); diff != "" {
+			t.Errorf("export() = unexpected attribute (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("spans not sampled are not exported", func(t *testing.T) {
+		collector := newMockCollector()
+		defer collector.Close()
+
+		tracer := NewTracer(TracerOptions{Endpoint: collector.URL})
+		_, span := tracer.start(context.Background(), "span", SpanKindServer, SpanContext{
+			TraceID: TraceID{1},
+			SpanID:  SpanID{1},
+		})
+		span.End()
+		tracer.Shutdown(context.Background())
+
+		if len(collector.requests()) != 0 {
+			t.Errorf("Shutdown() = unexpected export of span not sampled")
+		}
+	})
+}
+
+func TestTracer_Export_Errors(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	logs := []string{}
+	tracer := NewTracer(TracerOptions{
+		Endpoint:  collector.URL,
+		BatchSize: 1,
+		Logger:    &mockLogger{logs: &logs},
+	})
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(context.Background(), "span", SpanKindServer)
+		span.End()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = unexpected error: %v", err)
+	}
+
+	want := []string{
+		"Could not export spans.", "error", "", "exports", "1", "spans", "1",
+		"Could not export spans.", "error", "", "exports", "2", "spans", "2",
+	}
+	if diff := cmp.Diff(want, logs); diff != "" {
+		t.Errorf("export() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+type mockCollectorRequest struct {
+	header http.Header
+	body   otlpExportRequest
+}
+
+type mockCollector struct {
+	*httptest.Server
+	mu   sync.Mutex
+	reqs []mockCollectorRequest
+}
+
+func newMockCollector() *mockCollector {
+	c := &mockCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body otlpExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.reqs = append(c.reqs, mockCollectorRequest{header: r.Header, body: body})
+		c.mu.Unlock()
+	}))
+	return c
+}
+
+func (c *mockCollector) requests() []mockCollectorRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reqs
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    SpanContext
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			input: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want: SpanContext{
+				TraceID:    TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:     SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+				TraceFlags: 0x01,
+			},
+		},
+		{
+			name:  "future version with additional fields",
+			input: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			want: SpanContext{
+				TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+			},
+		},
+		{
+			name:    "version 00 with additional fields",
+			input:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			wantErr: errInvalidTraceparent,
+		},
+		{
+			name:    "invalid version",
+			input:   "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceparent,
+		},
+		{
+			name:    "upper case",
+			input:   "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceparent,
+		},
+		{
+			name:    "zero trace ID",
+			input:   "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceparent,
+		},
+		{
+			name:    "zero span ID",
+			input:   "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			wantErr: errInvalidTraceparent,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: errInvalidTraceparent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := parseTraceparent(test.input)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseTraceparent() = unexpected result (-want +got):\n%s\n", diff)
+			}
+			if test.wantErr != gotErr {
+				t.Errorf("parseTraceparent() = unexpected error, want: %v, got: %v", test.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestInjectExtractSpanContext(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		want := SpanContext{
+			TraceID:    TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanID:     SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+			TraceFlags: flagSampled,
+			TraceState: "vendor=value",
+		}
+
+		header := http.Header{}
+		injectSpanContext(header, want)
+
+		if diff := cmp.Diff("00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01", header.Get("traceparent")); diff != "" {
+			t.Errorf("injectSpanContext() = unexpected result (-want +got):\n%s\n", diff)
+		}
+
+		got, ok := extractSpanContext(header)
+		if !ok {
+			t.Fatalf("extractSpanContext() = false; want true")
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("extractSpanContext() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+}
+
+func TestTracer_Start(t *testing.T) {
+	t.Run("new trace", func(t *testing.T) {
+		tracer := NewTracer(TracerOptions{})
+		ctx, span := tracer.Start(context.Background(), "root", SpanKindInternal)
+
+		if !span.SpanContext().IsValid() || !span.SpanContext().IsSampled() {
+			t.Errorf("Start() = unexpected span context: %+v", span.SpanContext())
+		}
+		if span.parent.isValid() {
+			t.Errorf("Start() = unexpected parent: %s", span.parent)
+		}
+		if SpanFromContext(ctx) != span {
+			t.Errorf("Start() = context does not contain span")
+		}
+	})
+
+	t.Run("child span", func(t *testing.T) {
+		tracer := NewTracer(TracerOptions{})
+		ctx, parent := tracer.Start(context.Background(), "root", SpanKindInternal)
+		_, child := tracer.Start(ctx, "child", SpanKindInternal)
+
+		if child.SpanContext().TraceID != parent.SpanContext().TraceID {
+			t.Errorf("Start() = unexpected trace ID, want: %s, got: %s", parent.SpanContext().TraceID, child.SpanContext().TraceID)
+		}
+		if child.parent != parent.SpanContext().SpanID {
+			t.Errorf("Start() = unexpected parent, want: %s, got: %s", parent.SpanContext().SpanID, child.parent)
+		}
+		if child.SpanContext().SpanID == parent.SpanContext().SpanID {
+			t.Errorf("Start() = child has the same span ID as parent")
+		}
+	})
+}
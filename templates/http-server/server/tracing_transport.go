@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+)
+
+// tracingTransport is an http.RoundTripper that starts a client span for
+// each request and propagates the trace context with the traceparent and
+// tracestate headers.
+type tracingTransport struct {
+	tracer *Tracer
+	base   http.RoundTripper
+}
+
+// NewTransport returns an http.RoundTripper that propagates the trace
+// context of the request context to outgoing requests. If base is nil
+// http.DefaultTransport is used.
+func NewTransport(tracer *Tracer, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tracingTransport{
+		tracer: tracer,
+		base:   base,
+	}
+}
+
+// RoundTrip starts a client span and executes the request with the
+// trace context headers set.
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), req.Method, SpanKindClient)
+	defer span.End()
+
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.Redacted())
+	span.SetAttribute("server.address", req.URL.Hostname())
+
+	r := req.Clone(ctx)
+	injectSpanContext(r.Header, span.SpanContext())
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetError(nil)
+	}
+	return resp, nil
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	t.Run("propagate trace context", func(t *testing.T) {
+		var got http.Header
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header
+		}))
+		defer ts.Close()
+
+		tracer := NewTracer(TracerOptions{})
+		ctx, parent := tracer.Start(context.Background(), "parent", SpanKindServer)
+		parent.context.TraceState = "vendor=value"
+
+		client := &http.Client{Transport: NewTransport(tracer, nil)}
+		req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		sc, ok := extractSpanContext(got)
+		if !ok {
+			t.Fatalf("RoundTrip() = traceparent not propagated")
+		}
+		if sc.TraceID != parent.SpanContext().TraceID {
+			t.Errorf("RoundTrip() = unexpected trace ID, want: %s, got: %s", parent.SpanContext().TraceID, sc.TraceID)
+		}
+		if sc.SpanID == parent.SpanContext().SpanID {
+			t.Errorf("RoundTrip() = span ID should be the client span, got the parent span")
+		}
+		if sc.TraceState != "vendor=value" {
+			t.Errorf("RoundTrip() = unexpected tracestate, want: vendor=value, got: %s", sc.TraceState)
+		}
+		if req.Header.Get("traceparent") != "" {
+			t.Errorf("RoundTrip() = original request was modified")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultEnvPrefix is the default prefix of the environment variables.
+const defaultEnvPrefix = "SERVER"
+
+// Configuration contains the configuration for the application.
+type Configuration struct {
+	Host            string        `config:"host" default:"0.0.0.0" restart:"true" usage:"Host (IP) to listen on."`
+	Port            int           `config:"port" default:"8080" restart:"true" usage:"Port to listen on."`
+	ReadTimeout     time.Duration `config:"readTimeout" default:"15s" usage:"Maximum duration for reading the rest of a message."`
+	WriteTimeout    time.Duration `config:"writeTimeout" default:"15s" usage:"Maximum duration before timing out writes to a connection."`
+	IdleTimeout     time.Duration `config:"idleTimeout" default:"30s" usage:"Maximum duration to wait for the next message on a connection."`
+	MaxConnections  int           `config:"maxConnections" default:"1000" restart:"true" usage:"Maximum number of concurrent connections (negative for no limit)."`
+	ShutdownTimeout time.Duration `config:"shutdownTimeout" default:"15s" restart:"true" usage:"Maximum duration to wait for active connections before they are closed when stopping."`
+	Limit           Limit         `config:"limit"`
+	TLS             TLS           `config:"tls"`
+	Packet          Packet        `config:"packet"`
+	Proxy           Proxy         `config:"proxy"`
+	Log             Log           `config:"log"`
+	Metrics         Metrics       `config:"metrics"`
+	Status          Status        `config:"status"`
+	PID             PID           `config:"pid"`
+}
+
+// Limit contains the limits of the connections per source IP and per
+// connection.
+type Limit struct {
+	ConnectionRate   float64       `config:"connectionRate" restart:"true" usage:"New connections per second from a source IP (disabled if zero)."`
+	ConnectionBurst  int           `config:"connectionBurst" restart:"true" usage:"New connections from a source IP allowed at once above the rate (defaults to the rate)."`
+	ConnectionsPerIP int           `config:"connectionsPerIP" restart:"true" usage:"Concurrent connections from a source IP (disabled if zero)."`
+	BytesPerSecond   int           `config:"bytesPerSecond" restart:"true" usage:"Bytes per second read from a connection (disabled if zero)."`
+	BanThreshold     int           `config:"banThreshold" restart:"true" usage:"Rejected connections from a source IP within the ban window after which it is banned (disabled if zero)."`
+	BanWindow        time.Duration `config:"banWindow" default:"1m" restart:"true" usage:"Duration in which rejected connections are counted for a ban."`
+	BanDuration      time.Duration `config:"banDuration" default:"10m" restart:"true" usage:"Duration of a ban."`
+}
+
+// TLS contains the TLS configuration for the application.
+type TLS struct {
+	Certificate string `config:"certificate" restart:"true" usage:"Path to TLS certificate, or PEM encoded certificate."`
+	Key         Secret `config:"key" restart:"true" usage:"Path to TLS key, or PEM encoded key."`
+	ClientCA    string `config:"clientCA" restart:"true" usage:"Path to CA certificates, or PEM encoded CA certificates, that client certificates are required to be signed by."`
+}
+
+// Packet contains the configuration for handling UDP packets.
+type Packet struct {
+	Workers        int `config:"workers" restart:"true" usage:"Number of workers handling packets (defaults to the number of CPUs)."`
+	ReadBufferSize int `config:"readBufferSize" default:"65535" restart:"true" usage:"Size of the buffer that a packet is read into, larger packets are truncated."`
+}
+
+// Proxy contains the configuration of the PROXY protocol.
+type Proxy struct {
+	Trusted       []string      `config:"trusted" restart:"true" usage:"CIDRs of the load balancers that send a PROXY protocol header (disabled if empty)."`
+	HeaderTimeout time.Duration `config:"headerTimeout" default:"5s" restart:"true" usage:"Maximum duration for reading a PROXY protocol header."`
+}
+
+// Log contains the logging configuration for the application.
+type Log struct {
+	Level slog.Level `config:"level" default:"info" usage:"Log level (debug, info, warn or error)."`
+}
+
+// Metrics contains the configuration of the metrics endpoint.
+type Metrics struct {
+	Address string `config:"address" restart:"true" usage:"Address to serve metrics on at /metrics (disabled if empty)."`
+}
+
+// Status contains the configuration of the status socket.
+type Status struct {
+	Socket string `config:"socket" restart:"true" usage:"Address of the status socket used by the healthcheck command, a leading @ is an abstract socket on Linux (disabled if empty)."`
+}
+
+// PID contains the configuration of the PID file.
+type PID struct {
+	File string `config:"file" restart:"true" usage:"Path of the PID file, locked to allow a single instance of the server (disabled if empty)."`
+}
+
+// New returns a new Configuration loaded from defaults, an optional
+// configuration file, environment variables and the command-line
+// arguments args, in that order of precedence.
+func New(args []string, options ...Option) (Configuration, error) {
+	cfg := Configuration{}
+	l := newLoader(filepath.Base(os.Args[0]), defaultEnvPrefix, options...)
+	if err := l.load(&cfg, args); err != nil {
+		return Configuration{}, err
+	}
+	return cfg, nil
+}
+
+// Validate the Configuration. All errors are returned together.
+func (c Configuration) Validate() error {
+	var errs []error
+	if len(c.Host) == 0 {
+		errs = append(errs, errors.New("host must be specified"))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, errors.New("port must be between 1 and 65535"))
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative"))
+	}
+	if c.Limit.ConnectionRate < 0 || c.Limit.ConnectionBurst < 0 || c.Limit.ConnectionsPerIP < 0 || c.Limit.BytesPerSecond < 0 || c.Limit.BanThreshold < 0 {
+		errs = append(errs, errors.New("limits must not be negative"))
+	}
+	if c.Limit.BanWindow < 0 || c.Limit.BanDuration < 0 {
+		errs = append(errs, errors.New("ban window and duration must not be negative"))
+	}
+	if (len(c.TLS.Certificate) == 0) != (len(c.TLS.Key) == 0) {
+		errs = append(errs, errors.New("both TLS certificate and key must be specified"))
+	}
+	if len(c.TLS.ClientCA) > 0 && len(c.TLS.Certificate) == 0 {
+		errs = append(errs, errors.New("TLS client CA requires a TLS certificate and key"))
+	}
+	if c.Packet.Workers < 0 {
+		errs = append(errs, errors.New("packet workers must not be negative"))
+	}
+	if c.Packet.ReadBufferSize < 1 {
+		errs = append(errs, errors.New("packet read buffer size must be positive"))
+	}
+	for _, cidr := range c.Proxy.Trusted {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid trusted proxy: %w", err))
+		}
+	}
+	if c.MaxConnections == 0 {
+		errs = append(errs, errors.New("max connections must not be zero"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   []string
+		want    Configuration
+		wantErr []string
+	}{
+		{
+			name:  "defaults",
+			input: []string{},
+			want: Configuration{
+				Host:            "0.0.0.0",
+				Port:            8080,
+				ReadTimeout:     15 * time.Second,
+				WriteTimeout:    15 * time.Second,
+				IdleTimeout:     30 * time.Second,
+				MaxConnections:  1000,
+				ShutdownTimeout: 15 * time.Second,
+				Limit: Limit{
+					BanWindow:   time.Minute,
+					BanDuration: 10 * time.Minute,
+				},
+				Packet: Packet{
+					ReadBufferSize: 65535,
+				},
+				Proxy: Proxy{
+					HeaderTimeout: 5 * time.Second,
+				},
+				Log: Log{
+					Level: slog.LevelInfo,
+				},
+			},
+		},
+		{
+			name:  "with flags",
+			input: []string{"--host", "localhost", "--port", "8081", "--max-connections", "10", "--tls-certificate", "cert.pem", "--tls-key", "key.pem", "--tls-client-ca", "ca.pem", "--proxy-trusted", "10.0.0.0/8,192.0.2.1/32", "--log-level", "debug", "--status-socket", "@server-1.status", "--pid-file", "/run/server.pid"},
+			want: Configuration{
+				Host:            "localhost",
+				Port:            8081,
+				ReadTimeout:     15 * time.Second,
+				WriteTimeout:    15 * time.Second,
+				IdleTimeout:     30 * time.Second,
+				MaxConnections:  10,
+				ShutdownTimeout: 15 * time.Second,
+				TLS: TLS{
+					Certificate: "cert.pem",
+					Key:         "key.pem",
+					ClientCA:    "ca.pem",
+				},
+				Limit: Limit{
+					BanWindow:   time.Minute,
+					BanDuration: 10 * time.Minute,
+				},
+				Packet: Packet{
+					ReadBufferSize: 65535,
+				},
+				Proxy: Proxy{
+					Trusted:       []string{"10.0.0.0/8", "192.0.2.1/32"},
+					HeaderTimeout: 5 * time.Second,
+				},
+				Log: Log{
+					Level: slog.LevelDebug,
+				},
+				Status: Status{
+					Socket: "@server-1.status",
+				},
+				PID: PID{
+					File: "/run/server.pid",
+				},
+			},
+		},
+		{
+			name:    "invalid",
+			input:   []string{"--log-level", "verbose"},
+			wantErr: []string{`flag --log-level: slog: level string "verbose": unknown name`},
+		},
+		{
+			name:  "invalid values",
+			input: []string{"--host", "", "--port", "0", "--read-timeout", "-1s", "--max-connections", "0", "--limit-connections-per-ip", "-1", "--tls-client-ca", "ca.pem", "--proxy-trusted", "10.0.0.0"},
+			wantErr: []string{
+				"host must be specified",
+				"port must be between 1 and 65535",
+				"timeouts must not be negative",
+				"limits must not be negative",
+				"TLS client CA requires a TLS certificate and key",
+				`invalid trusted proxy: netip.ParsePrefix("10.0.0.0"): no '/'`,
+				"max connections must not be zero",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := New(test.input, WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{}))
+
+			if len(test.wantErr) > 0 {
+				if gotErr == nil {
+					t.Fatalf("New() = nil; want error")
+				}
+				if diff := cmp.Diff(test.wantErr, strings.Split(gotErr.Error(), "\n")); diff != "" {
+					t.Errorf("New() = unexpected error (-want +got):\n%s\n", diff)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("New() = unexpected error: %v", gotErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("New() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "log:\n  level: info\n")
+
+	args := []string{"--config", path}
+	options := []Option{WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{})}
+	cfg, err := New(args, options...)
+	if err != nil {
+		t.Fatalf("New() = unexpected error: %v", err)
+	}
+
+	logs := []string{}
+	w := NewWatcher(cfg, args, &mockLogger{logs: &logs}, options...)
+	var got []Event
+	w.Subscribe(func(e Event) {
+		got = append(got, e)
+	})
+
+	writeConfig(t, path, "log:\n  level: debug\n")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() = unexpected error: %v", err)
+	}
+	writeConfig(t, path, "log:\n  level: verbose\n")
+	if err := w.Reload(); err == nil {
+		t.Errorf("Reload() = nil; want error")
+	}
+	if err := w.Reload(); err == nil {
+		t.Errorf("Reload() = nil; want error")
+	}
+
+	want := []Event{
+		{
+			Previous: cfg,
+			Current:  w.Current(),
+			Changes:  []Change{{Key: "log.level", Previous: "INFO", Current: "DEBUG"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Reload() = unexpected events (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(slog.LevelDebug, w.Current().Log.Level); diff != "" {
+		t.Errorf("Current() = unexpected log level (-want +got):\n%s\n", diff)
+	}
+	wantLogs := []string{"Configuration reloaded.", "Failed to reload configuration.", "Failed to reload configuration."}
+	if diff := cmp.Diff(wantLogs, logs); diff != "" {
+		t.Errorf("Reload() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestWatcher_Reload_Secret(t *testing.T) {
+	dir := t.TempDir()
+	path, keyPath := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "key")
+	writeConfig(t, path, "tls:\n  certificate: cert.pem\n")
+	writeConfig(t, keyPath, "first")
+	t.Setenv("CONFIG_TEST_TLS_KEY_FILE", keyPath)
+
+	args := []string{"--config", path}
+	options := []Option{WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{}), WithSecretProvider(NewSecretProvider())}
+	cfg, err := New(args, options...)
+	if err != nil {
+		t.Fatalf("New() = unexpected error: %v", err)
+	}
+
+	w := NewWatcher(cfg, args, &mockLogger{logs: &[]string{}}, options...)
+	writeConfig(t, keyPath, "second")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() = unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff("second", w.Current().TLS.Key.Value()); diff != "" {
+		t.Errorf("Reload() = unexpected secret (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestWatcher_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "log:\n  level: info\n")
+
+	args := []string{"--config", path}
+	options := []Option{WithEnvPrefix("CONFIG_TEST"), WithOutput(&bytes.Buffer{})}
+	cfg, err := New(args, options...)
+	if err != nil {
+		t.Fatalf("New() = unexpected error: %v", err)
+	}
+
+	w := NewWatcher(cfg, args, &mockLogger{logs: &[]string{}}, options...)
+	w.interval = 10 * time.Millisecond
+	eventCh := make(chan Event, 1)
+	w.Subscribe(func(e Event) {
+		eventCh <- e
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+
+	writeConfig(t, path, "log:\n  level: error\n")
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(path, modTime, modTime)
+
+	select {
+	case got := <-eventCh:
+		if diff := cmp.Diff(slog.LevelError, got.Current.Log.Level); diff != "" {
+			t.Errorf("Watch() = unexpected log level (-want +got):\n%s\n", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Watch() = no event received")
+	}
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+}
+
+type mockLogger struct {
+	mu   sync.Mutex
+	logs *[]string
+}
+
+func (l *mockLogger) Info(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.logs = append(*l.logs, msg)
+}
+
+func (l *mockLogger) Error(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.logs = append(*l.logs, msg)
+}
@@ -2,4 +2,7 @@ module github.com/RedeployAB/go-template/templates/server
 
 go 1.22.2
 
-require github.com/google/go-cmp v0.6.0
+require (
+	github.com/google/go-cmp v0.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
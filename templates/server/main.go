@@ -1,17 +1,132 @@
 package main
 
 import (
-	server "github.com/RedeployAB/go-template/templates/server/server"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"github.com/RedeployAB/go-template/templates/server/config"
+	"github.com/RedeployAB/go-template/templates/server/server"
+	"github.com/RedeployAB/go-template/templates/server/version"
+)
+
+const (
+	// healthcheckTimeout is the timeout of the healthcheck command.
+	healthcheckTimeout = 5 * time.Second
+	// secretWatchInterval is the interval at which the files of the
+	// secrets are checked for changes.
+	secretWatchInterval = 30 * time.Second
 )
 
 func main() {
-	log := server.NewLogger()
+	args := os.Args[1:]
+	healthcheck := len(args) > 0 && args[0] == "healthcheck"
+	if healthcheck {
+		args = args[1:]
+	}
+
+	secrets := config.NewSecretProvider()
+	cfg, err := config.New(args, config.WithSecretProvider(secrets))
+	if err != nil {
+		if errors.Is(err, config.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, config.ErrVersion) {
+			fmt.Println(version.Get())
+			os.Exit(0)
+		}
+		server.NewLogger().Error("Configuration error.", "error", err)
+		os.Exit(1)
+	}
+
+	level := &slog.LevelVar{}
+	level.Set(cfg.Log.Level)
+	log := server.NewLogger(server.WithLevel(level))
+
+	// A TLS key read from a secret file is passed as the path of the
+	// file, so that it is reloaded together with the certificate.
+	tlsKey := cfg.TLS.Key.Value()
+	if path, ok := secrets.Path("tls.key"); ok {
+		tlsKey = path
+	}
+
+	options := server.Options{
+		Handler:         server.ConnHandlerFunc(echo),
+		Logger:          log,
+		LogLevel:        level,
+		Host:            cfg.Host,
+		Port:            cfg.Port,
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		IdleTimeout:     cfg.IdleTimeout,
+		MaxConnections:  cfg.MaxConnections,
+		PacketWorkers:   cfg.Packet.Workers,
+		ReadBufferSize:  cfg.Packet.ReadBufferSize,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		Limits: server.LimitOptions{
+			ConnectionRate:   cfg.Limit.ConnectionRate,
+			ConnectionBurst:  cfg.Limit.ConnectionBurst,
+			ConnectionsPerIP: cfg.Limit.ConnectionsPerIP,
+			BytesPerSecond:   cfg.Limit.BytesPerSecond,
+			BanThreshold:     cfg.Limit.BanThreshold,
+			BanWindow:        cfg.Limit.BanWindow,
+			BanDuration:      cfg.Limit.BanDuration,
+		},
+		TLSConfig: server.TLSConfig{
+			Certificate: cfg.TLS.Certificate,
+			Key:         tlsKey,
+			ClientCA:    cfg.TLS.ClientCA,
+		},
+		Proxy: server.ProxyOptions{
+			Trusted:       cfg.Proxy.Trusted,
+			HeaderTimeout: cfg.Proxy.HeaderTimeout,
+		},
+		MetricsAddress: cfg.Metrics.Address,
+		StatusSocket:   cfg.Status.Socket,
+		PIDFile:        cfg.PID.File,
+	}
+
+	if healthcheck {
+		ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+		err := server.Healthcheck(ctx, options)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Healthcheck failed: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	srv := server.New(server.WithOptions(options))
 
-	srv := server.New(server.WithOptions(server.Options{
-		Logger: log,
-	}))
+	watcher := config.NewWatcher(cfg, args, log, config.WithSecretProvider(secrets))
+	watcher.Subscribe(func(e config.Event) {
+		srv.Update(server.Settings{
+			LogLevel:     e.Current.Log.Level,
+			ReadTimeout:  e.Current.ReadTimeout,
+			WriteTimeout: e.Current.WriteTimeout,
+			IdleTimeout:  e.Current.IdleTimeout,
+		})
+	})
+	go watcher.Watch(context.Background())
+	// A rotated secret file reloads the configuration, which resolves
+	// the secrets again and publishes the changes to the subscribers.
+	go secrets.Watch(context.Background(), secretWatchInterval, func(name string, value config.Secret) {
+		watcher.Reload()
+	})
 
 	if err := srv.Start(); err != nil {
 		log.Error("Server error.", "error", err)
 	}
 }
+
+// echo writes back everything read from the connection. Replace it with
+// the handler of the protocol of the server.
+func echo(ctx context.Context, conn net.Conn) {
+	io.Copy(conn, conn)
+}
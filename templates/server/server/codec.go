@@ -0,0 +1,307 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+)
+
+// defaultMaxMessageSize is the default maximum size of a message.
+const defaultMaxMessageSize = 1 << 20
+
+var (
+	// ErrMessageTooLarge is returned when a message is larger than the
+	// maximum size of the codec.
+	ErrMessageTooLarge = errors.New("message too large")
+	// ErrInvalidMessage is returned when a message cannot be framed by
+	// the codec.
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// Codec reads and writes whole messages on a stream.
+type Codec interface {
+	// ReadMessage reads the next message.
+	ReadMessage(r *bufio.Reader) ([]byte, error)
+	// WriteMessage writes the message with a single write.
+	WriteMessage(w io.Writer, msg []byte) error
+}
+
+// CodecOptions holds the options for a codec.
+type CodecOptions struct {
+	// MaxSize is the maximum size of a message, without its framing.
+	// Defaults to 1 MiB.
+	MaxSize int
+}
+
+// LengthCodecOptions holds the options for a length-prefixed codec.
+type LengthCodecOptions struct {
+	// Width is the number of bytes of the length prefix, 1, 2, 4 or 8.
+	// Defaults to 4.
+	Width int
+	// ByteOrder of the length prefix. Defaults to binary.BigEndian.
+	ByteOrder binary.ByteOrder
+	// MaxSize is the maximum size of a message, without its prefix.
+	// Defaults to 1 MiB, and is limited to what fits in the prefix.
+	MaxSize int
+}
+
+// lineCodec frames messages delimited by newlines.
+type lineCodec struct {
+	max int
+}
+
+// NewLineCodec returns a Codec for newline-delimited messages. A
+// trailing carriage return is removed from read messages.
+func NewLineCodec(options CodecOptions) Codec {
+	return lineCodec{max: maxSize(options.MaxSize, math.MaxInt-2)}
+}
+
+// ReadMessage reads the next line without its line ending.
+func (c lineCodec) ReadMessage(r *bufio.Reader) ([]byte, error) {
+	var msg []byte
+	for {
+		b, err := r.ReadSlice('\n')
+		if len(msg)+len(b) > c.max+2 {
+			return nil, ErrMessageTooLarge
+		}
+		msg = append(msg, b...)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) && len(msg) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	msg = bytes.TrimSuffix(msg[:len(msg)-1], []byte{'\r'})
+	if len(msg) > c.max {
+		return nil, ErrMessageTooLarge
+	}
+	return msg, nil
+}
+
+// WriteMessage writes the message followed by a newline.
+func (c lineCodec) WriteMessage(w io.Writer, msg []byte) error {
+	if len(msg) > c.max {
+		return ErrMessageTooLarge
+	}
+	if bytes.IndexByte(msg, '\n') >= 0 {
+		return ErrInvalidMessage
+	}
+	_, err := w.Write(append(msg[:len(msg):len(msg)], '\n'))
+	return err
+}
+
+// lengthCodec frames messages with a fixed width length prefix.
+type lengthCodec struct {
+	width int
+	order binary.ByteOrder
+	max   int
+}
+
+// NewLengthCodec returns a Codec for messages prefixed with their
+// length as an unsigned integer of a fixed width.
+func NewLengthCodec(options LengthCodecOptions) Codec {
+	c := lengthCodec{width: options.Width, order: options.ByteOrder}
+	switch c.width {
+	case 1, 2, 4, 8:
+	default:
+		c.width = 4
+	}
+	if c.order == nil {
+		c.order = binary.BigEndian
+	}
+	limit := math.MaxInt
+	if c.width < 8 {
+		limit = 1<<(8*c.width) - 1
+	}
+	c.max = maxSize(options.MaxSize, limit)
+	return c
+}
+
+// ReadMessage reads the length prefix and then the message.
+func (c lengthCodec) ReadMessage(r *bufio.Reader) ([]byte, error) {
+	prefix := make([]byte, c.width)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	var n uint64
+	switch c.width {
+	case 1:
+		n = uint64(prefix[0])
+	case 2:
+		n = uint64(c.order.Uint16(prefix))
+	case 4:
+		n = uint64(c.order.Uint32(prefix))
+	case 8:
+		n = c.order.Uint64(prefix)
+	}
+	if n > uint64(c.max) {
+		return nil, ErrMessageTooLarge
+	}
+	return readFull(r, int(n))
+}
+
+// WriteMessage writes the length prefix and the message.
+func (c lengthCodec) WriteMessage(w io.Writer, msg []byte) error {
+	if len(msg) > c.max {
+		return ErrMessageTooLarge
+	}
+
+	b := make([]byte, c.width, c.width+len(msg))
+	switch c.width {
+	case 1:
+		b[0] = byte(len(msg))
+	case 2:
+		c.order.PutUint16(b, uint16(len(msg)))
+	case 4:
+		c.order.PutUint32(b, uint32(len(msg)))
+	case 8:
+		c.order.PutUint64(b, uint64(len(msg)))
+	}
+	_, err := w.Write(append(b, msg...))
+	return err
+}
+
+// varintCodec frames messages with a varint length prefix.
+type varintCodec struct {
+	max int
+}
+
+// NewVarintCodec returns a Codec for messages prefixed with their
+// length as an unsigned varint, as used by Protocol Buffers.
+func NewVarintCodec(options CodecOptions) Codec {
+	return varintCodec{max: maxSize(options.MaxSize, math.MaxInt)}
+}
+
+// ReadMessage reads the varint prefix and then the message.
+func (c varintCodec) ReadMessage(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(c.max) {
+		return nil, ErrMessageTooLarge
+	}
+	return readFull(r, int(n))
+}
+
+// WriteMessage writes the varint prefix and the message.
+func (c varintCodec) WriteMessage(w io.Writer, msg []byte) error {
+	if len(msg) > c.max {
+		return ErrMessageTooLarge
+	}
+	b := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(msg)), uint64(len(msg)))
+	_, err := w.Write(append(b, msg...))
+	return err
+}
+
+// maxSize returns size, or the default maximum size if size is less
+// than or equal to zero, limited to limit.
+func maxSize(size, limit int) int {
+	if size <= 0 {
+		size = defaultMaxMessageSize
+	}
+	return min(size, limit)
+}
+
+// readFull reads a message of n bytes. A message that ends early is
+// io.ErrUnexpectedEOF.
+func readFull(r io.Reader, n int) ([]byte, error) {
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Conn is a connection that reads and writes whole messages with a
+// Codec. ReadMessage must not be called concurrently, WriteMessage
+// can be.
+type Conn struct {
+	net.Conn
+	codec Codec
+	r     *bufio.Reader
+	mu    sync.Mutex
+}
+
+// NewConn returns a new Conn that frames the messages of the connection
+// with the codec.
+func NewConn(conn net.Conn, codec Codec) *Conn {
+	return &Conn{Conn: conn, codec: codec, r: bufio.NewReader(conn)}
+}
+
+// ReadMessage reads the next message. When no part of the message has
+// been received, the read waits for it with the idle timeout of the
+// server.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	conn, ok := c.Conn.(*conn)
+	if !ok {
+		return c.codec.ReadMessage(c.r)
+	}
+	if c.r.Buffered() == 0 {
+		conn.idle.Store(true)
+	}
+	msg, err := c.codec.ReadMessage(c.r)
+	conn.metrics.messageRead(len(msg), err)
+	return msg, err
+}
+
+// WriteMessage writes the message.
+func (c *Conn) WriteMessage(msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.codec.WriteMessage(c.Conn, msg)
+	if conn, ok := c.Conn.(*conn); ok {
+		conn.metrics.messageWritten(err)
+	}
+	return err
+}
+
+// Read reads from the buffer of the connection, so that it can be
+// mixed with ReadMessage.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// MessageHandler handles a connection that reads and writes whole
+// messages.
+type MessageHandler interface {
+	ServeMessages(ctx context.Context, conn *Conn)
+}
+
+// MessageHandlerFunc is an adapter to allow the use of ordinary
+// functions as a MessageHandler.
+type MessageHandlerFunc func(ctx context.Context, conn *Conn)
+
+// ServeMessages calls f(ctx, conn).
+func (f MessageHandlerFunc) ServeMessages(ctx context.Context, conn *Conn) {
+	f(ctx, conn)
+}
+
+// Framed returns a ConnHandler that frames the messages of every
+// connection with the codec and handles them with the handler.
+func Framed(codec Codec, handler MessageHandler) ConnHandler {
+	return ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {
+		handler.ServeMessages(ctx, NewConn(conn, codec))
+	})
+}
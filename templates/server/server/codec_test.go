@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCodec(t *testing.T) {
+	var tests = []struct {
+		name  string
+		codec Codec
+		input [][]byte
+		want  []byte
+	}{
+		{
+			name:  "line",
+			codec: NewLineCodec(CodecOptions{}),
+			input: [][]byte{[]byte("first"), {}, []byte("second")},
+			want:  []byte("first\n\nsecond\n"),
+		},
+		{
+			name:  "length",
+			codec: NewLengthCodec(LengthCodecOptions{}),
+			input: [][]byte{[]byte("first"), {}},
+			want:  []byte("\x00\x00\x00\x05first\x00\x00\x00\x00"),
+		},
+		{
+			name:  "length with width and byte order",
+			codec: NewLengthCodec(LengthCodecOptions{Width: 2, ByteOrder: binary.LittleEndian}),
+			input: [][]byte{[]byte("first")},
+			want:  []byte("\x05\x00first"),
+		},
+		{
+			name:  "length with single byte",
+			codec: NewLengthCodec(LengthCodecOptions{Width: 1}),
+			input: [][]byte{[]byte("first")},
+			want:  []byte("\x05first"),
+		},
+		{
+			name:  "varint",
+			codec: NewVarintCodec(CodecOptions{}),
+			input: [][]byte{[]byte("first"), bytes.Repeat([]byte("a"), 300)},
+			want:  append([]byte("\x05first\xac\x02"), bytes.Repeat([]byte("a"), 300)...),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, msg := range test.input {
+				if err := test.codec.WriteMessage(&buf, msg); err != nil {
+					t.Fatalf("WriteMessage() = unexpected error: %v", err)
+				}
+			}
+			if diff := cmp.Diff(test.want, buf.Bytes()); diff != "" {
+				t.Errorf("WriteMessage() = unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			r := bufio.NewReader(&buf)
+			got := [][]byte{}
+			for {
+				msg, err := test.codec.ReadMessage(r)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("ReadMessage() = unexpected error: %v", err)
+				}
+				got = append(got, msg)
+			}
+			if diff := cmp.Diff(test.input, got); diff != "" {
+				t.Errorf("ReadMessage() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestCodec_ReadMessage(t *testing.T) {
+	var tests = []struct {
+		name  string
+		codec Codec
+		input string
+		want  []byte
+		err   error
+	}{
+		{
+			name:  "line with carriage return",
+			codec: NewLineCodec(CodecOptions{}),
+			input: "message\r\n",
+			want:  []byte("message"),
+		},
+		{
+			name:  "line longer than the buffer",
+			codec: NewLineCodec(CodecOptions{}),
+			input: strings.Repeat("a", 5000) + "\n",
+			want:  bytes.Repeat([]byte("a"), 5000),
+		},
+		{
+			name:  "line too large",
+			codec: NewLineCodec(CodecOptions{MaxSize: 4}),
+			input: "message\n",
+			err:   ErrMessageTooLarge,
+		},
+		{
+			name:  "line without newline",
+			codec: NewLineCodec(CodecOptions{}),
+			input: "message",
+			err:   io.ErrUnexpectedEOF,
+		},
+		{
+			name:  "length too large",
+			codec: NewLengthCodec(LengthCodecOptions{MaxSize: 4}),
+			input: "\x00\x00\x00\x05first",
+			err:   ErrMessageTooLarge,
+		},
+		{
+			name:  "length with torn message",
+			codec: NewLengthCodec(LengthCodecOptions{}),
+			input: "\x00\x00\x00\x05fir",
+			err:   io.ErrUnexpectedEOF,
+		},
+		{
+			name:  "varint too large",
+			codec: NewVarintCodec(CodecOptions{MaxSize: 4}),
+			input: "\x05first",
+			err:   ErrMessageTooLarge,
+		},
+		{
+			name:  "varint with torn prefix",
+			codec: NewVarintCodec(CodecOptions{}),
+			input: "\xac",
+			err:   io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := test.codec.ReadMessage(bufio.NewReader(strings.NewReader(test.input)))
+
+			if !errors.Is(gotErr, test.err) {
+				t.Errorf("ReadMessage() = %v; want %v", gotErr, test.err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ReadMessage() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestCodec_WriteMessage(t *testing.T) {
+	var tests = []struct {
+		name  string
+		codec Codec
+		input []byte
+		want  error
+	}{
+		{
+			name:  "line with newline",
+			codec: NewLineCodec(CodecOptions{}),
+			input: []byte("first\nsecond"),
+			want:  ErrInvalidMessage,
+		},
+		{
+			name:  "line too large",
+			codec: NewLineCodec(CodecOptions{MaxSize: 4}),
+			input: []byte("message"),
+			want:  ErrMessageTooLarge,
+		},
+		{
+			name:  "length larger than the prefix",
+			codec: NewLengthCodec(LengthCodecOptions{Width: 1, MaxSize: 1000}),
+			input: bytes.Repeat([]byte("a"), 256),
+			want:  ErrMessageTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotErr := test.codec.WriteMessage(io.Discard, test.input)
+
+			if !errors.Is(gotErr, test.want) {
+				t.Errorf("WriteMessage() = %v; want %v", gotErr, test.want)
+			}
+		})
+	}
+}
+
+func TestFramed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	handler := Framed(NewLineCodec(CodecOptions{}), MessageHandlerFunc(func(ctx context.Context, conn *Conn) {
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(bytes.ToUpper(msg))
+		}
+	}))
+	go handler.ServeConn(context.Background(), newConn(server, newTimeouts(0, 0, 0), nil))
+
+	conn := NewConn(client, NewLineCodec(CodecOptions{}))
+	go conn.WriteMessage([]byte("message"))
+	got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() = unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]byte("MESSAGE"), got); diff != "" {
+		t.Errorf("ReadMessage() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
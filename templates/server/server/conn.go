@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnHandler handles a connection accepted by the server. The context
+// is cancelled when the server is stopped. The connection is closed
+// when ServeConn returns.
+type ConnHandler interface {
+	ServeConn(ctx context.Context, conn net.Conn)
+}
+
+// ConnHandlerFunc is an adapter to allow the use of ordinary functions
+// as a ConnHandler.
+type ConnHandlerFunc func(ctx context.Context, conn net.Conn)
+
+// ServeConn calls f(ctx, conn).
+func (f ConnHandlerFunc) ServeConn(ctx context.Context, conn net.Conn) {
+	f(ctx, conn)
+}
+
+// timeouts holds the read, write and idle timeouts of connections that
+// can be updated while the server is running.
+type timeouts struct {
+	mu    sync.RWMutex
+	read  time.Duration
+	write time.Duration
+	idle  time.Duration
+}
+
+// newTimeouts returns a new timeouts.
+func newTimeouts(read, write, idle time.Duration) *timeouts {
+	return &timeouts{read: read, write: write, idle: idle}
+}
+
+// get returns the read, write and idle timeouts.
+func (t *timeouts) get() (time.Duration, time.Duration, time.Duration) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.read, t.write, t.idle
+}
+
+// set sets the read, write and idle timeouts. Values less than or
+// equal to zero are ignored.
+func (t *timeouts) set(read, write, idle time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if read > 0 {
+		t.read = read
+	}
+	if write > 0 {
+		t.write = write
+	}
+	if idle > 0 {
+		t.idle = idle
+	}
+}
+
+// conn is a net.Conn that sets a deadline before every read and write
+// from the timeouts. A read that waits for the next message, at the
+// start of the connection and after a write, has the idle timeout,
+// and a read that continues a message has the read timeout. It counts
+// the bytes read and written, keeps the first error of a read or write,
+// and throttles reads if it has a throttle.
+type conn struct {
+	net.Conn
+	timeouts *timeouts
+	metrics  *metrics
+	throttle *throttle
+	idle     atomic.Bool
+	read     atomic.Int64
+	written  atomic.Int64
+	mu       sync.Mutex
+	err      error
+}
+
+// newConn returns a new conn.
+func newConn(c net.Conn, t *timeouts, m *metrics) *conn {
+	conn := &conn{Conn: c, timeouts: t, metrics: m}
+	conn.idle.Store(true)
+	return conn
+}
+
+// Read reads from the connection with the read or idle deadline, and
+// waits after the read if it exceeds the rate of the throttle.
+func (c *conn) Read(b []byte) (int, error) {
+	read, _, idle := c.timeouts.get()
+	if c.idle.Load() && idle > 0 {
+		read = idle
+	}
+	if read > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(read))
+	}
+	n, err := c.Conn.Read(c.throttle.limit(b))
+	if n > 0 {
+		c.idle.Store(false)
+	}
+	c.throttle.wait(n)
+	c.read.Add(int64(n))
+	c.metrics.read(n)
+	c.setErr(err)
+	return n, err
+}
+
+// Write writes to the connection with the write deadline.
+func (c *conn) Write(b []byte) (int, error) {
+	if _, write, _ := c.timeouts.get(); write > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(write))
+	}
+	n, err := c.Conn.Write(b)
+	c.idle.Store(true)
+	c.written.Add(int64(n))
+	c.metrics.written(n)
+	c.setErr(err)
+	return n, err
+}
+
+// setErr keeps the error if it is the first.
+func (c *conn) setErr(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Err returns the first error of a read or write.
+func (c *conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// NetConn returns the underlying connection.
+func (c *conn) NetConn() net.Conn {
+	return c.Conn
+}
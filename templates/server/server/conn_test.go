@@ -0,0 +1,47 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConn_Deadlines(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := newConn(server, newTimeouts(20*time.Millisecond, time.Second, 100*time.Millisecond), nil)
+	defer c.Close()
+
+	// A read that waits for the next message has the idle timeout.
+	start := time.Now()
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read() = %v; want %v", err, os.ErrDeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Read() = timed out after %s; want idle timeout", elapsed)
+	}
+
+	// A read that continues a message has the read timeout.
+	go client.Write([]byte("a"))
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("Read() = unexpected error: %v", err)
+	}
+	start = time.Now()
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read() = %v; want %v", err, os.ErrDeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("Read() = timed out after %s; want read timeout", elapsed)
+	}
+
+	// A write ends the message, the next read has the idle timeout.
+	go client.Read(make([]byte, 1))
+	if _, err := c.Write([]byte("b")); err != nil {
+		t.Fatalf("Write() = unexpected error: %v", err)
+	}
+	if !c.idle.Load() {
+		t.Errorf("Write() = not idle; want idle")
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrUnknownType is returned when there is no handler for the type
+	// of a message.
+	ErrUnknownType = errors.New("unknown message type")
+	// ErrTypeExists is returned when a handler is already registered
+	// for a message type.
+	ErrTypeExists = errors.New("message type already registered")
+)
+
+// RequestHandler handles a request message and returns the response
+// message.
+type RequestHandler func(ctx context.Context, req []byte) ([]byte, error)
+
+// DispatcherOptions holds the options for a Dispatcher.
+type DispatcherOptions struct {
+	// Type returns the type and the payload of a message. Defaults to
+	// the first word of the message, separated by a space from the
+	// payload, for text protocols.
+	Type func(msg []byte) (string, []byte, error)
+	// Error returns the response message of an error. Defaults to the
+	// error prefixed with "ERR ".
+	Error func(err error) []byte
+}
+
+// Dispatcher is a MessageHandler for request/response protocols. It
+// reads the requests of a connection one at a time and dispatches each
+// of them to the handler registered for its type, and writes the
+// response of the handler, or of the error it returns.
+type Dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[string]RequestHandler
+	typeOf   func(msg []byte) (string, []byte, error)
+	errorOf  func(err error) []byte
+}
+
+// NewDispatcher returns a new Dispatcher.
+func NewDispatcher(options DispatcherOptions) *Dispatcher {
+	d := &Dispatcher{
+		handlers: make(map[string]RequestHandler),
+		typeOf:   options.Type,
+		errorOf:  options.Error,
+	}
+	if d.typeOf == nil {
+		d.typeOf = firstWord
+	}
+	if d.errorOf == nil {
+		d.errorOf = func(err error) []byte {
+			return []byte("ERR " + err.Error())
+		}
+	}
+	return d
+}
+
+// Handle registers the handler for the message type. It returns
+// ErrTypeExists if a handler is already registered for the type.
+func (d *Dispatcher) Handle(typ string, handler RequestHandler) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.handlers[typ]; ok {
+		return fmt.Errorf("%w: %s", ErrTypeExists, typ)
+	}
+	d.handlers[typ] = handler
+	return nil
+}
+
+// ServeMessages reads requests from the connection and writes their
+// responses until the connection is closed, a message cannot be read
+// or written, or the context is cancelled.
+func (d *Dispatcher) ServeMessages(ctx context.Context, conn *Conn) {
+	for ctx.Err() == nil {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			if errors.Is(err, ErrMessageTooLarge) {
+				conn.WriteMessage(d.errorOf(err))
+			}
+			return
+		}
+
+		resp, err := d.dispatch(ctx, msg)
+		if err != nil {
+			resp = d.errorOf(err)
+		}
+		if err := conn.WriteMessage(resp); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch the message to the handler of its type.
+func (d *Dispatcher) dispatch(ctx context.Context, msg []byte) ([]byte, error) {
+	typ, payload, err := d.typeOf(msg)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	handler, ok := d.handlers[typ]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, typ)
+	}
+	return handler(ctx, payload)
+}
+
+// firstWord returns the first word of the message as the type, and the
+// rest of the message after the space as the payload.
+func firstWord(msg []byte) (string, []byte, error) {
+	typ, payload, _ := bytes.Cut(msg, []byte{' '})
+	return string(typ), payload, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDispatcher(t *testing.T) {
+	d := NewDispatcher(DispatcherOptions{})
+	d.Handle("ECHO", func(ctx context.Context, req []byte) ([]byte, error) {
+		return req, nil
+	})
+	d.Handle("FAIL", func(ctx context.Context, req []byte) ([]byte, error) {
+		return nil, errors.New("handler error")
+	})
+
+	if err := d.Handle("ECHO", nil); !errors.Is(err, ErrTypeExists) {
+		t.Errorf("Handle() = %v; want %v", err, ErrTypeExists)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	codec := NewLineCodec(CodecOptions{MaxSize: 32})
+	go d.ServeMessages(context.Background(), NewConn(server, codec))
+
+	var tests = []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "request",
+			input: "ECHO message",
+			want:  "message",
+		},
+		{
+			name:  "handler error",
+			input: "FAIL",
+			want:  "ERR handler error",
+		},
+		{
+			name:  "unknown type",
+			input: "GET key",
+			want:  "ERR unknown message type: GET",
+		},
+	}
+
+	conn := NewConn(client, NewLineCodec(CodecOptions{}))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			go conn.WriteMessage([]byte(test.input))
+			got, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage() = unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("ServeMessages() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+
+	// A message that is too large ends the connection.
+	go conn.WriteMessage([]byte("ECHO message that is larger than the maximum size"))
+	got, _ := conn.ReadMessage()
+	if diff := cmp.Diff("ERR message too large", string(got)); diff != "" {
+		t.Errorf("ServeMessages() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Defaults for limits.
+const (
+	defaultBanWindow   = time.Minute
+	defaultBanDuration = 10 * time.Minute
+)
+
+// limiterSweepInterval is the minimum interval between removals of the
+// clients that no longer need to be tracked.
+const limiterSweepInterval = time.Minute
+
+// Reasons that a connection is rejected.
+const (
+	rejectBanned     = "banned"
+	rejectRate       = "rate"
+	rejectConcurrent = "concurrent"
+)
+
+// LimitOptions holds the limits of the connections of the server, per
+// source IP and per connection. Limits that are zero are disabled.
+type LimitOptions struct {
+	// ConnectionRate is the number of new connections per second from
+	// a source IP.
+	ConnectionRate float64
+	// ConnectionBurst is the number of new connections from a source IP
+	// that are allowed at once above the rate. Defaults to the rate
+	// rounded up, and at least 1.
+	ConnectionBurst int
+	// ConnectionsPerIP is the number of concurrent connections from a
+	// source IP.
+	ConnectionsPerIP int
+	// BytesPerSecond is the number of bytes per second that are read
+	// from a connection.
+	BytesPerSecond int
+	// BanThreshold is the number of rejected connections from a source
+	// IP within BanWindow after which it is banned for BanDuration.
+	BanThreshold int
+	// BanWindow defaults to 1 minute.
+	BanWindow time.Duration
+	// BanDuration defaults to 10 minutes.
+	BanDuration time.Duration
+}
+
+// isEmpty returns true if the LimitOptions are empty.
+func (o LimitOptions) isEmpty() bool {
+	return o.ConnectionRate <= 0 && o.ConnectionsPerIP <= 0 && o.BytesPerSecond <= 0
+}
+
+// limiter limits the connections per source IP, and bans the source
+// IPs of clients whose connections are rejected too often. A nil
+// limiter allows every connection.
+type limiter struct {
+	mu      sync.Mutex
+	options LimitOptions
+	now     func() time.Time
+	clients map[netip.Addr]*client
+	swept   time.Time
+}
+
+// client holds the state of the connections of a source IP.
+type client struct {
+	bucket      *tokenBucket
+	active      int
+	rejections  int
+	window      time.Time
+	bannedUntil time.Time
+}
+
+// newLimiter returns a new limiter, or nil if the options have no limits
+// per source IP.
+func newLimiter(options LimitOptions) *limiter {
+	if options.ConnectionRate <= 0 && options.ConnectionsPerIP <= 0 {
+		return nil
+	}
+	if options.ConnectionBurst <= 0 {
+		options.ConnectionBurst = max(1, int(math.Ceil(options.ConnectionRate)))
+	}
+	if options.BanWindow <= 0 {
+		options.BanWindow = defaultBanWindow
+	}
+	if options.BanDuration <= 0 {
+		options.BanDuration = defaultBanDuration
+	}
+	return &limiter{
+		options: options,
+		now:     time.Now,
+		clients: make(map[netip.Addr]*client),
+	}
+}
+
+// allow returns an empty reason if a new connection from the address is
+// allowed, otherwise the reason that it is rejected. The connection must
+// be released when it is closed if it is allowed. banned is true if the
+// rejection banned the source IP.
+func (l *limiter) allow(addr net.Addr) (reason string, banned bool) {
+	ip, ok := addrIP(addr)
+	if l == nil || !ok {
+		return "", false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &client{}
+		if l.options.ConnectionRate > 0 {
+			c.bucket = newTokenBucket(l.options.ConnectionRate, l.options.ConnectionBurst, now)
+		}
+		l.clients[ip] = c
+	}
+
+	switch {
+	case now.Before(c.bannedUntil):
+		return rejectBanned, false
+	case l.options.ConnectionsPerIP > 0 && c.active >= l.options.ConnectionsPerIP:
+		reason = rejectConcurrent
+	case c.bucket != nil && !c.bucket.allow(now):
+		reason = rejectRate
+	default:
+		c.active++
+		return "", false
+	}
+
+	if l.options.BanThreshold <= 0 {
+		return reason, false
+	}
+	if now.Sub(c.window) >= l.options.BanWindow {
+		c.window, c.rejections = now, 0
+	}
+	c.rejections++
+	if c.rejections < l.options.BanThreshold {
+		return reason, false
+	}
+	c.bannedUntil, c.rejections = now.Add(l.options.BanDuration), 0
+	return reason, true
+}
+
+// release a connection from the address that was allowed.
+func (l *limiter) release(addr net.Addr) {
+	ip, ok := addrIP(addr)
+	if l == nil || !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.clients[ip]; ok && c.active > 0 {
+		c.active--
+	}
+}
+
+// sweep removes the clients without active connections, bans or recent
+// connections, at most once every limiterSweepInterval.
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < limiterSweepInterval {
+		return
+	}
+	l.swept = now
+	for ip, c := range l.clients {
+		if c.active > 0 || now.Before(c.bannedUntil) || now.Sub(c.window) < l.options.BanWindow {
+			continue
+		}
+		if c.bucket != nil && !c.bucket.full(now) {
+			continue
+		}
+		delete(l.clients, ip)
+	}
+}
+
+// addrIP returns the IP address of a TCP address.
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	return ip.Unmap(), ok
+}
+
+// tokenBucket is a token bucket that is refilled at a rate of tokens per
+// second up to its burst. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a new full tokenBucket.
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// refill the bucket with the tokens since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// allow takes a token, and returns false if there is none.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// take n tokens, and return the duration to wait until they have been
+// refilled if there are not enough.
+func (b *tokenBucket) take(n int, now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full returns true if the bucket is full.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// throttle limits the bytes per second that are read from a connection.
+// A nil throttle does not limit.
+type throttle struct {
+	mu     sync.Mutex
+	bucket *tokenBucket
+	size   int
+	ctx    context.Context
+}
+
+// newThrottle returns a new throttle of bytes per second that stops
+// waiting when the context is done, or nil if bytes is less than or
+// equal to zero.
+func newThrottle(ctx context.Context, bytes int) *throttle {
+	if bytes <= 0 {
+		return nil
+	}
+	return &throttle{bucket: newTokenBucket(float64(bytes), bytes, time.Now()), size: bytes, ctx: ctx}
+}
+
+// limit returns b limited to the bytes of one second, so that a single
+// read does not exceed the rate.
+func (t *throttle) limit(b []byte) []byte {
+	if t == nil || len(b) <= t.size {
+		return b
+	}
+	return b[:t.size]
+}
+
+// wait until n bytes are allowed by the rate.
+func (t *throttle) wait(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	d := t.bucket.take(n, time.Now())
+	t.mu.Unlock()
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-t.ctx.Done():
+	}
+}
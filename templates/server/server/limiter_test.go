@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	type result struct {
+		Reason string
+		Banned bool
+	}
+
+	var tests = []struct {
+		name    string
+		options LimitOptions
+		steps   func(l *limiter, now *time.Time) []result
+		want    []result
+	}{
+		{
+			name:    "connection rate",
+			options: LimitOptions{ConnectionRate: 1, ConnectionBurst: 2},
+			steps: func(l *limiter, now *time.Time) []result {
+				var results []result
+				for i := 0; i < 3; i++ {
+					reason, banned := l.allow(tcpAddr("192.0.2.1"))
+					results = append(results, result{reason, banned})
+				}
+				reason, banned := l.allow(tcpAddr("192.0.2.2"))
+				results = append(results, result{reason, banned})
+				*now = now.Add(time.Second)
+				reason, banned = l.allow(tcpAddr("192.0.2.1"))
+				return append(results, result{reason, banned})
+			},
+			want: []result{{}, {}, {Reason: rejectRate}, {}, {}},
+		},
+		{
+			name:    "connections per IP",
+			options: LimitOptions{ConnectionsPerIP: 1},
+			steps: func(l *limiter, now *time.Time) []result {
+				var results []result
+				reason, banned := l.allow(tcpAddr("192.0.2.1"))
+				results = append(results, result{reason, banned})
+				reason, banned = l.allow(tcpAddr("192.0.2.1"))
+				results = append(results, result{reason, banned})
+				l.release(tcpAddr("192.0.2.1"))
+				reason, banned = l.allow(tcpAddr("192.0.2.1"))
+				return append(results, result{reason, banned})
+			},
+			want: []result{{}, {Reason: rejectConcurrent}, {}},
+		},
+		{
+			name:    "ban",
+			options: LimitOptions{ConnectionsPerIP: 1, BanThreshold: 2, BanDuration: time.Minute},
+			steps: func(l *limiter, now *time.Time) []result {
+				var results []result
+				for i := 0; i < 3; i++ {
+					reason, banned := l.allow(tcpAddr("192.0.2.1"))
+					results = append(results, result{reason, banned})
+				}
+				l.release(tcpAddr("192.0.2.1"))
+				reason, banned := l.allow(tcpAddr("192.0.2.1"))
+				results = append(results, result{reason, banned})
+				*now = now.Add(time.Minute)
+				reason, banned = l.allow(tcpAddr("192.0.2.1"))
+				return append(results, result{reason, banned})
+			},
+			want: []result{{}, {Reason: rejectConcurrent}, {Reason: rejectConcurrent, Banned: true}, {Reason: rejectBanned}, {}},
+		},
+		{
+			name:    "rejections outside of ban window",
+			options: LimitOptions{ConnectionsPerIP: 1, BanThreshold: 2, BanWindow: time.Second},
+			steps: func(l *limiter, now *time.Time) []result {
+				var results []result
+				for i := 0; i < 2; i++ {
+					reason, banned := l.allow(tcpAddr("192.0.2.1"))
+					results = append(results, result{reason, banned})
+				}
+				*now = now.Add(time.Second)
+				reason, banned := l.allow(tcpAddr("192.0.2.1"))
+				return append(results, result{reason, banned})
+			},
+			want: []result{{}, {Reason: rejectConcurrent}, {Reason: rejectConcurrent}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			l := newLimiter(test.options)
+			l.now = func() time.Time { return now }
+
+			got := test.steps(l, &now)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("allow() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(LimitOptions{ConnectionRate: 1, ConnectionsPerIP: 1})
+	l.now = func() time.Time { return now }
+
+	l.allow(tcpAddr("192.0.2.1"))
+	l.allow(tcpAddr("192.0.2.2"))
+	l.release(tcpAddr("192.0.2.2"))
+
+	now = now.Add(limiterSweepInterval)
+	l.allow(tcpAddr("192.0.2.3"))
+
+	var got []string
+	for ip := range l.clients {
+		got = append(got, ip.String())
+	}
+	if diff := cmp.Diff([]string{"192.0.2.1", "192.0.2.3"}, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("sweep() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	if l := newLimiter(LimitOptions{BytesPerSecond: 10}); l != nil {
+		t.Fatalf("newLimiter() = %v; want nil", l)
+	}
+	var l *limiter
+	if reason, _ := l.allow(tcpAddr("192.0.2.1")); len(reason) > 0 {
+		t.Errorf("allow() = %q; want allowed", reason)
+	}
+	l.release(tcpAddr("192.0.2.1"))
+}
+
+func TestTokenBucket_Take(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(100, 100, now)
+
+	got := []time.Duration{b.take(50, now), b.take(100, now), b.take(50, now.Add(time.Second))}
+	want := []time.Duration{0, 500 * time.Millisecond, 0}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("take() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestConn_Throttle(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := newConn(server, newTimeouts(0, 0, 0), nil)
+	c.throttle = newThrottle(context.Background(), 100)
+	go client.Write(make([]byte, 150))
+
+	start := time.Now()
+	b := make([]byte, 200)
+	n, err := c.Read(b)
+	if err != nil {
+		t.Fatalf("Read() = unexpected error: %v", err)
+	}
+	if n != 100 {
+		t.Errorf("Read() = %d bytes; want 100", n)
+	}
+	if _, err := c.Read(b); err != nil {
+		t.Fatalf("Read() = unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Read() = not throttled, took %s", elapsed)
+	}
+}
+
+func TestServer_Serve_Limits(t *testing.T) {
+	logs := []string{}
+	opened, block := make(chan struct{}), make(chan struct{})
+	srv := &server{
+		handler: ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {
+			opened <- struct{}{}
+			<-block
+		}),
+		conns:    newConnections(0),
+		limiter:  newLimiter(LimitOptions{ConnectionsPerIP: 1, BanThreshold: 1}),
+		metrics:  newMetrics(),
+		timeouts: newTimeouts(time.Second, time.Second, time.Second),
+		log:      &mockLogger{logs: &logs},
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.serve(l)
+	}()
+
+	first := dial(t, l.Addr().String())
+	<-opened
+	second := dial(t, l.Addr().String())
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Errorf("serve() = connection not closed")
+	}
+	third := dial(t, l.Addr().String())
+	third.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := third.Read(make([]byte, 1)); err == nil {
+		t.Errorf("serve() = connection not closed")
+	}
+
+	close(block)
+	first.Close()
+	srv.conns.close()
+	if err := <-errCh; err != nil {
+		t.Errorf("serve() = unexpected error: %v", err)
+	}
+	srv.conns.wg.Wait()
+
+	want := []string{
+		"Connection opened.", "remote", first.LocalAddr().String(),
+		"Client banned.", "remote", second.LocalAddr().String(), "duration", "",
+		"Connection rejected.", "remote", second.LocalAddr().String(), "reason", rejectConcurrent,
+	}
+	if diff := cmp.Diff(want, withoutDurations(logs)[:len(want)]); diff != "" {
+		t.Errorf("serve() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+	got := srv.metrics.rejections.values
+	if diff := cmp.Diff(map[string]uint64{rejectConcurrent: 1, rejectBanned: 1}, got); diff != "" {
+		t.Errorf("serve() = unexpected rejections (-want +got):\n%s\n", diff)
+	}
+}
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Delays between accepts after an error, such as when the process has
+// run out of file descriptors.
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// ErrNoHandler is returned by Start when the server has no
+// ConnHandler, protocol handlers or PacketHandler.
+var ErrNoHandler = errors.New("no connection handler")
+
+// connections limits and tracks the connections of the server. The
+// context of the connections is cancelled when it is closed.
+type connections struct {
+	mu       sync.Mutex
+	listener net.Listener
+	active   map[net.Conn]struct{}
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// newConnections returns a new connections limited to max concurrent
+// connections, or no limit if max is less than or equal to zero.
+func newConnections(max int) *connections {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &connections{active: make(map[net.Conn]struct{}), ctx: ctx, cancel: cancel}
+	if max > 0 {
+		c.sem = make(chan struct{}, max)
+	}
+	return c
+}
+
+// listen sets the listener that is closed when the connections are
+// closed. The listener is closed right away if they already are.
+func (c *connections) listen(l net.Listener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listener = l
+	if c.ctx.Err() != nil {
+		l.Close()
+	}
+}
+
+// acquire waits for a connection slot, and returns false if the
+// connections are closed.
+func (c *connections) acquire() bool {
+	if c.sem == nil {
+		return c.ctx.Err() == nil
+	}
+	select {
+	case c.sem <- struct{}{}:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// release a connection slot.
+func (c *connections) release() {
+	if c.sem != nil {
+		<-c.sem
+	}
+}
+
+// add an active connection. It returns false if the connections are
+// closed.
+func (c *connections) add(conn net.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return false
+	}
+	c.active[conn] = struct{}{}
+	c.wg.Add(1)
+	return true
+}
+
+// remove an active connection.
+func (c *connections) remove(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.active, conn)
+	c.wg.Done()
+}
+
+// count returns the number of active connections.
+func (c *connections) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.active)
+}
+
+// close the listener and cancel the context of the connections.
+func (c *connections) close() {
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+// shutdown closes the listener, cancels the context of the connections
+// and waits for the active connections to be closed by their handlers
+// until the context is done. The connections that are still active
+// are then closed, and their number is returned.
+func (c *connections) shutdown(ctx context.Context) int {
+	c.close()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for conn := range c.active {
+		conn.Close()
+	}
+	return len(c.active)
+}
+
+// serve accepts connections on the listener and handles each of them
+// in a new goroutine, until the connections are closed. When the
+// maximum number of connections is reached, new connections are not
+// accepted until one is closed. Accept errors are retried with an
+// exponential delay.
+func (s server) serve(l net.Listener) error {
+	s.conns.listen(l)
+	var delay time.Duration
+	for {
+		if !s.conns.acquire() {
+			return nil
+		}
+		c, err := l.Accept()
+		if err != nil {
+			s.conns.release()
+			if s.conns.ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			if delay == 0 {
+				delay = minAcceptDelay
+			} else {
+				delay = min(delay*2, maxAcceptDelay)
+			}
+			s.metrics.error("accept")
+			s.log.Error("Failed to accept connection.", "error", err, "retry", delay.String())
+			select {
+			case <-time.After(delay):
+			case <-s.conns.ctx.Done():
+				return nil
+			}
+			continue
+		}
+		delay = 0
+
+		if !s.conns.add(c) {
+			c.Close()
+			s.conns.release()
+			return nil
+		}
+		go s.handle(c)
+	}
+}
+
+// handle the connection with the handler of the server, or with the
+// handler of the protocol negotiated in the TLS handshake, if it is
+// allowed by the limits. The connection is closed when the handler
+// returns or panics, and it is logged when it is opened and closed.
+func (s server) handle(c net.Conn) {
+	defer s.conns.release()
+	defer s.conns.remove(c)
+
+	addr := c.RemoteAddr()
+	remote := addr.String()
+	if reason, banned := s.limiter.allow(addr); len(reason) > 0 {
+		c.Close()
+		s.reject(remote, reason, banned)
+		return
+	}
+	defer s.limiter.release(addr)
+
+	s.log.Info("Connection opened.", "remote", remote)
+	s.metrics.opened()
+	start := time.Now()
+	conn := newConn(c, s.timeouts, s.metrics)
+	conn.throttle = newThrottle(s.conns.ctx, s.limits.BytesPerSecond)
+	reason := s.serveConn(conn)
+	c.Close()
+
+	duration := time.Since(start)
+	s.metrics.closed(duration)
+	s.log.Info("Connection closed.", "remote", remote, "duration", duration.String(), "bytesRead", int(conn.read.Load()), "bytesWritten", int(conn.written.Load()), "reason", reason)
+}
+
+// reject logs and counts a rejected connection. Connections from banned
+// clients are only counted, to not flood the logs.
+func (s server) reject(remote, reason string, banned bool) {
+	s.metrics.rejected(reason)
+	if banned {
+		s.metrics.banned()
+		s.log.Info("Client banned.", "remote", remote, "duration", s.limiter.options.BanDuration.String())
+	}
+	if reason != rejectBanned {
+		s.log.Info("Connection rejected.", "remote", remote, "reason", reason)
+	}
+}
+
+// serveConn serves the connection with its handler, and returns the
+// reason that the connection is closed.
+func (s server) serveConn(c *conn) (reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.metrics.error("panic")
+			s.log.Error("Connection handler panicked.", "remote", c.RemoteAddr().String(), "error", fmt.Errorf("%v", r))
+			reason = "panic"
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(s.conns.ctx)
+	defer cancel()
+	handler := s.handler
+	if tc, ok := c.Conn.(*tls.Conn); ok {
+		var err error
+		if handler, err = s.handshake(ctx, tc); err != nil {
+			s.metrics.error("handshake")
+			s.log.Error("TLS handshake failed.", "remote", c.RemoteAddr().String(), "error", err)
+			return "handshake"
+		}
+	}
+	if handler == nil {
+		return "unhandled"
+	}
+	handler.ServeConn(ctx, c)
+	return closeReason(s.conns.ctx, c.Err())
+}
+
+// closeReason returns the reason that a connection is closed after its
+// handler returned, from the context of the connections and the first
+// error of the connection.
+func closeReason(ctx context.Context, err error) string {
+	switch {
+	case ctx.Err() != nil:
+		return "shutdown"
+	case err == nil:
+		return "server"
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, io.EOF):
+		return "client"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_Serve(t *testing.T) {
+	logs := []string{}
+	cancelled := make(chan struct{})
+	srv := &server{
+		handler: ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				if line == "panic\n" {
+					panic("handler error")
+				}
+				conn.Write([]byte(line))
+			}
+			<-ctx.Done()
+			close(cancelled)
+		}),
+		conns:    newConnections(1),
+		timeouts: newTimeouts(time.Second, time.Second, time.Second),
+		log:      &mockLogger{logs: &logs},
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.serve(l)
+	}()
+
+	first := dial(t, l.Addr().String())
+	if diff := cmp.Diff("first\n", roundTrip(t, first, "first\n")); diff != "" {
+		t.Errorf("serve() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	// The second connection is not accepted while the maximum number of
+	// connections is reached.
+	second := dial(t, l.Addr().String())
+	second.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	second.Write([]byte("second\n"))
+	if _, err := second.Read(make([]byte, 16)); err == nil {
+		t.Errorf("serve() = connection accepted; want it to wait")
+	}
+	first.Write([]byte("panic\n"))
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if diff := cmp.Diff("second\n", readLine(t, second)); diff != "" {
+		t.Errorf("serve() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	second.Close()
+	srv.conns.close()
+	if err := <-errCh; err != nil {
+		t.Errorf("serve() = unexpected error: %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("serve() = context not cancelled")
+	}
+	srv.conns.wg.Wait()
+
+	wantLogs := []string{
+		"Connection opened.", "remote", first.LocalAddr().String(),
+		"Connection handler panicked.", "remote", first.LocalAddr().String(), "error", "handler error",
+		"Connection closed.", "remote", first.LocalAddr().String(), "duration", "", "bytesRead", "12", "bytesWritten", "6", "reason", "panic",
+		"Connection opened.", "remote", second.LocalAddr().String(),
+		"Connection closed.", "remote", second.LocalAddr().String(), "duration", "", "bytesRead", "7", "bytesWritten", "7", "reason", "shutdown",
+	}
+	if diff := cmp.Diff(wantLogs, withoutDurations(logs)); diff != "" {
+		t.Errorf("serve() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+// withoutDurations returns the logs with the values of durations
+// removed, since they vary.
+func withoutDurations(logs []string) []string {
+	got := make([]string, len(logs))
+	copy(got, logs)
+	for i := range got {
+		if got[i] == "duration" && i+1 < len(got) {
+			got[i+1] = ""
+		}
+	}
+	return got
+}
+
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func roundTrip(t *testing.T, conn net.Conn, msg string) string {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return readLine(t, conn)
+}
+
+func readLine(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return line
+}
+
+func TestConnections_Shutdown(t *testing.T) {
+	var tests = []struct {
+		name    string
+		handler ConnHandlerFunc
+		want    int
+	}{
+		{
+			name: "handlers finish",
+			handler: func(ctx context.Context, conn net.Conn) {
+				<-ctx.Done()
+			},
+		},
+		{
+			name: "handlers do not finish",
+			handler: func(ctx context.Context, conn net.Conn) {
+				conn.Read(make([]byte, 1))
+			},
+			want: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := &server{
+				handler:  test.handler,
+				conns:    newConnections(0),
+				timeouts: newTimeouts(time.Minute, time.Minute, time.Minute),
+				log:      &mockLogger{logs: &[]string{}},
+			}
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			go srv.serve(l)
+
+			client := dial(t, l.Addr().String())
+			for srv.conns.count() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			got := srv.conns.shutdown(ctx)
+
+			if got != test.want {
+				t.Errorf("shutdown() = %d; want %d", got, test.want)
+			}
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := client.Read(make([]byte, 1)); err == nil {
+				t.Errorf("shutdown() = connection not closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Buckets of the histograms.
+var (
+	durationBuckets = []float64{0.01, 0.1, 1, 10, 60, 600, 3600}
+	sizeBuckets     = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+)
+
+// metrics holds the counters and histograms of the connections, messages,
+// packets and errors of the server. They are written in the Prometheus
+// text format. A nil metrics is a no-op.
+type metrics struct {
+	connections     atomic.Uint64
+	active          atomic.Int64
+	bytesRead       atomic.Uint64
+	bytesWritten    atomic.Uint64
+	messagesRead    atomic.Uint64
+	messagesWritten atomic.Uint64
+	packets         atomic.Uint64
+	bans            atomic.Uint64
+	rejections      *counterVec
+	errors          *counterVec
+	durations       *histogram
+	sizes           *histogram
+}
+
+// newMetrics returns a new metrics.
+func newMetrics() *metrics {
+	return &metrics{
+		rejections: newCounterVec(),
+		errors:     newCounterVec(),
+		durations:  newHistogram(durationBuckets),
+		sizes:      newHistogram(sizeBuckets),
+	}
+}
+
+// opened counts an opened connection.
+func (m *metrics) opened() {
+	if m == nil {
+		return
+	}
+	m.connections.Add(1)
+	m.active.Add(1)
+}
+
+// closed counts a closed connection that was open for d.
+func (m *metrics) closed(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.active.Add(-1)
+	m.durations.observe(d.Seconds())
+}
+
+// rejected counts a connection rejected for the reason.
+func (m *metrics) rejected(reason string) {
+	if m == nil {
+		return
+	}
+	m.rejections.inc(reason)
+}
+
+// banned counts a banned client.
+func (m *metrics) banned() {
+	if m == nil {
+		return
+	}
+	m.bans.Add(1)
+}
+
+// read counts n bytes read from a connection.
+func (m *metrics) read(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.bytesRead.Add(uint64(n))
+}
+
+// written counts n bytes written to a connection.
+func (m *metrics) written(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.bytesWritten.Add(uint64(n))
+}
+
+// messageRead counts a message of n bytes read from a connection, or an
+// error if the message could not be framed.
+func (m *metrics) messageRead(n int, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		if isMessageError(err) {
+			m.error("message")
+		}
+		return
+	}
+	m.messagesRead.Add(1)
+	m.sizes.observe(float64(n))
+}
+
+// messageWritten counts a message written to a connection, or an error
+// if the message could not be framed.
+func (m *metrics) messageWritten(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		if isMessageError(err) {
+			m.error("message")
+		}
+		return
+	}
+	m.messagesWritten.Add(1)
+}
+
+// packet counts a packet.
+func (m *metrics) packet() {
+	if m == nil {
+		return
+	}
+	m.packets.Add(1)
+}
+
+// error counts an error of the type.
+func (m *metrics) error(typ string) {
+	if m == nil {
+		return
+	}
+	m.errors.inc(typ)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	writeMetric(&b, "server_connections_total", "counter", "Number of accepted connections.", m.connections.Load())
+	writeMetric(&b, "server_connections_active", "gauge", "Number of open connections.", m.active.Load())
+	m.rejections.write(&b, "server_connections_rejected_total", "Number of rejected connections by reason.", "reason")
+	writeMetric(&b, "server_bans_total", "counter", "Number of banned clients.", m.bans.Load())
+	m.durations.write(&b, "server_connection_duration_seconds", "Duration of closed connections.")
+	writeMetric(&b, "server_read_bytes_total", "counter", "Number of bytes read from connections.", m.bytesRead.Load())
+	writeMetric(&b, "server_written_bytes_total", "counter", "Number of bytes written to connections.", m.bytesWritten.Load())
+	writeMetric(&b, "server_messages_read_total", "counter", "Number of messages read from connections.", m.messagesRead.Load())
+	writeMetric(&b, "server_messages_written_total", "counter", "Number of messages written to connections.", m.messagesWritten.Load())
+	m.sizes.write(&b, "server_message_size_bytes", "Size of messages read from connections.")
+	writeMetric(&b, "server_packets_total", "counter", "Number of packets received.", m.packets.Load())
+	m.errors.write(&b, "server_errors_total", "Number of errors by type.", "type")
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// serveMetrics serves the metrics of the server on GET /metrics on the
+// listener until it is closed.
+func (s server) serveMetrics(l net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	if err := srv.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.log.Error("Failed to serve metrics.", "error", err)
+	}
+}
+
+// isMessageError returns true if the error is from framing a message,
+// and not from the connection.
+func isMessageError(err error) bool {
+	return errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrInvalidMessage)
+}
+
+// writeMetric writes a metric with a single value.
+func writeMetric[T uint64 | int64](b *strings.Builder, name, typ, help string, value T) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, value)
+}
+
+// counterVec is a set of counters by label.
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// newCounterVec returns a new counterVec.
+func newCounterVec() *counterVec {
+	return &counterVec{values: make(map[string]uint64)}
+}
+
+// inc increments the counter of the label.
+func (c *counterVec) inc(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[label]++
+}
+
+// write writes the counters, sorted by label.
+func (c *counterVec) write(b *strings.Builder, name, help, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	labels := make([]string, 0, len(c.values))
+	for label := range c.values {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	for _, label := range labels {
+		fmt.Fprintf(b, "%s{%s=%q} %d\n", name, key, label, c.values[label])
+	}
+}
+
+// histogram counts observations in buckets with upper bounds.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogram returns a new histogram with the upper bounds of its
+// buckets, in increasing order.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// observe adds the value to the histogram.
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the cumulative buckets, the sum and the count of the
+// histogram.
+func (h *histogram) write(b *strings.Builder, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetrics_WriteTo(t *testing.T) {
+	m := newMetrics()
+	m.opened()
+	m.opened()
+	m.closed(500 * time.Millisecond)
+	m.read(10)
+	m.written(5)
+	m.messageRead(100, nil)
+	m.messageRead(0, ErrMessageTooLarge)
+	m.messageRead(0, io.EOF)
+	m.messageWritten(nil)
+	m.packet()
+	m.error("accept")
+
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() = unexpected error: %v", err)
+	}
+
+	want := []string{
+		"server_connections_total 2",
+		"server_connections_active 1",
+		`server_connection_duration_seconds_bucket{le="0.1"} 0`,
+		`server_connection_duration_seconds_bucket{le="1"} 1`,
+		`server_connection_duration_seconds_bucket{le="+Inf"} 1`,
+		"server_connection_duration_seconds_sum 0.5",
+		"server_connection_duration_seconds_count 1",
+		"server_read_bytes_total 10",
+		"server_written_bytes_total 5",
+		"server_messages_read_total 1",
+		"server_messages_written_total 1",
+		`server_message_size_bytes_bucket{le="64"} 0`,
+		`server_message_size_bytes_bucket{le="256"} 1`,
+		"server_packets_total 1",
+		`server_errors_total{type="accept"} 1`,
+		`server_errors_total{type="message"} 1`,
+	}
+	lines := strings.Split(b.String(), "\n")
+	for _, line := range want {
+		if !slices.Contains(lines, line) {
+			t.Errorf("WriteTo() = missing %q in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *metrics
+	m.opened()
+	m.closed(time.Second)
+	m.read(1)
+	m.written(1)
+	m.messageRead(1, nil)
+	m.messageWritten(nil)
+	m.packet()
+	m.error("accept")
+}
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := newMetrics()
+	m.opened()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if diff := cmp.Diff("text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type")); diff != "" {
+		t.Errorf("ServeHTTP() = unexpected content type (-want +got):\n%s\n", diff)
+	}
+	if !slices.Contains(strings.Split(rec.Body.String(), "\n"), "server_connections_total 1") {
+		t.Errorf("ServeHTTP() = unexpected body:\n%s", rec.Body.String())
+	}
+}
+
+func TestConn_Metrics(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	m := newMetrics()
+	c := NewConn(newConn(server, newTimeouts(0, 0, 0), m), NewLineCodec(CodecOptions{}))
+	go func() {
+		client.Write([]byte("hello\n"))
+		io.Copy(io.Discard, client)
+	}()
+
+	msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() = unexpected error: %v", err)
+	}
+	if err := c.WriteMessage(msg); err != nil {
+		t.Fatalf("WriteMessage() = unexpected error: %v", err)
+	}
+
+	got := []uint64{m.messagesRead.Load(), m.messagesWritten.Load(), m.bytesRead.Load(), m.bytesWritten.Load()}
+	if diff := cmp.Diff([]uint64{1, 1, 6, 6}, got); diff != "" {
+		t.Errorf("Conn = unexpected metrics (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestCloseReason(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var tests = []struct {
+		name  string
+		input struct {
+			ctx context.Context
+			err error
+		}
+		want string
+	}{
+		{
+			name: "closed by server",
+			input: struct {
+				ctx context.Context
+				err error
+			}{ctx: context.Background()},
+			want: "server",
+		},
+		{
+			name: "closed by client",
+			input: struct {
+				ctx context.Context
+				err error
+			}{ctx: context.Background(), err: io.EOF},
+			want: "client",
+		},
+		{
+			name: "timeout",
+			input: struct {
+				ctx context.Context
+				err error
+			}{ctx: context.Background(), err: os.ErrDeadlineExceeded},
+			want: "timeout",
+		},
+		{
+			name: "error",
+			input: struct {
+				ctx context.Context
+				err error
+			}{ctx: context.Background(), err: errors.New("error")},
+			want: "error",
+		},
+		{
+			name: "shutdown",
+			input: struct {
+				ctx context.Context
+				err error
+			}{ctx: cancelled, err: net.ErrClosed},
+			want: "shutdown",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := closeReason(test.input.ctx, test.input.err)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("closeReason() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
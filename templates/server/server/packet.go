@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+)
+
+// defaultReadBufferSize is the default size of the buffers that packets
+// are read into, the maximum size of a UDP datagram.
+const defaultReadBufferSize = 65535
+
+// PacketHandler handles a packet received by the server. The context is
+// cancelled when the server is stopped. Replies are written to addr with
+// conn. The data is only valid until ServePacket returns, since its
+// buffer is reused.
+type PacketHandler interface {
+	ServePacket(ctx context.Context, conn net.PacketConn, data []byte, addr net.Addr)
+}
+
+// PacketHandlerFunc is an adapter to allow the use of ordinary functions
+// as a PacketHandler.
+type PacketHandlerFunc func(ctx context.Context, conn net.PacketConn, data []byte, addr net.Addr)
+
+// ServePacket calls f(ctx, conn, data, addr).
+func (f PacketHandlerFunc) ServePacket(ctx context.Context, conn net.PacketConn, data []byte, addr net.Addr) {
+	f(ctx, conn, data, addr)
+}
+
+// packet is a packet read into a buffer from the pool.
+type packet struct {
+	buf  *[]byte
+	n    int
+	addr net.Addr
+}
+
+// packets handles the packets of a packet connection with a pool of
+// workers, and reads them into buffers from a pool. A nil packets is
+// a no-op.
+type packets struct {
+	mu      sync.Mutex
+	conn    net.PacketConn
+	workers int
+	buffers sync.Pool
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// newPackets returns a new packets with the number of workers, or the
+// number of CPUs if it is less than or equal to zero, and buffers of
+// size bytes.
+func newPackets(workers, size int) *packets {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if size <= 0 {
+		size = defaultReadBufferSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &packets{
+		workers: workers,
+		buffers: sync.Pool{
+			New: func() any {
+				b := make([]byte, size)
+				return &b
+			},
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// listen sets the packet connection that is closed on shutdown, and
+// adds the workers. It returns false and closes the connection if the
+// packets are already shut down.
+func (p *packets) listen(conn net.PacketConn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx.Err() != nil {
+		conn.Close()
+		return false
+	}
+	p.conn = conn
+	p.wg.Add(p.workers)
+	return true
+}
+
+// shutdown closes the packet connection, cancels the context of the
+// handlers and waits for the workers to handle the packets that have
+// been read, until the context is done. It returns false if they did
+// not finish.
+func (p *packets) shutdown(ctx context.Context) bool {
+	if p == nil {
+		return true
+	}
+	p.cancel()
+	p.mu.Lock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// servePackets reads packets from the connection and handles them with
+// the workers, until the packets are shut down. Reads wait while all
+// workers are busy, and the operating system drops packets when its
+// receive buffer is full.
+func (s server) servePackets(conn net.PacketConn) error {
+	if !s.packets.listen(conn) {
+		return nil
+	}
+	queue := make(chan packet, s.packets.workers)
+	defer close(queue)
+	for i := 0; i < s.packets.workers; i++ {
+		go s.packetWorker(conn, queue)
+	}
+
+	for {
+		buf := s.packets.buffers.Get().(*[]byte)
+		n, addr, err := conn.ReadFrom(*buf)
+		if err != nil {
+			s.packets.buffers.Put(buf)
+			if s.packets.ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			s.metrics.error("packet")
+			s.log.Error("Failed to read packet.", "error", err)
+			continue
+		}
+		s.metrics.packet()
+		queue <- packet{buf: buf, n: n, addr: addr}
+	}
+}
+
+// packetWorker handles the packets in the queue until it is closed.
+func (s server) packetWorker(conn net.PacketConn, queue <-chan packet) {
+	defer s.packets.wg.Done()
+	for p := range queue {
+		s.handlePacket(conn, p)
+	}
+}
+
+// handlePacket handles the packet with the packet handler of the server,
+// and returns its buffer to the pool when the handler returns or panics.
+func (s server) handlePacket(conn net.PacketConn, p packet) {
+	defer s.packets.buffers.Put(p.buf)
+	defer func() {
+		if r := recover(); r != nil {
+			s.metrics.error("panic")
+			s.log.Error("Packet handler panicked.", "remote", p.addr.String(), "error", fmt.Errorf("%v", r))
+		}
+	}()
+	s.packetHandler.ServePacket(s.packets.ctx, conn, (*p.buf)[:p.n], p.addr)
+}
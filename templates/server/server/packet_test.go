@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_ServePackets(t *testing.T) {
+	logs := []string{}
+	srv := &server{
+		packetHandler: PacketHandlerFunc(func(ctx context.Context, conn net.PacketConn, data []byte, addr net.Addr) {
+			if string(data) == "panic" {
+				panic("handler error")
+			}
+			conn.WriteTo(data, addr)
+		}),
+		packets: newPackets(2, 8),
+		log:     &mockLogger{logs: &logs},
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.servePackets(conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(time.Second))
+
+	// Packets larger than the read buffer are truncated.
+	got := []string{}
+	for _, msg := range []string{"panic", "first", "second packet"} {
+		client.Write([]byte(msg))
+		if msg == "panic" {
+			continue
+		}
+		b := make([]byte, 64)
+		n, err := client.Read(b)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, string(b[:n]))
+	}
+	if diff := cmp.Diff([]string{"first", "second p"}, got); diff != "" {
+		t.Errorf("servePackets() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !srv.packets.shutdown(ctx) {
+		t.Errorf("shutdown() = false; want true")
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("servePackets() = unexpected error: %v", err)
+	}
+
+	wantLogs := []string{"Packet handler panicked.", "remote", client.LocalAddr().String(), "error", "handler error"}
+	if diff := cmp.Diff(wantLogs, logs); diff != "" {
+		t.Errorf("servePackets() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestPackets_Shutdown(t *testing.T) {
+	var p *packets
+	if !p.shutdown(context.Background()) {
+		t.Errorf("shutdown() = false; want true")
+	}
+
+	p = newPackets(1, 0)
+	p.shutdown(context.Background())
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.listen(conn) {
+		t.Errorf("listen() = true; want false")
+	}
+	if _, _, err := conn.ReadFrom(make([]byte, 1)); err == nil {
+		t.Errorf("listen() = connection not closed")
+	}
+}
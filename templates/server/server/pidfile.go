@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrLocked is returned when the PID file is locked by another
+// instance.
+var ErrLocked = errors.New("another instance is running")
+
+// pidFile is a PID file with an exclusive lock, so that only a single
+// instance runs with the same PID file. The lock is released by the
+// operating system when the process exits, so a PID file left behind
+// by a crashed process is not locked. The file is only locked on unix
+// platforms, on other platforms it is written but not locked. A nil
+// pidFile is a no-op.
+type pidFile struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newPIDFile returns a new pidFile for the path, or nil if the path
+// is empty.
+func newPIDFile(path string) *pidFile {
+	if len(path) == 0 {
+		return nil
+	}
+	return &pidFile{path: path}
+}
+
+// lock the PID file and write the PID of the process to it. It returns
+// the PID of a crashed process that left the file behind, or 0, and
+// ErrLocked if another instance holds the lock.
+func (p *pidFile) lock() (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		f, err := os.OpenFile(p.path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return 0, err
+		}
+		locked, err := tryLock(f)
+		if err != nil || !locked {
+			pid := readPID(f)
+			f.Close()
+			if err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("%w: %s is locked by pid %d", ErrLocked, p.path, pid)
+		}
+
+		// The file may have been removed by the instance that held the
+		// lock, in which case the lock is on a file that no longer
+		// exists, and the file is opened again.
+		if !samePath(f, p.path) {
+			f.Close()
+			continue
+		}
+
+		stale := readPID(f)
+		if err := writePID(f, os.Getpid()); err != nil {
+			f.Close()
+			return 0, err
+		}
+		p.file = f
+		return stale, nil
+	}
+}
+
+// unlock removes and unlocks the PID file.
+func (p *pidFile) unlock() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return nil
+	}
+
+	err := removeAndUnlock(p.file, p.path)
+	p.file = nil
+	return err
+}
+
+// readPID reads the PID in the file, or 0 if there is none.
+func readPID(f *os.File) int {
+	b := make([]byte, 32)
+	n, _ := f.ReadAt(b, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// writePID replaces the content of the file with the PID.
+func writePID(f *os.File, pid int) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(pid)+"\n"), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// samePath reports if the open file is the file at the path.
+func samePath(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
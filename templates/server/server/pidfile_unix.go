@@ -0,0 +1,26 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive lock of the file without blocking. It
+// returns false if the file is locked by another process.
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// removeAndUnlock removes the file at the path and then unlocks it by
+// closing it, so that another instance does not lock a removed file.
+func removeAndUnlock(f *os.File, path string) error {
+	err := os.Remove(path)
+	return errors.Join(err, f.Close())
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultProxyHeaderTimeout is the default timeout for reading a PROXY
+// protocol header.
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// proxySignature is the signature of a PROXY protocol v2 header.
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidProxyHeader is returned when a connection from a trusted
+// source does not start with a valid PROXY protocol header.
+var ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// ProxyOptions holds the options for the PROXY protocol.
+type ProxyOptions struct {
+	// Trusted is the CIDRs of the load balancers that send a PROXY
+	// protocol header. Connections from other sources are used as they
+	// are. The PROXY protocol is disabled if it is empty.
+	Trusted []string
+	// HeaderTimeout is the maximum duration for reading the header.
+	// Defaults to 5 seconds.
+	HeaderTimeout time.Duration
+}
+
+// isEmpty returns true if the ProxyOptions are empty.
+func (o ProxyOptions) isEmpty() bool {
+	return len(o.Trusted) == 0
+}
+
+// ProxyHeader is a PROXY protocol header, with the addresses of the
+// original connection to the load balancer.
+type ProxyHeader struct {
+	// Version of the header, 1 or 2.
+	Version int
+	// Local is true for connections from the load balancer itself, such
+	// as health checks, that have no original addresses.
+	Local bool
+	// Source is the address of the client.
+	Source net.Addr
+	// Destination is the address the client connected to.
+	Destination net.Addr
+	// TLVs are the type-length-value fields of a version 2 header.
+	TLVs []ProxyTLV
+}
+
+// ProxyTLV is a type-length-value field of a PROXY protocol v2 header.
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyHeaderFromConn returns the PROXY protocol header of the
+// connection, and false if it has none.
+func ProxyHeaderFromConn(conn net.Conn) (*ProxyHeader, bool) {
+	for {
+		switch c := conn.(type) {
+		case *proxyConn:
+			if err := c.readHeader(); err != nil || c.header == nil {
+				return nil, false
+			}
+			return c.header, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// proxyListener is a net.Listener for connections that start with a
+// PROXY protocol header when they are from a trusted source.
+type proxyListener struct {
+	net.Listener
+	trusted []netip.Prefix
+	timeout time.Duration
+}
+
+// newProxyListener returns a listener that reads the PROXY protocol
+// header of connections from trusted sources.
+func newProxyListener(l net.Listener, options ProxyOptions) (net.Listener, error) {
+	pl := &proxyListener{Listener: l, timeout: options.HeaderTimeout}
+	for _, cidr := range options.Trusted {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		pl.trusted = append(pl.trusted, prefix.Masked())
+	}
+	if pl.timeout <= 0 {
+		pl.timeout = defaultProxyHeaderTimeout
+	}
+	return pl, nil
+}
+
+// Accept waits for and returns the next connection. The header is read
+// when the connection is first read from or its addresses are used, so
+// that a slow client does not block the listener.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, r: bufio.NewReader(conn), timeout: l.timeout}, nil
+}
+
+// isTrusted returns true if the address is in a trusted CIDR.
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range l.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn is a connection that starts with a PROXY protocol header.
+// The addresses of the header are its remote and local addresses.
+type proxyConn struct {
+	net.Conn
+	r        *bufio.Reader
+	timeout  time.Duration
+	once     sync.Once
+	header   *ProxyHeader
+	err      error
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// readHeader reads the header once, with the header timeout. The read
+// deadline set by the user of the connection is then restored.
+func (c *proxyConn) readHeader() error {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.header, c.err = readProxyHeader(c.r)
+		c.mu.Lock()
+		c.Conn.SetReadDeadline(c.deadline)
+		c.mu.Unlock()
+	})
+	return c.err
+}
+
+// Read reads from the connection after the header.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the remote
+// address of the connection if it has none.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.readHeader() == nil && c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, or the local
+// address of the connection if it has none.
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.readHeader() == nil && c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// NetConn returns the underlying connection.
+func (c *proxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header.
+func readProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	b, err := r.Peek(len(proxySignature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+	}
+	if bytes.Equal(b, proxySignature) {
+		return readProxyHeaderV2(r)
+	}
+	if bytes.HasPrefix(b, []byte("PROXY ")) {
+		return readProxyHeaderV1(r)
+	}
+	return nil, ErrInvalidProxyHeader
+}
+
+// readProxyHeaderV1 reads a PROXY protocol v1 header, a line of at most
+// 107 bytes such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyHeaderV1(r *bufio.Reader) (*ProxyHeader, error) {
+	var line []byte
+	for len(line) < 107 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: line not terminated", ErrInvalidProxyHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	header := &ProxyHeader{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		header.Local = true
+		return header, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidProxyHeader, line)
+	}
+
+	src, err := parseProxyAddr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseProxyAddr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	header.Source, header.Destination = src, dst
+	return header, nil
+}
+
+// parseProxyAddr parses the IP address and port of a v1 header.
+func parseProxyAddr(ip, port string, v4 bool) (net.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != v4 {
+		return nil, fmt.Errorf("%w: invalid address %q", ErrInvalidProxyHeader, ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %q", ErrInvalidProxyHeader, port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+}
+
+// readProxyHeaderV2 reads a PROXY protocol v2 header: the signature,
+// the version and command, the address family and protocol, and the
+// length of the addresses and TLVs that follow.
+func readProxyHeaderV2(r *bufio.Reader) (*ProxyHeader, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+	}
+	if b[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidProxyHeader, b[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(b[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxyHeader, err)
+	}
+
+	header := &ProxyHeader{Version: 2}
+	switch b[12] & 0x0f {
+	case 0x0:
+		header.Local = true
+		return header, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", ErrInvalidProxyHeader, b[12]&0x0f)
+	}
+
+	var n int
+	switch b[13] {
+	case 0x11, 0x12:
+		n = 4
+	case 0x21, 0x22:
+		n = 16
+	case 0x31, 0x32:
+		// Unix sockets have no addresses to use.
+		if len(payload) < 216 {
+			return nil, fmt.Errorf("%w: short addresses", ErrInvalidProxyHeader)
+		}
+		payload = payload[216:]
+	case 0x00:
+	default:
+		return nil, fmt.Errorf("%w: unsupported address family %#x", ErrInvalidProxyHeader, b[13])
+	}
+	if n > 0 {
+		if len(payload) < 2*n+4 {
+			return nil, fmt.Errorf("%w: short addresses", ErrInvalidProxyHeader)
+		}
+		src, _ := netip.AddrFromSlice(payload[:n])
+		dst, _ := netip.AddrFromSlice(payload[n : 2*n])
+		srcPort := binary.BigEndian.Uint16(payload[2*n:])
+		dstPort := binary.BigEndian.Uint16(payload[2*n+2:])
+		header.Source = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, srcPort))
+		header.Destination = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, dstPort))
+		payload = payload[2*n+4:]
+	}
+
+	for len(payload) > 0 {
+		if len(payload) < 3 {
+			return nil, fmt.Errorf("%w: short TLV", ErrInvalidProxyHeader)
+		}
+		size := int(binary.BigEndian.Uint16(payload[1:3]))
+		if len(payload) < 3+size {
+			return nil, fmt.Errorf("%w: short TLV", ErrInvalidProxyHeader)
+		}
+		header.TLVs = append(header.TLVs, ProxyTLV{Type: payload[0], Value: payload[3 : 3+size]})
+		payload = payload[3+size:]
+	}
+	return header, nil
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := func(cmd, fam byte, payload string) string {
+		return string(proxySignature) + string([]byte{0x20 | cmd, fam, 0, byte(len(payload))}) + payload
+	}
+
+	var tests = []struct {
+		name    string
+		input   string
+		want    *ProxyHeader
+		wantErr error
+	}{
+		{
+			name:  "v1 TCP4",
+			input: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\ndata",
+			want: &ProxyHeader{
+				Version:     1,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("192.0.2.2").To4(), Port: 443},
+			},
+		},
+		{
+			name:  "v1 TCP6",
+			input: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n",
+			want: &ProxyHeader{
+				Version:     1,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+			},
+		},
+		{
+			name:  "v1 UNKNOWN",
+			input: "PROXY UNKNOWN\r\n",
+			want:  &ProxyHeader{Version: 1, Local: true},
+		},
+		{
+			name:  "v2 TCP4 with TLV",
+			input: v2(0x1, 0x11, "\xc0\x00\x02\x01\xc0\x00\x02\x02\xdc\x04\x01\xbb\x01\x00\x02h2"),
+			want: &ProxyHeader{
+				Version:     2,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("192.0.2.2").To4(), Port: 443},
+				TLVs:        []ProxyTLV{{Type: 0x01, Value: []byte("h2")}},
+			},
+		},
+		{
+			name:  "v2 TCP6",
+			input: v2(0x1, 0x21, "\x20\x01\x0d\xb8"+strings.Repeat("\x00", 11)+"\x01\x20\x01\x0d\xb8"+strings.Repeat("\x00", 11)+"\x02\xdc\x04\x01\xbb"),
+			want: &ProxyHeader{
+				Version:     2,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+			},
+		},
+		{
+			name:  "v2 LOCAL",
+			input: v2(0x0, 0x00, ""),
+			want:  &ProxyHeader{Version: 2, Local: true},
+		},
+		{
+			name:    "no header",
+			input:   "GET / HTTP/1.1\r\n\r\n",
+			wantErr: ErrInvalidProxyHeader,
+		},
+		{
+			name:    "v1 not terminated",
+			input:   "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\n",
+			wantErr: ErrInvalidProxyHeader,
+		},
+		{
+			name:    "v1 invalid address",
+			input:   "PROXY TCP4 2001:db8::1 192.0.2.2 56324 443\r\n",
+			wantErr: ErrInvalidProxyHeader,
+		},
+		{
+			name:    "v2 short addresses",
+			input:   v2(0x1, 0x11, "\xc0\x00\x02\x01"),
+			wantErr: ErrInvalidProxyHeader,
+		},
+		{
+			name:    "v2 short TLV",
+			input:   v2(0x1, 0x11, "\xc0\x00\x02\x01\xc0\x00\x02\x02\xdc\x04\x01\xbb\x01\x00\x05h2"),
+			wantErr: ErrInvalidProxyHeader,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotErr := readProxyHeader(bufio.NewReader(strings.NewReader(test.input)))
+
+			if !errors.Is(gotErr, test.wantErr) {
+				t.Errorf("readProxyHeader() = %v; want %v", gotErr, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("readProxyHeader() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	var tests = []struct {
+		name       string
+		trusted    []string
+		input      string
+		wantRemote string
+		wantData   string
+		wantErr    error
+	}{
+		{
+			name:       "trusted",
+			trusted:    []string{"127.0.0.0/8"},
+			input:      "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\ndata",
+			wantRemote: "192.0.2.1:56324",
+			wantData:   "data",
+		},
+		{
+			name:     "not trusted",
+			trusted:  []string{"10.0.0.0/8"},
+			input:    "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\ndata",
+			wantData: "PROXY TCP4",
+		},
+		{
+			name:    "trusted without header",
+			trusted: []string{"127.0.0.0/8"},
+			input:   "data without header",
+			wantErr: ErrInvalidProxyHeader,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			l, err = newProxyListener(l, ProxyOptions{Trusted: test.trusted})
+			if err != nil {
+				t.Fatalf("newProxyListener() = unexpected error: %v", err)
+			}
+			defer l.Close()
+
+			client := dial(t, l.Addr().String())
+			client.Write([]byte(test.input))
+
+			conn, err := l.Accept()
+			if err != nil {
+				t.Fatalf("Accept() = unexpected error: %v", err)
+			}
+			defer conn.Close()
+
+			b := make([]byte, len(test.wantData))
+			_, gotErr := conn.Read(b)
+			if !errors.Is(gotErr, test.wantErr) {
+				t.Errorf("Read() = %v; want %v", gotErr, test.wantErr)
+			}
+			if gotErr != nil {
+				return
+			}
+			if diff := cmp.Diff(test.wantData, string(b)); diff != "" {
+				t.Errorf("Read() = unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			wantRemote := test.wantRemote
+			if len(wantRemote) == 0 {
+				wantRemote = client.LocalAddr().String()
+			}
+			if diff := cmp.Diff(wantRemote, conn.RemoteAddr().String()); diff != "" {
+				t.Errorf("RemoteAddr() = unexpected result (-want +got):\n%s\n", diff)
+			}
+			_, ok := ProxyHeaderFromConn(conn)
+			if ok != (len(test.wantRemote) > 0) {
+				t.Errorf("ProxyHeaderFromConn() = %t; want %t", ok, !ok)
+			}
+		})
+	}
+}
+
+func TestProxyListener_HeaderTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l, _ = newProxyListener(l, ProxyOptions{Trusted: []string{"127.0.0.1/32"}, HeaderTimeout: 20 * time.Millisecond})
+	defer l.Close()
+
+	dial(t, l.Addr().String())
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept() = unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Minute))
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, ErrInvalidProxyHeader) {
+		t.Errorf("Read() = %v; want %v", err, ErrInvalidProxyHeader)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read() = returned after %s; want header timeout", elapsed)
+	}
+}
+
+func TestNewProxyListener(t *testing.T) {
+	if _, err := newProxyListener(nil, ProxyOptions{Trusted: []string{"10.0.0.1"}}); err == nil {
+		t.Errorf("newProxyListener() = nil; want error")
+	}
+}
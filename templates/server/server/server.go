@@ -1,21 +1,105 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
+
+	"github.com/RedeployAB/go-template/templates/server/version"
+)
+
+// Defaults for server configuration.
+const (
+	defaultHost            = "0.0.0.0"
+	defaultPort            = "8080"
+	defaultReadTimeout     = 15 * time.Second
+	defaultWriteTimeout    = 15 * time.Second
+	defaultIdleTimeout     = 30 * time.Second
+	defaultMaxConnections  = 1000
+	defaultShutdownTimeout = 15 * time.Second
 )
 
-// server ...
+// server is a TCP server that handles connections with a ConnHandler.
 type server struct {
-	log    logger
-	stopCh chan os.Signal
-	errCh  chan error
+	addr            string
+	handler         ConnHandler
+	packetHandler   PacketHandler
+	protocols       map[string]ConnHandler
+	tls             TLSConfig
+	conns           *connections
+	metrics         *metrics
+	metricsAddress  string
+	limits          LimitOptions
+	limiter         *limiter
+	packets         *packets
+	proxy           ProxyOptions
+	timeouts        *timeouts
+	shutdownTimeout time.Duration
+	log             logger
+	level           *slog.LevelVar
+	statusSocket    string
+	notifier        *notifier
+	pidFile         *pidFile
+	stopCh          chan os.Signal
+	errCh           chan error
+}
+
+// TLSConfig holds the configuration for the server's TLS settings.
+// Certificate and Key are either paths to PEM encoded files, or PEM
+// encoded data. Certificates loaded from files are reloaded when the
+// files change. ClientCA is the CAs of client certificates, as a path or
+// PEM encoded data, and when it is set clients must present a
+// certificate signed by one of them.
+type TLSConfig struct {
+	Certificate string
+	Key         string
+	ClientCA    string
 }
 
-// Options holds the configuration for the server.
+// isEmpty returns true if the TLSConfig is empty.
+func (c TLSConfig) isEmpty() bool {
+	return len(c.Certificate) == 0 && len(c.Key) == 0
+}
+
+// Options holds the configuration for the server. Protocols are the
+// handlers of the application protocols negotiated with ALPN when the
+// server uses TLS, and Handler handles connections that negotiated none.
 type Options struct {
-	Logger logger
+	Handler         ConnHandler
+	Protocols       map[string]ConnHandler
+	PacketHandler   PacketHandler
+	TLSConfig       TLSConfig
+	Proxy           ProxyOptions
+	Logger          logger
+	LogLevel        *slog.LevelVar
+	Host            string
+	Port            int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	MaxConnections  int
+	Limits          LimitOptions
+	PacketWorkers   int
+	ReadBufferSize  int
+	ShutdownTimeout time.Duration
+	MetricsAddress  string
+	StatusSocket    string
+	PIDFile         string
+}
+
+// Settings holds the settings of the server that can be updated
+// while it is running.
+type Settings struct {
+	LogLevel     slog.Level
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
 }
 
 // Option is a function that configures the server.
@@ -24,13 +108,22 @@ type Option func(*server)
 // New returns a new server.
 func New(options ...Option) *server {
 	s := &server{
-		stopCh: make(chan os.Signal),
-		errCh:  make(chan error),
+		conns:           newConnections(defaultMaxConnections),
+		metrics:         newMetrics(),
+		packets:         newPackets(0, defaultReadBufferSize),
+		timeouts:        newTimeouts(defaultReadTimeout, defaultWriteTimeout, defaultIdleTimeout),
+		shutdownTimeout: defaultShutdownTimeout,
+		notifier:        newNotifier(),
+		stopCh:          make(chan os.Signal),
+		errCh:           make(chan error),
 	}
 	for _, option := range options {
 		option(s)
 	}
 
+	if len(s.addr) == 0 {
+		s.addr = defaultHost + ":" + defaultPort
+	}
 	if s.log == nil {
 		s.log = NewLogger()
 	}
@@ -38,18 +131,84 @@ func New(options ...Option) *server {
 	return s
 }
 
-// Start the server.
+// Start the server. With a handler it listens for TCP connections on
+// the configured address, with TLS if it is configured, and handles
+// every connection in a new goroutine, and with a packet handler it
+// listens for UDP packets on the same address and handles them with a
+// pool of workers. The metrics are served on the metrics address if it
+// is configured. When it is started, systemd is notified that the
+// server is ready. If the server is configured with a PID file, it is
+// locked before anything else is started, and ErrLocked is returned if
+// another instance holds the lock. The logger is closed when the server
+// stops, if it can be closed.
 func (s server) Start() error {
-	go func() {
-		// Add server startup code here.
-		// Send errors to s.errCh.
-	}()
+	defer closeLogger(s.log)
+	if s.handler == nil && len(s.protocols) == 0 && s.packetHandler == nil {
+		return ErrNoHandler
+	}
+
+	stale, err := s.pidFile.lock()
+	if err != nil {
+		return err
+	}
+	defer s.unlockPIDFile()
+	if stale > 0 {
+		s.log.Info("Removed stale PID file.", "pid", stale)
+	}
+
+	if len(s.statusSocket) > 0 {
+		l, err := net.Listen("unix", s.statusSocket)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go s.serveStatus(l)
+	}
+
+	if len(s.metricsAddress) > 0 {
+		l, err := net.Listen("tcp", s.metricsAddress)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go s.serveMetrics(l)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.notifier.watchdog(done, func() bool { return s.status() == statusOK }, s.log)
+
+	if s.handler != nil || len(s.protocols) > 0 {
+		l, err := s.listen()
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go func() {
+			if err := s.serve(l); err != nil {
+				s.errCh <- err
+			}
+		}()
+	}
+	if s.packetHandler != nil {
+		conn, err := net.ListenPacket("udp", s.addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		go func() {
+			if err := s.servePackets(conn); err != nil {
+				s.errCh <- err
+			}
+		}()
+	}
+	s.notify(sdReady)
 
 	go func() {
 		s.stop()
 	}()
 
-	s.log.Info("Server started.")
+	s.log.Info("Server started.", "address", s.addr, "version", version.Get().Version)
 	for {
 		select {
 		case err := <-s.errCh:
@@ -63,22 +222,141 @@ func (s server) Start() error {
 	}
 }
 
-// stop the server.
+// listen for TCP connections on the address of the server, with the
+// PROXY protocol and TLS if they are configured.
+func (s server) listen() (net.Listener, error) {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	if !s.proxy.isEmpty() {
+		pl, err := newProxyListener(l, s.proxy)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = pl
+	}
+	if !s.tls.isEmpty() {
+		config, err := s.tlsConfig()
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, config)
+	}
+	return l, nil
+}
+
+// Update the settings of the running server. The log level is only
+// updated if the server is configured with a LogLevel. Timeouts less
+// than or equal to zero are ignored.
+func (s server) Update(settings Settings) {
+	if s.level != nil {
+		s.level.Set(settings.LogLevel)
+	}
+	if s.timeouts != nil {
+		s.timeouts.set(settings.ReadTimeout, settings.WriteTimeout, settings.IdleTimeout)
+	}
+}
+
+// stop the server. New connections and packets are no longer accepted
+// and the contexts of the handlers are cancelled. Active connections
+// and packets that have been read are waited for until the shutdown
+// timeout, and the connections are then closed.
 func (s server) stop() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-stop
+	s.notify(sdStopping)
 
-	// Add server shutdown logic here.
-
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if n := s.conns.shutdown(ctx); n > 0 {
+		s.log.Error("Closed active connections after shutdown timeout.", "connections", n)
+	}
+	if !s.packets.shutdown(ctx) {
+		s.log.Error("Stopped before all packets were handled.")
+	}
+	s.unlockPIDFile()
 	s.stopCh <- sig
 }
 
+// unlockPIDFile removes and unlocks the PID file and logs errors.
+func (s server) unlockPIDFile() {
+	if err := s.pidFile.unlock(); err != nil {
+		s.log.Error("Failed to remove PID file.", "error", err)
+	}
+}
+
 // WithOptions configures the server with the given Options.
 func WithOptions(options Options) Option {
 	return func(s *server) {
+		if options.Handler != nil {
+			s.handler = options.Handler
+		}
+		if len(options.Protocols) > 0 {
+			s.protocols = options.Protocols
+		}
+		if options.PacketHandler != nil {
+			s.packetHandler = options.PacketHandler
+		}
+		if !options.TLSConfig.isEmpty() {
+			s.tls = options.TLSConfig
+		}
+		if !options.Proxy.isEmpty() {
+			s.proxy = options.Proxy
+		}
 		if options.Logger != nil {
 			s.log = options.Logger
 		}
+		if options.LogLevel != nil {
+			s.level = options.LogLevel
+		}
+		if len(options.Host) > 0 || options.Port > 0 {
+			s.addr = net.JoinHostPort(options.Host, strconv.Itoa(options.Port))
+		}
+		if options.ReadTimeout > 0 || options.WriteTimeout > 0 || options.IdleTimeout > 0 {
+			s.timeouts.set(options.ReadTimeout, options.WriteTimeout, options.IdleTimeout)
+		}
+		if options.MaxConnections != 0 {
+			s.conns = newConnections(options.MaxConnections)
+		}
+		if !options.Limits.isEmpty() {
+			s.limits = options.Limits
+			s.limiter = newLimiter(options.Limits)
+		}
+		if options.PacketWorkers > 0 || options.ReadBufferSize > 0 {
+			s.packets = newPackets(options.PacketWorkers, options.ReadBufferSize)
+		}
+		if options.ShutdownTimeout > 0 {
+			s.shutdownTimeout = options.ShutdownTimeout
+		}
+		if len(options.MetricsAddress) > 0 {
+			s.metricsAddress = options.MetricsAddress
+		}
+		if len(options.StatusSocket) > 0 {
+			s.statusSocket = options.StatusSocket
+		}
+		if len(options.PIDFile) > 0 {
+			s.pidFile = newPIDFile(options.PIDFile)
+		}
+	}
+}
+
+// newTLSConfig returns a new tls.Config.
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:               tls.VersionTLS13,
+		PreferServerCipherSuites: true,
+		CurvePreferences: []tls.CurveID{
+			tls.CurveP256,
+		},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
 	}
 }
@@ -1,12 +1,19 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/RedeployAB/go-template/templates/server/version"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
@@ -21,18 +28,52 @@ func TestNew(t *testing.T) {
 			name:  "default",
 			input: []Option{},
 			want: &server{
-				log: NewLogger(),
+				addr:            defaultHost + ":" + defaultPort,
+				timeouts:        newTimeouts(defaultReadTimeout, defaultWriteTimeout, defaultIdleTimeout),
+				shutdownTimeout: defaultShutdownTimeout,
+				log:             NewLogger(),
 			},
 		},
 		{
 			name: "with options",
+			input: []Option{
+				WithOptions(Options{
+					Logger:          NewLogger(),
+					Host:            "localhost",
+					Port:            8081,
+					ReadTimeout:     10 * time.Second,
+					WriteTimeout:    10 * time.Second,
+					IdleTimeout:     60 * time.Second,
+					ShutdownTimeout: 30 * time.Second,
+					MetricsAddress:  "127.0.0.1:9090",
+					StatusSocket:    "/run/server.sock",
+					PIDFile:         "/run/server.pid",
+				}),
+			},
+			want: &server{
+				addr:            "localhost:8081",
+				timeouts:        newTimeouts(10*time.Second, 10*time.Second, 60*time.Second),
+				metricsAddress:  "127.0.0.1:9090",
+				shutdownTimeout: 30 * time.Second,
+				log:             NewLogger(),
+				statusSocket:    "/run/server.sock",
+				pidFile:         &pidFile{path: "/run/server.pid"},
+			},
+		},
+		{
+			name: "with IPv6 host",
 			input: []Option{
 				WithOptions(Options{
 					Logger: NewLogger(),
+					Host:   "::",
+					Port:   8080,
 				}),
 			},
 			want: &server{
-				log: NewLogger(),
+				addr:            "[::]:8080",
+				timeouts:        newTimeouts(defaultReadTimeout, defaultWriteTimeout, defaultIdleTimeout),
+				shutdownTimeout: defaultShutdownTimeout,
+				log:             NewLogger(),
 			},
 		},
 	}
@@ -44,7 +85,7 @@ func TestNew(t *testing.T) {
 				t.Errorf("New(%v) = nil; want %v", test.input, test.want)
 			}
 
-			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(server{}), cmpopts.IgnoreUnexported(slog.Logger{}), cmpopts.IgnoreFields(server{}, "stopCh", "errCh")); diff != "" {
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(server{}, pidFile{}, timeouts{}), cmpopts.IgnoreUnexported(slog.Logger{}), cmpopts.IgnoreFields(pidFile{}, "mu"), cmpopts.IgnoreFields(timeouts{}, "mu"), cmpopts.IgnoreFields(server{}, "conns", "metrics", "packets", "stopCh", "errCh")); diff != "" {
 				t.Errorf("New(%v) = unexpected result (-want +got):\n%s\n", test.input, diff)
 			}
 		})
@@ -55,6 +96,9 @@ func TestServer_Start(t *testing.T) {
 	t.Run("start server", func(t *testing.T) {
 		logs := []string{}
 		srv := &server{
+			addr:    "127.0.0.1:0",
+			handler: ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {}),
+			conns:   newConnections(0),
 			log: &mockLogger{
 				logs: &logs,
 			},
@@ -69,6 +113,10 @@ func TestServer_Start(t *testing.T) {
 
 		want := []string{
 			"Server started.",
+			"address",
+			"127.0.0.1:0",
+			"version",
+			version.Get().Version,
 			"Server stopped.",
 			"reason",
 			"interrupt",
@@ -78,24 +126,138 @@ func TestServer_Start(t *testing.T) {
 			t.Errorf("Start() = unexpected result (-want +got):\n%s\n", diff)
 		}
 	})
+
+	t.Run("notify systemd", func(t *testing.T) {
+		socket, messages := listenNotify(t)
+		srv := &server{
+			addr:     "127.0.0.1:0",
+			handler:  ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {}),
+			conns:    newConnections(0),
+			log:      &mockLogger{logs: &[]string{}},
+			notifier: &notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}},
+			stopCh:   make(chan os.Signal),
+			errCh:    make(chan error),
+		}
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+		}()
+		srv.Start()
+
+		got := []string{<-messages, <-messages}
+		if diff := cmp.Diff([]string{sdReady, sdStopping}, got); diff != "" {
+			t.Errorf("Start() = unexpected notifications (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("two instances", func(t *testing.T) {
+		errCh := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			srv := New(WithOptions(Options{
+				Handler: ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {}),
+				Host:    "127.0.0.1",
+				Logger:  &mockLogger{logs: &[]string{}},
+			}))
+			go func() {
+				errCh <- srv.Start()
+			}()
+		}
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+		}()
+
+		for i := 0; i < 2; i++ {
+			if err := <-errCh; err != nil {
+				t.Errorf("Start() = unexpected error: %v", err)
+			}
+		}
+	})
+
+	t.Run("another instance is running", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "server.pid")
+		other := newPIDFile(path)
+		if _, err := other.lock(); err != nil {
+			t.Fatalf("lock() = unexpected error: %v", err)
+		}
+		defer other.unlock()
+
+		srv := New(WithOptions(Options{
+			Handler:      ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {}),
+			Logger:       &mockLogger{logs: &[]string{}},
+			StatusSocket: filepath.Join(t.TempDir(), "server.sock"),
+			PIDFile:      path,
+		}))
+
+		if err := srv.Start(); !errors.Is(err, ErrLocked) {
+			t.Errorf("Start() = %v; want %v", err, ErrLocked)
+		}
+	})
+
+	t.Run("without handler", func(t *testing.T) {
+		srv := New(WithOptions(Options{
+			Logger: &mockLogger{logs: &[]string{}},
+		}))
+
+		if err := srv.Start(); !errors.Is(err, ErrNoHandler) {
+			t.Errorf("Start() = %v; want %v", err, ErrNoHandler)
+		}
+	})
 }
 
 type mockLogger struct {
+	mu   sync.Mutex
 	logs *[]string
 }
 
 func (l *mockLogger) Info(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	messages := []string{msg}
 	for _, v := range args {
-		messages = append(messages, v.(string))
+		switch v := v.(type) {
+		case string:
+			messages = append(messages, v)
+		case int:
+			messages = append(messages, strconv.Itoa(v))
+		case error:
+			messages = append(messages, v.Error())
+		}
 	}
 	*l.logs = append(*l.logs, messages...)
 }
 
 func (l *mockLogger) Error(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	messages := []string{msg}
 	for _, v := range args {
-		messages = append(messages, v.(string))
+		switch v := v.(type) {
+		case string:
+			messages = append(messages, v)
+		case int:
+			messages = append(messages, strconv.Itoa(v))
+		case error:
+			messages = append(messages, v.Error())
+		}
 	}
 	*l.logs = append(*l.logs, messages...)
 }
+
+func TestServer_Update(t *testing.T) {
+	level := &slog.LevelVar{}
+	s := New(WithOptions(Options{
+		Logger:   NewLogger(WithLevel(level)),
+		LogLevel: level,
+	}))
+
+	s.Update(Settings{LogLevel: slog.LevelDebug, ReadTimeout: 5 * time.Second})
+
+	if diff := cmp.Diff(slog.LevelDebug, level.Level()); diff != "" {
+		t.Errorf("Update() = unexpected log level (-want +got):\n%s\n", diff)
+	}
+	read, write, idle := s.timeouts.get()
+	if diff := cmp.Diff([]time.Duration{5 * time.Second, defaultWriteTimeout, defaultIdleTimeout}, []time.Duration{read, write, idle}); diff != "" {
+		t.Errorf("Update() = unexpected timeouts (-want +got):\n%s\n", diff)
+	}
+}
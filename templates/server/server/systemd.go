@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sdReady tells systemd that the startup is complete.
+	sdReady = "READY=1"
+	// sdStopping tells systemd that the shutdown has begun.
+	sdStopping = "STOPPING=1"
+	// sdWatchdog resets the watchdog timer of systemd.
+	sdWatchdog = "WATCHDOG=1"
+	// sdStatus is the prefix of a free-form status.
+	sdStatus = "STATUS="
+)
+
+// notifier sends notifications to systemd with the sd_notify protocol,
+// datagrams to the socket in NOTIFY_SOCKET. A nil notifier is a no-op,
+// for when the process is not run by systemd with Type=notify.
+type notifier struct {
+	addr     *net.UnixAddr
+	interval time.Duration
+}
+
+// newNotifier returns a notifier for the socket in NOTIFY_SOCKET, or
+// nil if it is not set. The watchdog interval is half of WATCHDOG_USEC,
+// if it is set for this process.
+func newNotifier() *notifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if len(socket) == 0 {
+		return nil
+	}
+
+	n := &notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return n
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return n
+	}
+	n.interval = time.Duration(usec) * time.Microsecond / 2
+	return n
+}
+
+// notify sends the states to systemd.
+func (n *notifier) notify(states ...string) error {
+	if n == nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// watchdog sends watchdog pings at the watchdog interval while healthy
+// reports true, until done is closed. A ping that fails is logged, and
+// the next one is sent at the next interval. When pings are not sent,
+// systemd handles the process according to its WatchdogSec and Restart
+// settings.
+func (n *notifier) watchdog(done <-chan struct{}, healthy func() bool, log logger) {
+	if n == nil || n.interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !healthy() {
+				continue
+			}
+			if err := n.notify(sdWatchdog); err != nil {
+				log.Error("Failed to notify systemd.", "error", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// NotifyStatus sends a free-form status to systemd, shown by systemctl
+// status. It is a no-op when the server is not run by systemd.
+func (s server) NotifyStatus(status string) {
+	s.notify(sdStatus + status)
+}
+
+// notify sends the states to systemd and logs errors.
+func (s server) notify(states ...string) {
+	if err := s.notifier.notify(states...); err != nil {
+		s.log.Error("Failed to notify systemd.", "error", err)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewNotifier(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input map[string]string
+		want  *notifier
+	}{
+		{
+			name: "not run by systemd",
+		},
+		{
+			name: "without watchdog",
+			input: map[string]string{
+				"NOTIFY_SOCKET": "@notify",
+			},
+			want: &notifier{addr: &net.UnixAddr{Name: "@notify", Net: "unixgram"}},
+		},
+		{
+			name: "with watchdog",
+			input: map[string]string{
+				"NOTIFY_SOCKET": "/run/systemd/notify",
+				"WATCHDOG_USEC": "30000000",
+			},
+			want: &notifier{addr: &net.UnixAddr{Name: "/run/systemd/notify", Net: "unixgram"}, interval: 15 * time.Second},
+		},
+		{
+			name: "with watchdog for other process",
+			input: map[string]string{
+				"NOTIFY_SOCKET": "/run/systemd/notify",
+				"WATCHDOG_USEC": "30000000",
+				"WATCHDOG_PID":  "1",
+			},
+			want: &notifier{addr: &net.UnixAddr{Name: "/run/systemd/notify", Net: "unixgram"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"NOTIFY_SOCKET", "WATCHDOG_USEC", "WATCHDOG_PID"} {
+				t.Setenv(key, test.input[key])
+			}
+
+			got := newNotifier()
+
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(notifier{})); diff != "" {
+				t.Errorf("newNotifier() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	socket, messages := listenNotify(t)
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	n := newNotifier()
+	if err := n.notify(sdReady, sdStatus+"Running."); err != nil {
+		t.Fatalf("notify() = unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("READY=1\nSTATUS=Running.", <-messages); diff != "" {
+		t.Errorf("notify() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	var healthy atomic.Bool
+	done := make(chan struct{})
+	go n.watchdog(done, healthy.Load, &mockLogger{logs: &[]string{}})
+
+	select {
+	case msg := <-messages:
+		t.Errorf("watchdog() = %q; want no ping while not healthy", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	healthy.Store(true)
+	select {
+	case msg := <-messages:
+		if diff := cmp.Diff(sdWatchdog, msg); diff != "" {
+			t.Errorf("watchdog() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("watchdog() = no ping; want ping")
+	}
+	close(done)
+}
+
+func TestNotifier_Nil(t *testing.T) {
+	var n *notifier
+	if err := n.notify(sdReady); err != nil {
+		t.Errorf("notify() = unexpected error: %v", err)
+	}
+	n.watchdog(nil, nil, nil)
+}
+
+func TestNotifier_Watchdog_Error(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	n := &notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}, interval: 10 * time.Millisecond}
+
+	log := &mockLogger{logs: &[]string{}}
+	done := make(chan struct{})
+	defer close(done)
+	go n.watchdog(done, func() bool { return true }, log)
+	time.Sleep(50 * time.Millisecond)
+
+	// Pings are sent again when the socket can be reached.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 64)
+	m, err := conn.Read(b)
+	if err != nil {
+		t.Fatalf("watchdog() = no ping after failure: %v", err)
+	}
+
+	if diff := cmp.Diff(sdWatchdog, string(b[:m])); diff != "" {
+		t.Errorf("watchdog() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if len(*log.logs) == 0 || (*log.logs)[0] != "Failed to notify systemd." {
+		t.Errorf("watchdog() = unexpected logs: %v", *log.logs)
+	}
+}
+
+// listenNotify listens for notifications and returns the socket and
+// the received messages.
+func listenNotify(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		b := make([]byte, 4096)
+		for {
+			n, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			messages <- string(b[:n])
+		}
+	}()
+	return socket, messages
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"slices"
+)
+
+// TLSConnectionState returns the state of the TLS connection, with the
+// negotiated protocol and the certificates of the peer, and false if
+// the connection does not use TLS.
+func TLSConnectionState(conn net.Conn) (tls.ConnectionState, bool) {
+	for {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			return c.ConnectionState(), true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return tls.ConnectionState{}, false
+		}
+	}
+}
+
+// PeerCertificate returns the certificate that the peer of the TLS
+// connection presented, and false if it presented none or the
+// connection does not use TLS.
+func PeerCertificate(conn net.Conn) (*x509.Certificate, bool) {
+	state, ok := TLSConnectionState(conn)
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil, false
+	}
+	return state.PeerCertificates[0], true
+}
+
+// tlsConfig returns the tls.Config of the server, with the certificate,
+// the CAs of client certificates and the protocols of the handlers.
+func (s server) tlsConfig() (*tls.Config, error) {
+	cert, err := newCertificate(s.tls, s.log)
+	if err != nil {
+		return nil, err
+	}
+	config := newTLSConfig()
+	config.GetCertificate = cert.GetCertificate
+
+	if len(s.tls.ClientCA) > 0 {
+		b, err := readPEM(s.tls.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificates in TLS client CA")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(s.protocols) == 0 {
+		return config, nil
+	}
+	for protocol := range s.protocols {
+		config.NextProtos = append(config.NextProtos, protocol)
+	}
+	slices.Sort(config.NextProtos)
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		return s.negotiate(config, hello.SupportedProtos), nil
+	}
+	return config, nil
+}
+
+// negotiate returns the config with the protocols of the client that the
+// server has handlers for, in the order of preference of the client.
+// If there are none, the default handler is used if the server has one,
+// otherwise the handshake fails.
+func (s server) negotiate(config *tls.Config, protocols []string) *tls.Config {
+	var supported []string
+	for _, protocol := range protocols {
+		if _, ok := s.protocols[protocol]; ok {
+			supported = append(supported, protocol)
+		}
+	}
+	if len(supported) == 0 && s.handler == nil {
+		return nil
+	}
+	c := config.Clone()
+	c.GetConfigForClient = nil
+	c.NextProtos = supported
+	return c
+}
+
+// handshake performs the TLS handshake of the connection within the read
+// timeout, and returns the handler of the negotiated protocol, or the
+// default handler if no protocol was negotiated.
+func (s server) handshake(ctx context.Context, c *tls.Conn) (ConnHandler, error) {
+	if read, _, _ := s.timeouts.get(); read > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, read)
+		defer cancel()
+	}
+	if err := c.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	if handler, ok := s.protocols[c.ConnectionState().NegotiatedProtocol]; ok {
+		return handler, nil
+	}
+	return s.handler, nil
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_Serve_TLS(t *testing.T) {
+	certPEM, keyPEM := generateCertificate(t, "server")
+	reply := func(msg string) ConnHandler {
+		return ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {
+			conn.Write([]byte(msg + "\n"))
+		})
+	}
+
+	var tests = []struct {
+		name      string
+		handler   ConnHandler
+		protocols []string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "protocol of the client",
+			handler:   reply("default"),
+			protocols: []string{"b", "a"},
+			want:      "b\n",
+		},
+		{
+			name:    "no protocol",
+			handler: reply("default"),
+			want:    "default\n",
+		},
+		{
+			name:      "unsupported protocol",
+			handler:   reply("default"),
+			protocols: []string{"c"},
+			want:      "default\n",
+		},
+		{
+			name:      "unsupported protocol without default handler",
+			protocols: []string{"c"},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := []string{}
+			srv := &server{
+				addr:      "127.0.0.1:0",
+				handler:   test.handler,
+				protocols: map[string]ConnHandler{"a": reply("a"), "b": reply("b")},
+				tls:       TLSConfig{Certificate: string(certPEM), Key: string(keyPEM)},
+				conns:     newConnections(0),
+				timeouts:  newTimeouts(time.Second, time.Second, time.Second),
+				log:       &mockLogger{logs: &logs},
+			}
+			l := serveTLS(t, srv)
+
+			conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: test.protocols})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("serve() = unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			if diff := cmp.Diff(test.want, readLine(t, conn)); diff != "" {
+				t.Errorf("serve() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestServer_Serve_ClientCertificate(t *testing.T) {
+	certPEM, keyPEM := generateCertificate(t, "server")
+	clientCertPEM, clientKeyPEM := generateCertificate(t, "client")
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		name       string
+		certs      []tls.Certificate
+		want       string
+		wantReason string
+	}{
+		{
+			name:       "with client certificate",
+			certs:      []tls.Certificate{clientCert},
+			want:       "client\n",
+			wantReason: "server",
+		},
+		{
+			name:       "without client certificate",
+			wantReason: "handshake",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := []string{}
+			srv := &server{
+				addr: "127.0.0.1:0",
+				handler: ConnHandlerFunc(func(ctx context.Context, conn net.Conn) {
+					cert, ok := PeerCertificate(conn)
+					if !ok {
+						t.Errorf("PeerCertificate() = false; want true")
+						return
+					}
+					conn.Write([]byte(cert.Subject.CommonName + "\n"))
+				}),
+				tls:      TLSConfig{Certificate: string(certPEM), Key: string(keyPEM), ClientCA: string(clientCertPEM)},
+				conns:    newConnections(0),
+				timeouts: newTimeouts(time.Second, time.Second, time.Second),
+				log:      &mockLogger{logs: &logs},
+			}
+			l := serveTLS(t, srv)
+
+			conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, Certificates: test.certs})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(time.Second))
+			b := make([]byte, 16)
+			n, _ := conn.Read(b)
+			if diff := cmp.Diff(test.want, string(b[:n])); diff != "" {
+				t.Errorf("serve() = unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			srv.conns.shutdown(context.Background())
+			if diff := cmp.Diff(test.wantReason, logs[len(logs)-1]); diff != "" {
+				t.Errorf("serve() = unexpected close reason (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestTLSConnectionState(t *testing.T) {
+	t.Run("without TLS", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		if _, ok := TLSConnectionState(newConn(server, newTimeouts(0, 0, 0), nil)); ok {
+			t.Errorf("TLSConnectionState() = true; want false")
+		}
+		if _, ok := PeerCertificate(server); ok {
+			t.Errorf("PeerCertificate() = true; want false")
+		}
+	})
+}
+
+func serveTLS(t *testing.T, srv *server) net.Listener {
+	t.Helper()
+	l, err := srv.listen()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.serve(l)
+	}()
+	t.Cleanup(func() {
+		srv.conns.close()
+		if err := <-errCh; err != nil {
+			t.Errorf("serve() = unexpected error: %v", err)
+		}
+	})
+	return l
+}
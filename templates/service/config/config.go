@@ -0,0 +1,44 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// defaultEnvPrefix is the default prefix of the environment variables.
+const defaultEnvPrefix = "SERVICE"
+
+// Configuration contains the configuration for the application.
+type Configuration struct {
+	Log    Log    `config:"log"`
+	Status Status `config:"status"`
+	PID    PID    `config:"pid"`
+}
+
+// Log contains the logging configuration for the application.
+type Log struct {
+	Level slog.Level `config:"level" default:"info" usage:"Log level (debug, info, warn or error)."`
+}
+
+// Status contains the configuration of the status socket.
+type Status struct {
+	Socket string `config:"socket" restart:"true" usage:"Address of the status socket used by the healthcheck command, a leading @ is an abstract socket on Linux (disabled if empty)."`
+}
+
+// PID contains the configuration of the PID file.
+type PID struct {
+	File string `config:"file" restart:"true" usage:"Path of the PID file, locked to allow a single instance of the service (disabled if empty)."`
+}
+
+// New returns a new Configuration loaded from defaults, an optional
+// configuration file, environment variables and the command-line
+// arguments args, in that order of precedence.
+func New(args []string, options ...Option) (Configuration, error) {
+	cfg := Configuration{}
+	l := newLoader(filepath.Base(os.Args[0]), defaultEnvPrefix, options...)
+	if err := l.load(&cfg, args); err != nil {
+		return Configuration{}, err
+	}
+	return cfg, nil
+}
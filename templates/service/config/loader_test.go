@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testConfiguration struct {
+	Name    string        `config:"name" default:"default" usage:"Name."`
+	Port    int           `config:"port" default:"8080" restart:"true" usage:"Port."`
+	Timeout time.Duration `config:"timeout" default:"15s" usage:"Timeout."`
+	Debug   bool          `config:"debug" usage:"Debug."`
+	Origins []string      `config:"origins" usage:"Origins."`
+	TLS     struct {
+		CertificateFile string `config:"certificateFile" usage:"Certificate."`
+	} `config:"tls"`
+	Token    string `config:"token" required:"true" usage:"Token."`
+	Password Secret `config:"password" usage:"Password."`
+	ignored  string
+}
+
+func TestLoader_Load(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			args  []string
+			env   map[string]string
+			files map[string]string
+		}
+		want    testConfiguration
+		wantErr []string
+	}{
+		{
+			name: "defaults",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args: []string{"--token", "token"},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {}),
+		},
+		{
+			name: "file",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args: []string{"--config", "config.yaml"},
+				files: map[string]string{
+					"config.yaml": "name: file\nport: 8081\ntimeout: 10s\ndebug: true\norigins:\n  - a\n  - b\ntls:\n  certificateFile: cert.pem\ntoken: file\n",
+				},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {
+				c.Name, c.Port, c.Timeout, c.Debug, c.Origins, c.TLS.CertificateFile, c.Token = "file", 8081, 10*time.Second, true, []string{"a", "b"}, "cert.pem", "file"
+			}),
+		},
+		{
+			name: "JSON file from environment",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				env: map[string]string{"TEST_CONFIG_FILE": "config.json"},
+				files: map[string]string{
+					"config.json": `{"name": "file", "port": 8081, "tls": {"certificateFile": "cert.pem"}, "token": "file"}`,
+				},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {
+				c.Name, c.Port, c.TLS.CertificateFile, c.Token = "file", 8081, "cert.pem", "file"
+			}),
+		},
+		{
+			name: "precedence",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args: []string{"--config", "config.yaml", "--port", "8083", "--debug"},
+				env:  map[string]string{"TEST_PORT": "8082", "TEST_NAME": "env", "TEST_TLS_CERTIFICATE_FILE": "env.pem", "TEST_ORIGINS": "c,d"},
+				files: map[string]string{
+					"config.yaml": "name: file\nport: 8081\ntoken: file\n",
+				},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {
+				c.Name, c.Port, c.Debug, c.Origins, c.TLS.CertificateFile, c.Token = "env", 8083, true, []string{"c", "d"}, "env.pem", "file"
+			}),
+		},
+		{
+			name: "all errors",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args: []string{"--config", "config.yaml", "--timeout", "ten"},
+				env:  map[string]string{"TEST_DEBUG": "maybe"},
+				files: map[string]string{
+					"config.yaml": "port: http\nunknown: value\n",
+				},
+			},
+			wantErr: []string{
+				`configuration file: port: invalid integer "http"`,
+				"configuration file: unknown key unknown",
+				`environment variable TEST_DEBUG: invalid boolean "maybe"`,
+				`flag --timeout: invalid duration "ten"`,
+				"token is required (flag --token or environment variable TEST_TOKEN)",
+			},
+		},
+		{
+			name: "secret from file in environment variable",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args:  []string{"--token", "token"},
+				env:   map[string]string{"TEST_PASSWORD_FILE": "password.txt"},
+				files: map[string]string{"password.txt": "secret\n", "test_password": "dir"},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {
+				c.Password = "secret"
+			}),
+		},
+		{
+			name: "secret from directory",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args:  []string{"--token", "token"},
+				files: map[string]string{"test_password": "dir\n"},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {
+				c.Password = "dir"
+			}),
+		},
+		{
+			name: "secret from environment variable takes precedence over directory",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args:  []string{"--token", "token"},
+				env:   map[string]string{"TEST_PASSWORD": "env"},
+				files: map[string]string{"test_password": "dir"},
+			},
+			want: newTestConfiguration(func(c *testConfiguration) {
+				c.Password = "env"
+			}),
+		},
+		{
+			name: "secret in both environment variable and file",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args:  []string{"--token", "token"},
+				env:   map[string]string{"TEST_PASSWORD": "env", "TEST_PASSWORD_FILE": "password.txt"},
+				files: map[string]string{"password.txt": "secret"},
+			},
+			wantErr: []string{"environment variables TEST_PASSWORD and TEST_PASSWORD_FILE must not both be set"},
+		},
+		{
+			name: "secret file missing",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args: []string{"--token", "token"},
+				env:  map[string]string{"TEST_PASSWORD_FILE": "/nonexistent/password.txt"},
+			},
+			wantErr: []string{"secret TEST_PASSWORD: open /nonexistent/password.txt: no such file or directory"},
+		},
+		{
+			name: "unsupported file format",
+			input: struct {
+				args  []string
+				env   map[string]string
+				files map[string]string
+			}{
+				args:  []string{"--config", "config.toml", "--token", "token"},
+				files: map[string]string{"config.toml": ""},
+			},
+			wantErr: []string{`configuration file: unsupported format ".toml", must be YAML or JSON`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.input.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("unexpected error writing file: %v", err)
+				}
+			}
+			args := make([]string, len(test.input.args))
+			for i, arg := range test.input.args {
+				if _, ok := test.input.files[arg]; ok {
+					arg = filepath.Join(dir, arg)
+				}
+				args[i] = arg
+			}
+			env := map[string]string{}
+			for k, v := range test.input.env {
+				if _, ok := test.input.files[v]; ok {
+					v = filepath.Join(dir, v)
+				}
+				env[k] = v
+			}
+
+			lookupEnv := func(key string) (string, bool) {
+				v, ok := env[key]
+				return v, ok
+			}
+			secrets := NewSecretProvider(dir)
+			secrets.lookupEnv = lookupEnv
+
+			l := newLoader("test", "TEST", WithOutput(&bytes.Buffer{}), WithSecretProvider(secrets))
+			l.lookupEnv = lookupEnv
+
+			got := testConfiguration{}
+			gotErr := l.load(&got, args)
+
+			if len(test.wantErr) > 0 {
+				if gotErr == nil {
+					t.Fatalf("load() = nil; want error")
+				}
+				if diff := cmp.Diff(test.wantErr, strings.Split(gotErr.Error(), "\n")); diff != "" {
+					t.Errorf("load() = unexpected error (-want +got):\n%s\n", diff)
+				}
+				return
+			}
+			if gotErr != nil {
+				t.Fatalf("load() = unexpected error: %v", gotErr)
+			}
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(testConfiguration{})); diff != "" {
+				t.Errorf("load() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestLoader_Load_Help(t *testing.T) {
+	t.Run("help", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := newLoader("test", "TEST", WithOutput(buf))
+
+		gotErr := l.load(&testConfiguration{}, []string{"--help"})
+		if !errors.Is(gotErr, ErrHelp) {
+			t.Errorf("load() = unexpected error, want: %v, got: %v", ErrHelp, gotErr)
+		}
+
+		for _, want := range []string{
+			"Usage of test:",
+			"-tls-certificate-file",
+			`Timeout. (default "15s")`,
+			"TEST_CONFIG_FILE",
+			"--version\n    \tPrint version information and exit.",
+			"TEST_TLS_CERTIFICATE_FILE  Certificate.",
+			"TEST_PASSWORD_FILE         Path to file containing the value of TEST_PASSWORD.",
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("load() = help output does not contain %q:\n%s", want, buf.String())
+			}
+		}
+	})
+}
+
+func TestLoader_Load_Version(t *testing.T) {
+	l := newLoader("test", "TEST", WithOutput(&bytes.Buffer{}))
+
+	gotErr := l.load(&testConfiguration{}, []string{"--version"})
+	if !errors.Is(gotErr, ErrVersion) {
+		t.Errorf("load() = unexpected error, want: %v, got: %v", ErrVersion, gotErr)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  []string
+	}{
+		{input: "port", want: []string{"port"}},
+		{input: "readTimeout", want: []string{"read", "Timeout"}},
+		{input: "tlsCertificateFile", want: []string{"tls", "Certificate", "File"}},
+		{input: "caPEMFile", want: []string{"ca", "PEM", "File"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, splitWords(test.input)); diff != "" {
+				t.Errorf("splitWords() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func newTestConfiguration(fn func(c *testConfiguration)) testConfiguration {
+	c := testConfiguration{
+		Name:    "default",
+		Port:    8080,
+		Timeout: 15 * time.Second,
+		Token:   "token",
+	}
+	fn(&c)
+	return c
+}
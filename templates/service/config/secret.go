@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redacted is shown instead of the value of a Secret.
+	redacted = "[REDACTED]"
+	// defaultSecretDir is the default directory for mounted secrets.
+	defaultSecretDir = "/run/secrets"
+	// secretFileSuffix is the suffix of environment variables that holds
+	// the path to a file containing the value.
+	secretFileSuffix = "_FILE"
+)
+
+// Secret is a string that is redacted when it is printed, logged or
+// marshaled. Use Value to get the actual value.
+type Secret string
+
+// Value returns the actual value of the Secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns a redacted representation of the Secret.
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString returns a redacted representation of the Secret.
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// LogValue returns a redacted representation of the Secret for slog.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// MarshalText returns a redacted representation of the Secret. It is used
+// when the Secret is marshaled to JSON or YAML.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// SecretProvider resolves secrets from files. A secret with the name NAME is
+// read from the file in the environment variable NAME_FILE, or from a file
+// called NAME (or name) in one of the secret directories.
+type SecretProvider struct {
+	dirs      []string
+	lookupEnv func(string) (string, bool)
+	mu        sync.Mutex
+	files     map[string]*secretFile
+}
+
+// secretFile holds the path and value of a resolved secret, and the
+// configuration key it was resolved for.
+type secretFile struct {
+	key   string
+	path  string
+	value []byte
+}
+
+// NewSecretProvider returns a new SecretProvider that resolves secrets
+// from the given directories. Defaults to /run/secrets if no directories
+// are provided.
+func NewSecretProvider(dirs ...string) *SecretProvider {
+	if len(dirs) == 0 {
+		dirs = []string{defaultSecretDir}
+	}
+	return &SecretProvider{
+		dirs:      dirs,
+		lookupEnv: os.LookupEnv,
+		files:     make(map[string]*secretFile),
+	}
+}
+
+// Lookup returns the secret with the given name. The boolean is false if
+// the secret could not be found.
+func (p *SecretProvider) Lookup(name string) (Secret, bool, error) {
+	return p.lookup("", name)
+}
+
+// Path returns the path of the file that the secret of the
+// configuration key, for example tls.key, was read from. The boolean is
+// false if the secret was not read from a file.
+func (p *SecretProvider) Path(key string) (string, bool) {
+	if len(key) == 0 {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, file := range p.files {
+		if file.key == key {
+			return file.path, true
+		}
+	}
+	return "", false
+}
+
+// lookup returns the secret with the given name for the configuration
+// key.
+func (p *SecretProvider) lookup(key, name string) (Secret, bool, error) {
+	path, ok := p.lookupEnv(name + secretFileSuffix)
+	if !ok {
+		path, ok = p.find(name)
+	}
+	if !ok {
+		return "", false, nil
+	}
+
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("secret %s: %w", name, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[name] = &secretFile{key: key, path: path, value: value}
+	return Secret(value), true, nil
+}
+
+// Watch checks the files of the secrets that have been looked up at the
+// given interval, and calls fn with the name and the new value of every
+// secret that has changed. It blocks until ctx is done.
+func (p *SecretProvider) Watch(ctx context.Context, interval time.Duration, fn func(name string, value Secret)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for name, value := range p.changed() {
+				fn(name, value)
+			}
+		}
+	}
+}
+
+// changed returns the secrets which files have changed since they
+// were last read.
+func (p *SecretProvider) changed() map[string]Secret {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	changed := map[string]Secret{}
+	for name, file := range p.files {
+		value, err := readSecretFile(file.path)
+		if err != nil || bytes.Equal(value, file.value) {
+			continue
+		}
+		file.value = value
+		changed[name] = Secret(value)
+	}
+	return changed
+}
+
+// find returns the path of the file for the secret in the secret
+// directories.
+func (p *SecretProvider) find(name string) (string, bool) {
+	for _, dir := range p.dirs {
+		for _, n := range []string{name, strings.ToLower(name)} {
+			path := filepath.Join(dir, n)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// readSecretFile reads the file at path with trailing newlines removed.
+func readSecretFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b, "\r\n"), nil
+}
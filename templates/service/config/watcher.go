@@ -0,0 +1,212 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultWatchInterval is the default interval at which the
+// configuration file is checked for changes.
+const defaultWatchInterval = 5 * time.Second
+
+// logger is the interface that wraps around methods Info and Error.
+type logger interface {
+	Info(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Change is a changed field of the configuration. Values of secrets
+// are redacted.
+type Change struct {
+	Key      string
+	Previous string
+	Current  string
+	Restart  bool
+}
+
+// String returns the change formatted as key: previous -> current.
+func (c Change) String() string {
+	return c.Key + ": " + c.Previous + " -> " + c.Current
+}
+
+// Event is published to the subscribers when the configuration has
+// been reloaded with changes.
+type Event struct {
+	Previous Configuration
+	Current  Configuration
+	Changes  []Change
+}
+
+// Changed returns true if the field with the key has changed.
+func (e Event) Changed(key string) bool {
+	for _, c := range e.Changes {
+		if c.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Restart returns the keys of the changed fields that require a restart.
+func (e Event) Restart() []string {
+	var keys []string
+	for _, c := range e.Changes {
+		if c.Restart {
+			keys = append(keys, c.Key)
+		}
+	}
+	return keys
+}
+
+// Watcher reloads the configuration when the configuration file changes
+// or when the process receives SIGHUP, and publishes the changes to
+// the subscribers. A configuration that fails to load or validate is
+// logged and discarded, and the current configuration is kept.
+type Watcher struct {
+	args        []string
+	options     []Option
+	log         logger
+	interval    time.Duration
+	mu          sync.Mutex
+	current     Configuration
+	path        string
+	modTime     time.Time
+	subscribers []func(Event)
+}
+
+// NewWatcher returns a new Watcher for the Configuration loaded with
+// the command-line arguments args and options.
+func NewWatcher(cfg Configuration, args []string, log logger, options ...Option) *Watcher {
+	w := &Watcher{
+		args:     args,
+		options:  options,
+		log:      log,
+		interval: defaultWatchInterval,
+		current:  cfg,
+	}
+	w.path = newLoader(filepath.Base(os.Args[0]), defaultEnvPrefix, options...).filePath(&Configuration{}, args)
+	w.modTime = modTime(w.path)
+	return w
+}
+
+// Current returns the current Configuration.
+func (w *Watcher) Current() Configuration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe adds fn to the subscribers that are called with an Event
+// when the configuration has been reloaded with changes.
+func (w *Watcher) Subscribe(fn func(Event)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Watch reloads the configuration when the configuration file changes
+// or the process receives SIGHUP. It blocks until ctx is done.
+func (w *Watcher) Watch(ctx context.Context) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			w.Reload()
+		case <-ticker.C:
+			w.mu.Lock()
+			path, previous := w.path, w.modTime
+			w.mu.Unlock()
+			if len(path) > 0 && !modTime(path).Equal(previous) {
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload loads and validates the configuration, and publishes the
+// changes to the subscribers.
+func (w *Watcher) Reload() error {
+	l := newLoader(filepath.Base(os.Args[0]), defaultEnvPrefix, w.options...)
+	cfg := Configuration{}
+	err := l.load(&cfg, w.args)
+
+	w.mu.Lock()
+	w.path = l.path
+	w.modTime = modTime(l.path)
+	if err != nil {
+		w.mu.Unlock()
+		w.log.Error("Failed to reload configuration.", "error", err)
+		return err
+	}
+	event := Event{Previous: w.current, Current: cfg, Changes: diff(&w.current, &cfg)}
+	w.current = cfg
+	subscribers := append([]func(Event){}, w.subscribers...)
+	w.mu.Unlock()
+
+	if len(event.Changes) == 0 {
+		return nil
+	}
+	changes := make([]string, len(event.Changes))
+	for i, c := range event.Changes {
+		changes[i] = c.String()
+	}
+	w.log.Info("Configuration reloaded.", "changes", changes)
+	if keys := event.Restart(); len(keys) > 0 {
+		w.log.Info("Configuration changes require a restart to take effect.", "keys", keys)
+	}
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+	return nil
+}
+
+// diff returns the changed fields between previous and current, that
+// must be pointers to structs of the same type.
+func diff(previous, current any) []Change {
+	pf := collectFields(reflect.ValueOf(previous).Elem(), nil)
+	cf := collectFields(reflect.ValueOf(current).Elem(), nil)
+
+	var changes []Change
+	for i := range pf {
+		p, c := pf[i].value.Interface(), cf[i].value.Interface()
+		if reflect.DeepEqual(p, c) {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:      pf[i].key(),
+			Previous: fmt.Sprint(p),
+			Current:  fmt.Sprint(c),
+			Restart:  pf[i].restart,
+		})
+	}
+	return changes
+}
+
+// modTime returns the modification time of the file at path, or the
+// zero time if it does not exist.
+func modTime(path string) time.Time {
+	if len(path) == 0 {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
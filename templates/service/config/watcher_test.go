@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			previous testConfiguration
+			current  testConfiguration
+		}
+		want []Change
+	}{
+		{
+			name: "no changes",
+			input: struct {
+				previous testConfiguration
+				current  testConfiguration
+			}{
+				previous: newTestConfiguration(func(c *testConfiguration) {}),
+				current:  newTestConfiguration(func(c *testConfiguration) {}),
+			},
+		},
+		{
+			name: "changes",
+			input: struct {
+				previous testConfiguration
+				current  testConfiguration
+			}{
+				previous: newTestConfiguration(func(c *testConfiguration) {
+					c.Password = "password1"
+				}),
+				current: newTestConfiguration(func(c *testConfiguration) {
+					c.Port, c.Timeout, c.Origins, c.Password = 8081, 30*time.Second, []string{"a"}, "password2"
+				}),
+			},
+			want: []Change{
+				{Key: "port", Previous: "8080", Current: "8081", Restart: true},
+				{Key: "timeout", Previous: "15s", Current: "30s"},
+				{Key: "origins", Previous: "[]", Current: "[a]"},
+				{Key: "password", Previous: redacted, Current: redacted},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diff(&test.input.previous, &test.input.current)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("diff() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestEvent(t *testing.T) {
+	event := Event{
+		Changes: []Change{
+			{Key: "port", Previous: "8080", Current: "8081", Restart: true},
+			{Key: "timeout", Previous: "15s", Current: "30s"},
+		},
+	}
+
+	if !event.Changed("timeout") {
+		t.Errorf("Changed() = false; want true")
+	}
+	if event.Changed("name") {
+		t.Errorf("Changed() = true; want false")
+	}
+	if diff := cmp.Diff([]string{"port"}, event.Restart()); diff != "" {
+		t.Errorf("Restart() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff("port: 8080 -> 8081", event.Changes[0].String()); diff != "" {
+		t.Errorf("String() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -1,15 +1,72 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/RedeployAB/go-template/templates/service/config"
 	"github.com/RedeployAB/go-template/templates/service/service"
+	"github.com/RedeployAB/go-template/templates/service/version"
 )
 
+// healthcheckTimeout is the timeout of the healthcheck command.
+const healthcheckTimeout = 5 * time.Second
+
 func main() {
-	log := service.NewLogger()
+	args := os.Args[1:]
+	healthcheck := len(args) > 0 && args[0] == "healthcheck"
+	if healthcheck {
+		args = args[1:]
+	}
+
+	cfg, err := config.New(args)
+	if err != nil {
+		if errors.Is(err, config.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, config.ErrVersion) {
+			fmt.Println(version.Get())
+			os.Exit(0)
+		}
+		service.NewLogger().Error("Configuration error.", "error", err)
+		os.Exit(1)
+	}
+
+	level := &slog.LevelVar{}
+	level.Set(cfg.Log.Level)
+	log := service.NewLogger(service.WithLevel(level))
+
+	options := service.Options{
+		Logger:       log,
+		LogLevel:     level,
+		StatusSocket: cfg.Status.Socket,
+		PIDFile:      cfg.PID.File,
+	}
+
+	if healthcheck {
+		ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+		err := service.Healthcheck(ctx, options)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Healthcheck failed: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	svc := service.New(service.WithOptions(options))
 
-	svc := service.New(service.WithOptions(service.Options{
-		Logger: log,
-	}))
+	watcher := config.NewWatcher(cfg, args, log)
+	watcher.Subscribe(func(e config.Event) {
+		svc.Update(service.Settings{
+			LogLevel: e.Current.Log.Level,
+		})
+	})
+	go watcher.Watch(context.Background())
 
 	if err := svc.Start(); err != nil {
 		log.Error("Service error.", "error", err)
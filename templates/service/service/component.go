@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultComponentStartTimeout is the default timeout for starting
+	// a component.
+	defaultComponentStartTimeout = 15 * time.Second
+	// defaultComponentStopTimeout is the default timeout for stopping
+	// a component.
+	defaultComponentStopTimeout = 15 * time.Second
+)
+
+var (
+	// ErrComponentExists is returned when a component with the same
+	// name is already registered.
+	ErrComponentExists = errors.New("component already registered")
+	// ErrComponentDependency is returned when a component depends on
+	// a component that is not registered.
+	ErrComponentDependency = errors.New("component dependency not registered")
+	// ErrComponentCycle is returned when the dependencies of the
+	// components form a cycle.
+	ErrComponentCycle = errors.New("component dependency cycle")
+)
+
+// Component is a part of the service that is started and stopped
+// together with it. Start should return when the component is started,
+// with any long running work running in the background. The context
+// passed to Start is cancelled when the start timeout is exceeded or
+// when the service is stopping, and Start must return when it is done.
+// Stop should stop the component and its background work before the
+// context is done.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// FailureReporter is implemented by a Component that can fail after it
+// has been started. The first error received from Err while the
+// component is started stops the service, and is returned by Start.
+type FailureReporter interface {
+	Err() <-chan error
+}
+
+// ComponentOptions holds the configuration for a component.
+type ComponentOptions struct {
+	// DependsOn contains the names of the components that must be
+	// started before, and stopped after, the component.
+	DependsOn []string
+	// StartTimeout is the timeout for starting the component.
+	StartTimeout time.Duration
+	// StopTimeout is the timeout for stopping the component.
+	StopTimeout time.Duration
+}
+
+// component is a registered Component.
+type component struct {
+	Component
+	name         string
+	dependsOn    []string
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+}
+
+// components is a registry of components that are started in
+// dependency order and stopped in reverse order.
+type components struct {
+	mu         sync.Mutex
+	registered []*component
+	started    []*component
+	ctx        context.Context
+	cancel     context.CancelFunc
+	errCh      chan error
+}
+
+// newComponents returns a new components registry.
+func newComponents() *components {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &components{
+		ctx:    ctx,
+		cancel: cancel,
+		errCh:  make(chan error, 1),
+	}
+}
+
+// Register a component with the service under the given name. The
+// components are started in the order they are registered, after the
+// components they depend on.
+func (s service) Register(name string, c Component, options ...ComponentOptions) error {
+	return s.components.register(name, c, options...)
+}
+
+// register a component.
+func (r *components) register(name string, c Component, options ...ComponentOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range r.registered {
+		if registered.name == name {
+			return fmt.Errorf("%w: %s", ErrComponentExists, name)
+		}
+	}
+
+	comp := &component{
+		Component:    c,
+		name:         name,
+		startTimeout: defaultComponentStartTimeout,
+		stopTimeout:  defaultComponentStopTimeout,
+	}
+	for _, option := range options {
+		comp.dependsOn = append(comp.dependsOn, option.DependsOn...)
+		if option.StartTimeout > 0 {
+			comp.startTimeout = option.StartTimeout
+		}
+		if option.StopTimeout > 0 {
+			comp.stopTimeout = option.StopTimeout
+		}
+	}
+	r.registered = append(r.registered, comp)
+	return nil
+}
+
+// order returns the registered components sorted so that every
+// component comes after the components it depends on. Components
+// without dependencies between them keep the order they were
+// registered in.
+func (r *components) order() ([]*component, error) {
+	byName := make(map[string]*component, len(r.registered))
+	for _, c := range r.registered {
+		byName[c.name] = c
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int, len(r.registered))
+	ordered := make([]*component, 0, len(r.registered))
+
+	var visit func(c *component) error
+	visit = func(c *component) error {
+		switch state[c.name] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrComponentCycle, c.name)
+		case visited:
+			return nil
+		}
+		state[c.name] = visiting
+		for _, name := range c.dependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("%w: %s depends on %s", ErrComponentDependency, c.name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[c.name] = visited
+		ordered = append(ordered, c)
+		return nil
+	}
+
+	for _, c := range r.registered {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// start the components in dependency order. If a component fails to
+// start, the components that have been started are stopped in reverse
+// order and the error is returned. If the components are stopped while
+// starting, the remaining components are not started and no error is
+// returned.
+func (r *components) start(log logger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ordered, err := r.order()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range ordered {
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		if err := c.start(r.ctx); err != nil {
+			if r.ctx.Err() != nil {
+				return nil
+			}
+			log.Error("Failed to start component.", "component", c.name, "error", err)
+			r.stopStarted(log)
+			return fmt.Errorf("component %s: %w", c.name, err)
+		}
+		r.started = append(r.started, c)
+		log.Info("Component started.", "component", c.name)
+		r.watch(c, log)
+	}
+	return nil
+}
+
+// err returns a channel that receives the first error of a started
+// component that implements FailureReporter.
+func (r *components) err() <-chan error {
+	return r.errCh
+}
+
+// watch reports the first error of the started component, if it
+// implements FailureReporter, until the components are stopped.
+func (r *components) watch(c *component, log logger) {
+	reporter, ok := c.Component.(FailureReporter)
+	if !ok {
+		return
+	}
+	ch := reporter.Err()
+	if ch == nil {
+		return
+	}
+
+	go func() {
+		select {
+		case err, ok := <-ch:
+			if !ok || err == nil {
+				return
+			}
+			log.Error("Component failed.", "component", c.name, "error", err)
+			select {
+			case r.errCh <- fmt.Errorf("component %s: %w", c.name, err):
+			default:
+			}
+		case <-r.ctx.Done():
+		}
+	}()
+}
+
+// stop the started components in reverse order. Components that are
+// starting are cancelled first. All components are stopped even if
+// some of them fail, and the errors are returned joined.
+func (r *components) stop(log logger) error {
+	// Cancel before taking the lock, since it is held for as long as
+	// the components are starting.
+	r.cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopStarted(log)
+}
+
+// stopStarted stops the started components in reverse order. The lock
+// must be held by the caller.
+func (r *components) stopStarted(log logger) error {
+	var errs []error
+	for i := len(r.started) - 1; i >= 0; i-- {
+		c := r.started[i]
+		if err := c.stop(); err != nil {
+			log.Error("Failed to stop component.", "component", c.name, "error", err)
+			errs = append(errs, fmt.Errorf("component %s: %w", c.name, err))
+			continue
+		}
+		log.Info("Component stopped.", "component", c.name)
+	}
+	r.started = nil
+	return errors.Join(errs...)
+}
+
+// start the component within its start timeout.
+func (c *component) start(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.startTimeout)
+	defer cancel()
+	return c.Start(ctx)
+}
+
+// stop the component within its stop timeout.
+func (c *component) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.stopTimeout)
+	defer cancel()
+	return c.Stop(ctx)
+}
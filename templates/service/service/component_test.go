@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestComponents_Start(t *testing.T) {
+	errStart := errors.New("start error")
+
+	var tests = []struct {
+		name  string
+		input []struct {
+			name    string
+			options ComponentOptions
+			err     error
+		}
+		want struct {
+			calls []string
+			logs  []string
+			err   error
+		}
+	}{
+		{
+			name: "start in dependency order",
+			input: []struct {
+				name    string
+				options ComponentOptions
+				err     error
+			}{
+				{name: "worker", options: ComponentOptions{DependsOn: []string{"database", "queue"}}},
+				{name: "queue"},
+				{name: "database"},
+			},
+			want: struct {
+				calls []string
+				logs  []string
+				err   error
+			}{
+				calls: []string{"start database", "start queue", "start worker"},
+				logs: []string{
+					"Component started.", "component", "database",
+					"Component started.", "component", "queue",
+					"Component started.", "component", "worker",
+				},
+			},
+		},
+		{
+			name: "stop started components on failure",
+			input: []struct {
+				name    string
+				options ComponentOptions
+				err     error
+			}{
+				{name: "database"},
+				{name: "queue", options: ComponentOptions{DependsOn: []string{"database"}}},
+				{name: "worker", options: ComponentOptions{DependsOn: []string{"queue"}}, err: errStart},
+			},
+			want: struct {
+				calls []string
+				logs  []string
+				err   error
+			}{
+				calls: []string{"start database", "start queue", "start worker", "stop queue", "stop database"},
+				logs: []string{
+					"Component started.", "component", "database",
+					"Component started.", "component", "queue",
+					"Failed to start component.", "component", "worker", "error", "start error",
+					"Component stopped.", "component", "queue",
+					"Component stopped.", "component", "database",
+				},
+				err: errStart,
+			},
+		},
+		{
+			name: "missing dependency",
+			input: []struct {
+				name    string
+				options ComponentOptions
+				err     error
+			}{
+				{name: "worker", options: ComponentOptions{DependsOn: []string{"queue"}}},
+			},
+			want: struct {
+				calls []string
+				logs  []string
+				err   error
+			}{
+				logs: []string{},
+				err:  ErrComponentDependency,
+			},
+		},
+		{
+			name: "dependency cycle",
+			input: []struct {
+				name    string
+				options ComponentOptions
+				err     error
+			}{
+				{name: "queue", options: ComponentOptions{DependsOn: []string{"worker"}}},
+				{name: "worker", options: ComponentOptions{DependsOn: []string{"queue"}}},
+			},
+			want: struct {
+				calls []string
+				logs  []string
+				err   error
+			}{
+				logs: []string{},
+				err:  ErrComponentCycle,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := []string{}
+			var calls []string
+			r := newComponents()
+			for _, c := range test.input {
+				if err := r.register(c.name, &mockComponent{name: c.name, calls: &calls, startErr: c.err}, c.options); err != nil {
+					t.Fatalf("register() = unexpected error: %v", err)
+				}
+			}
+
+			gotErr := r.start(&mockLogger{logs: &logs})
+
+			if diff := cmp.Diff(test.want.calls, calls); diff != "" {
+				t.Errorf("start() = unexpected calls (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want.logs, logs); diff != "" {
+				t.Errorf("start() = unexpected logs (-want +got):\n%s\n", diff)
+			}
+			if diff := cmp.Diff(test.want.err, gotErr, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("start() = unexpected error (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestComponents_Start_Timeout(t *testing.T) {
+	logs := []string{}
+	var calls []string
+	r := newComponents()
+	r.register("database", &mockComponent{name: "database", calls: &calls, startDelay: time.Second}, ComponentOptions{
+		StartTimeout: 10 * time.Millisecond,
+	})
+
+	err := r.start(&mockLogger{logs: &logs})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("start() = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestComponents_Stop(t *testing.T) {
+	errStop := errors.New("stop error")
+
+	logs := []string{}
+	var calls []string
+	r := newComponents()
+	r.register("database", &mockComponent{name: "database", calls: &calls})
+	r.register("queue", &mockComponent{name: "queue", calls: &calls, stopErr: errStop}, ComponentOptions{DependsOn: []string{"database"}})
+	r.register("worker", &mockComponent{name: "worker", calls: &calls}, ComponentOptions{DependsOn: []string{"queue"}})
+
+	if err := r.start(&mockLogger{logs: &logs}); err != nil {
+		t.Fatalf("start() = unexpected error: %v", err)
+	}
+	logs = logs[:0]
+
+	err := r.stop(&mockLogger{logs: &logs})
+	if !errors.Is(err, errStop) {
+		t.Errorf("stop() = %v; want %v", err, errStop)
+	}
+
+	wantCalls := []string{"start database", "start queue", "start worker", "stop worker", "stop queue", "stop database"}
+	if diff := cmp.Diff(wantCalls, calls); diff != "" {
+		t.Errorf("stop() = unexpected calls (-want +got):\n%s\n", diff)
+	}
+	wantLogs := []string{
+		"Component stopped.", "component", "worker",
+		"Failed to stop component.", "component", "queue", "error", "stop error",
+		"Component stopped.", "component", "database",
+	}
+	if diff := cmp.Diff(wantLogs, logs); diff != "" {
+		t.Errorf("stop() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestComponents_Stop_WhileStarting(t *testing.T) {
+	logs := []string{}
+	var calls []string
+	r := newComponents()
+	r.register("database", &mockComponent{name: "database", calls: &calls, startDelay: time.Second})
+	r.register("worker", &mockComponent{name: "worker", calls: &calls}, ComponentOptions{DependsOn: []string{"database"}})
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- r.start(&mockLogger{logs: &logs})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := r.stop(&mockLogger{logs: &logs}); err != nil {
+		t.Errorf("stop() = unexpected error: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("start() = unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"start database"}, calls); diff != "" {
+		t.Errorf("stop() = unexpected calls (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestComponents_Failure(t *testing.T) {
+	logs := []string{}
+	var calls []string
+	failing := &mockComponent{name: "worker", calls: &calls, errCh: make(chan error, 1)}
+	r := newComponents()
+	r.register("database", &mockComponent{name: "database", calls: &calls})
+	r.register("worker", failing)
+	if err := r.start(&mockLogger{logs: &logs}); err != nil {
+		t.Fatalf("start() = unexpected error: %v", err)
+	}
+
+	failing.errCh <- errors.New("connection lost")
+	select {
+	case err := <-r.err():
+		if diff := cmp.Diff("component worker: connection lost", err.Error()); diff != "" {
+			t.Errorf("err() = unexpected error (-want +got):\n%s\n", diff)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("err() = no error; want error")
+	}
+	r.stop(&mockLogger{logs: &logs})
+}
+
+func TestService_Register(t *testing.T) {
+	s := New()
+	if err := s.Register("database", &mockComponent{name: "database"}); err != nil {
+		t.Fatalf("Register() = unexpected error: %v", err)
+	}
+
+	err := s.Register("database", &mockComponent{name: "database"})
+	if !errors.Is(err, ErrComponentExists) {
+		t.Errorf("Register() = %v; want %v", err, ErrComponentExists)
+	}
+}
+
+type mockComponent struct {
+	name       string
+	calls      *[]string
+	startDelay time.Duration
+	startErr   error
+	stopErr    error
+	errCh      chan error
+}
+
+func (c *mockComponent) Start(ctx context.Context) error {
+	*c.calls = append(*c.calls, "start "+c.name)
+	if c.startDelay > 0 {
+		select {
+		case <-time.After(c.startDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return c.startErr
+}
+
+func (c *mockComponent) Err() <-chan error {
+	return c.errCh
+}
+
+func (c *mockComponent) Stop(ctx context.Context) error {
+	*c.calls = append(*c.calls, "stop "+c.name)
+	return c.stopErr
+}
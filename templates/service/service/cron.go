@@ -0,0 +1,242 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule is returned when a schedule cannot be parsed.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// schedule returns the next time after t a job should run. A zero time
+// means that there is no next time.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+// everySchedule runs at a fixed interval.
+type everySchedule struct {
+	interval time.Duration
+}
+
+// next returns the time one interval after t.
+func (s everySchedule) next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// cronSchedule runs at the times matching a cron expression. Every
+// field is a bit set of the values it matches.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domAny, dowAny                        bool
+	location                              *time.Location
+}
+
+// cronField is the range of values of a cron field, and the names that
+// can be used for the values.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{name: "second", min: 0, max: 59}
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week allows 7 for Sunday, which is folded into 0.
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are the predefined schedules.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// parseSchedule parses a schedule. It is either a cron expression with
+// 5 fields (minute, hour, day of month, month and day of week) or 6
+// fields (with seconds first), a predefined schedule such as @daily,
+// or an interval such as @every 1h30m. The cron expression is
+// evaluated in the given location.
+func parseSchedule(spec string, location *time.Location) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if location == nil {
+		location = time.Local
+	}
+
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: %q: interval must be a positive duration", ErrInvalidSchedule, spec)
+		}
+		return everySchedule{interval: d}, nil
+	}
+
+	expr := spec
+	if strings.HasPrefix(spec, "@") {
+		var ok bool
+		if expr, ok = descriptors[strings.ToLower(spec)]; !ok {
+			return nil, fmt.Errorf("%w: %q: unknown descriptor", ErrInvalidSchedule, spec)
+		}
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%w: %q: expected 5 or 6 fields, got %d", ErrInvalidSchedule, spec, len(fields))
+	}
+
+	s := cronSchedule{location: location}
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, secondField},
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		if *f.bits, err = parseField(fields[i], f.field); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSchedule, spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[3] == "*" || fields[3] == "?"
+	s.dowAny = fields[5] == "*" || fields[5] == "?"
+
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps
+// of a cron field into a bit set.
+func parseField(expr string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		start, end := field.min, field.max
+
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			from, to, _ := strings.Cut(rng, "-")
+			var err error
+			if start, err = parseValue(from, field); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(to, field); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("%s: range %s is reversed", field.name, rng)
+			}
+		default:
+			v, err := parseValue(rng, field)
+			if err != nil {
+				return 0, err
+			}
+			start = v
+			if !hasStep {
+				end = v
+			}
+		}
+
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", field.name, step)
+			}
+		}
+		for v := start; v <= end; v += n {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses a number or a name of a cron field value.
+func parseValue(s string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", field.name, s)
+	}
+	if v < field.min || v > field.max {
+		return 0, fmt.Errorf("%s: value %d out of range %d-%d", field.name, v, field.min, field.max)
+	}
+	return v, nil
+}
+
+// maxScheduleYears is the number of years searched for the next time
+// of a cron expression, for expressions such as 30 February that never
+// match.
+const maxScheduleYears = 5
+
+// next returns the first time after t that matches the cron expression.
+func (s cronSchedule) next(t time.Time) time.Time {
+	t = t.In(s.location).Add(time.Second).Truncate(time.Second)
+	limit := t.Year() + maxScheduleYears
+
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches reports if the day of t matches the day of month and day
+// of week. If both are restricted, either of them must match, as with
+// the standard cron.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
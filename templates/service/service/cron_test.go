@@ -0,0 +1,186 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSchedule(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "5 fields", input: "*/15 9-17 * * mon-fri"},
+		{name: "6 fields", input: "30 0 12 1,15 * ?"},
+		{name: "descriptor", input: "@daily"},
+		{name: "interval", input: "@every 1h30m"},
+		{name: "too few fields", input: "* * * *", wantErr: ErrInvalidSchedule},
+		{name: "value out of range", input: "60 * * * *", wantErr: ErrInvalidSchedule},
+		{name: "reversed range", input: "* 17-9 * * *", wantErr: ErrInvalidSchedule},
+		{name: "invalid step", input: "*/0 * * * *", wantErr: ErrInvalidSchedule},
+		{name: "invalid name", input: "* * * foo *", wantErr: ErrInvalidSchedule},
+		{name: "unknown descriptor", input: "@sometimes", wantErr: ErrInvalidSchedule},
+		{name: "invalid interval", input: "@every -1m", wantErr: ErrInvalidSchedule},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, gotErr := parseSchedule(test.input, time.UTC)
+			if !errors.Is(gotErr, test.wantErr) {
+				t.Errorf("parseSchedule(%q) = unexpected error: %v; want %v", test.input, gotErr, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	// Monday 1 January 2024.
+	now := time.Date(2024, 1, 1, 10, 20, 30, 0, time.UTC)
+
+	var tests = []struct {
+		name  string
+		input struct {
+			spec     string
+			location *time.Location
+		}
+		want []time.Time
+	}{
+		{
+			name: "every 15 minutes during working hours",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "*/15 9-17 * * mon-fri",
+			},
+			want: []time.Time{
+				time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "with seconds",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "*/20 * * * * *",
+			},
+			want: []time.Time{
+				time.Date(2024, 1, 1, 10, 20, 40, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 21, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 21, 20, 0, time.UTC),
+			},
+		},
+		{
+			name: "day of month or day of week",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "0 0 13 * fri",
+			},
+			want: []time.Time{
+				time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "sunday as 7",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "0 12 * * 7",
+			},
+			want: []time.Time{
+				time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 14, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "monthly",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "@monthly",
+			},
+			want: []time.Time{
+				time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "time zone",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec:     "0 9 * * *",
+				location: stockholm,
+			},
+			want: []time.Time{
+				time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 3, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "interval",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "@every 90m",
+			},
+			want: []time.Time{
+				time.Date(2024, 1, 1, 11, 50, 30, 0, time.UTC),
+				time.Date(2024, 1, 1, 13, 20, 30, 0, time.UTC),
+			},
+		},
+		{
+			name: "never",
+			input: struct {
+				spec     string
+				location *time.Location
+			}{
+				spec: "0 0 30 feb *",
+			},
+			want: []time.Time{{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location := test.input.location
+			if location == nil {
+				location = time.UTC
+			}
+			sched, err := parseSchedule(test.input.spec, location)
+			if err != nil {
+				t.Fatalf("parseSchedule() = unexpected error: %v", err)
+			}
+
+			var got []time.Time
+			next := now
+			for range test.want {
+				next = sched.next(next)
+				got = append(got, next)
+			}
+
+			if diff := cmp.Diff(test.want, got, cmp.Comparer(func(x, y time.Time) bool { return x.Equal(y) })); diff != "" {
+				t.Errorf("next() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"io"
 	"log/slog"
 	"os"
 )
@@ -11,7 +12,71 @@ type logger interface {
 	Error(msg string, args ...any)
 }
 
+// loggerOptions holds the configuration for the logger.
+type loggerOptions struct {
+	level    slog.Leveler
+	outputs  []io.Writer
+	sampling *SamplingOptions
+}
+
+// LoggerOption is a function that configures the logger.
+type LoggerOption func(*loggerOptions)
+
 // NewLogger creates a new slog with a JSON handler.
-func NewLogger() logger {
-	return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+func NewLogger(options ...LoggerOption) logger {
+	opts := loggerOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	var output io.Writer = os.Stderr
+	if len(opts.outputs) == 1 {
+		output = opts.outputs[0]
+	} else if len(opts.outputs) > 1 {
+		output = &multiWriter{writers: opts.outputs}
+	}
+
+	var handler slog.Handler = slog.NewJSONHandler(output, &slog.HandlerOptions{Level: opts.level})
+	if opts.sampling != nil {
+		handler = NewSamplingHandler(handler, *opts.sampling)
+	}
+	return slog.New(handler)
+}
+
+// closeLogger closes the handler of the logger if it can be closed, such
+// as the handler of a logger with sampling.
+func closeLogger(log logger) error {
+	l, ok := log.(*slog.Logger)
+	if !ok {
+		return nil
+	}
+	if c, ok := l.Handler().(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// WithLevel configures the minimum level of the records to log.
+// Defaults to slog.LevelInfo.
+func WithLevel(level slog.Leveler) LoggerOption {
+	return func(o *loggerOptions) {
+		o.level = level
+	}
+}
+
+// WithOutput configures the logger to write to the given outputs
+// instead of os.Stderr. Several outputs can be provided, for example
+// os.Stderr and a FileWriter.
+func WithOutput(outputs ...io.Writer) LoggerOption {
+	return func(o *loggerOptions) {
+		o.outputs = append(o.outputs, outputs...)
+	}
+}
+
+// WithSampling configures the logger to sample messages with
+// the given SamplingOptions.
+func WithSampling(options SamplingOptions) LoggerOption {
+	return func(o *loggerOptions) {
+		o.sampling = &options
+	}
 }
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// backupTimeFormat is the time format used in the names of rotated files.
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	// compressSuffix is the suffix added to compressed rotated files.
+	compressSuffix = ".gz"
+)
+
+// FileOptions holds the configuration for a FileWriter.
+type FileOptions struct {
+	// MaxSize is the maximum size in bytes of the file before it
+	// is rotated. If 0, the file is not rotated based on size.
+	MaxSize int64
+	// Interval is the maximum duration the file is written to
+	// before it is rotated. If 0, the file is not rotated based on time.
+	Interval time.Duration
+	// MaxAge is the maximum duration to keep rotated files. If 0,
+	// rotated files are not removed based on age.
+	MaxAge time.Duration
+	// MaxBackups is the maximum number of rotated files to keep.
+	// If 0, all rotated files are kept.
+	MaxBackups int
+	// Compress determines if rotated files should be compressed with gzip.
+	Compress bool
+}
+
+// FileWriter is an io.WriteCloser that writes to a file and rotates
+// it based on size and time. The file is reopened when the process
+// receives SIGHUP, to support external tools like logrotate. Errors
+// from rotating and reopening in the background are reported to
+// os.Stderr, and writes continue to the current file.
+type FileWriter struct {
+	filename string
+	options  FileOptions
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	opened   time.Time
+	failed   bool
+	stamp    string
+	seq      int
+	now      func() time.Time
+	errOut   io.Writer
+	sigCh    chan os.Signal
+	millCh   chan struct{}
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// NewFileWriter creates a new FileWriter that writes to the file with
+// the given name. The file and its directory are created if they do
+// not exist.
+func NewFileWriter(filename string, options FileOptions) (*FileWriter, error) {
+	if len(filename) == 0 {
+		return nil, errors.New("filename must be specified")
+	}
+	w := &FileWriter{
+		filename: filename,
+		options:  options,
+		now:      time.Now,
+		errOut:   os.Stderr,
+		sigCh:    make(chan os.Signal, 1),
+		millCh:   make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	signal.Notify(w.sigCh, syscall.SIGHUP)
+	w.wg.Add(2)
+	go w.reopenOnSignal()
+	go w.mill()
+
+	return w, nil
+}
+
+// Write writes b to the file, rotating it first if the write would
+// exceed MaxSize or if Interval has passed. If the rotation fails, b is
+// written to the current file and the error is reported.
+func (w *FileWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.shouldRotate(int64(len(b))) {
+		if err := w.rotate(); err != nil {
+			if !w.failed {
+				w.report(err)
+			}
+			w.failed = true
+		} else {
+			w.failed = false
+		}
+	}
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it with a timestamp
+// and opens a new file.
+func (w *FileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen reopens the file. It should be called after the file has
+// been moved by an external tool. The current file is kept if the file
+// cannot be opened.
+func (w *FileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.open()
+}
+
+// Close stops the FileWriter and closes the file.
+func (w *FileWriter) Close() error {
+	var err error
+	w.once.Do(func() {
+		signal.Stop(w.sigCh)
+		close(w.stopCh)
+		w.wg.Wait()
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.file != nil {
+			err = w.file.Close()
+			w.file = nil
+		}
+	})
+	return err
+}
+
+// shouldRotate reports whether the file should be rotated before writing
+// n bytes.
+func (w *FileWriter) shouldRotate(n int64) bool {
+	if w.options.MaxSize > 0 && w.size > 0 && w.size+n > w.options.MaxSize {
+		return true
+	}
+	if w.options.Interval > 0 && w.now().Sub(w.opened) >= w.options.Interval {
+		return true
+	}
+	return false
+}
+
+// open opens the file for appending, creating it if needed, and
+// replaces the current file with it. The current file is only closed
+// if the file could be opened.
+func (w *FileWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return fmt.Errorf("could not create log directory: %w", err)
+	}
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not stat log file: %w", err)
+	}
+
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			w.report(fmt.Errorf("could not close log file: %w", err))
+		}
+	}
+	w.file = file
+	w.size = info.Size()
+	w.opened = w.now()
+	return nil
+}
+
+// rotate renames the current file with a timestamp and opens a new file.
+// If the new file cannot be opened, writes continue to the renamed file.
+func (w *FileWriter) rotate() error {
+	stamp, seq := w.now().UTC().Format(backupTimeFormat), 0
+	if stamp == w.stamp {
+		seq = w.seq + 1
+	}
+	if err := os.Rename(w.filename, w.backupName(stamp, seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not rename log file: %w", err)
+	}
+	w.stamp, w.seq = stamp, seq
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	select {
+	case w.millCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// backupName returns the name of a rotated file for the formatted time
+// and sequence number. The sequence number is added to the names of
+// files rotated within the same millisecond, so that they do not
+// replace each other.
+func (w *FileWriter) backupName(stamp string, seq int) string {
+	dir := filepath.Dir(w.filename)
+	prefix, ext := w.prefixAndExt()
+	if seq > 0 {
+		stamp += "-" + strconv.Itoa(seq)
+	}
+	return filepath.Join(dir, prefix+stamp+ext)
+}
+
+// prefixAndExt returns the prefix and extension of rotated files.
+func (w *FileWriter) prefixAndExt() (string, string) {
+	name := filepath.Base(w.filename)
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-", ext
+}
+
+// reopenOnSignal reopens the file when SIGHUP is received.
+func (w *FileWriter) reopenOnSignal() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.sigCh:
+			if err := w.Reopen(); err != nil && !errors.Is(err, os.ErrClosed) {
+				w.report(err)
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// mill compresses and removes rotated files after each rotation.
+// A pending run is completed before it returns when the FileWriter
+// is closed.
+func (w *FileWriter) mill() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.millCh:
+			if err := w.millRun(); err != nil {
+				w.report(err)
+			}
+		case <-w.stopCh:
+			select {
+			case <-w.millCh:
+				if err := w.millRun(); err != nil {
+					w.report(err)
+				}
+			default:
+			}
+			return
+		}
+	}
+}
+
+// report writes an error of the FileWriter to its error output, since
+// it cannot be logged to the file.
+func (w *FileWriter) report(err error) {
+	fmt.Fprintf(w.errOut, "Log file %s: %v\n", w.filename, err)
+}
+
+// backup holds the path and timestamp of a rotated file.
+type backup struct {
+	path      string
+	timestamp time.Time
+	seq       int
+}
+
+// millRun compresses rotated files and removes rotated files
+// exceeding MaxBackups and MaxAge.
+func (w *FileWriter) millRun() error {
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+
+	var remove []backup
+	if w.options.MaxBackups > 0 && len(backups) > w.options.MaxBackups {
+		remove = append(remove, backups[w.options.MaxBackups:]...)
+		backups = backups[:w.options.MaxBackups]
+	}
+	if w.options.MaxAge > 0 {
+		cutoff := w.now().Add(-w.options.MaxAge)
+		keep := backups[:0]
+		for _, b := range backups {
+			if b.timestamp.Before(cutoff) {
+				remove = append(remove, b)
+			} else {
+				keep = append(keep, b)
+			}
+		}
+		backups = keep
+	}
+
+	var errs []error
+	for _, b := range remove {
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if w.options.Compress {
+		for _, b := range backups {
+			if strings.HasSuffix(b.path, compressSuffix) {
+				continue
+			}
+			if err := compressFile(b.path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backups returns the rotated files, sorted with the newest first.
+func (w *FileWriter) backups() ([]backup, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.filename))
+	if err != nil {
+		return nil, err
+	}
+	prefix, ext := w.prefixAndExt()
+
+	var backups []backup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), compressSuffix)
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		t, seq, ok := parseBackupName(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if !ok {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(filepath.Dir(w.filename), entry.Name()), timestamp: t, seq: seq})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].timestamp.Equal(backups[j].timestamp) {
+			return backups[i].seq > backups[j].seq
+		}
+		return backups[i].timestamp.After(backups[j].timestamp)
+	})
+	return backups, nil
+}
+
+// parseBackupName parses the time and the optional sequence number of
+// the name of a rotated file, without its prefix and extension.
+func parseBackupName(name string) (time.Time, int, bool) {
+	if len(name) < len(backupTimeFormat) {
+		return time.Time{}, 0, false
+	}
+	t, err := time.Parse(backupTimeFormat, name[:len(backupTimeFormat)])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	rest := name[len(backupTimeFormat):]
+	if len(rest) == 0 {
+		return t, 0, true
+	}
+	seq, err := strconv.Atoi(strings.TrimPrefix(rest, "-"))
+	if err != nil || rest[0] != '-' || seq <= 0 {
+		return time.Time{}, 0, false
+	}
+	return t, seq, true
+}
+
+// compressFile compresses the file at path with gzip and
+// removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + compressSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+compressSuffix); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// multiWriter writes to several writers. Unlike io.MultiWriter
+// it writes to all writers even if one of them fails.
+type multiWriter struct {
+	writers []io.Writer
+}
+
+// Write writes b to all writers and returns the errors joined.
+func (m *multiWriter) Write(b []byte) (int, error) {
+	var errs []error
+	for _, w := range m.writers {
+		if _, err := w.Write(b); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(b), errors.Join(errs...)
+}
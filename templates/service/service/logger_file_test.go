@@ -0,0 +1,446 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileWriter(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			options FileOptions
+			writes  []string
+			after   time.Duration
+		}
+		want struct {
+			current string
+			backups []string
+		}
+	}{
+		{
+			name: "no rotation",
+			input: struct {
+				options FileOptions
+				writes  []string
+				after   time.Duration
+			}{
+				options: FileOptions{MaxSize: 100},
+				writes:  []string{"first\n", "second\n"},
+			},
+			want: struct {
+				current string
+				backups []string
+			}{
+				current: "first\nsecond\n",
+			},
+		},
+		{
+			name: "rotate on size",
+			input: struct {
+				options FileOptions
+				writes  []string
+				after   time.Duration
+			}{
+				options: FileOptions{MaxSize: 8},
+				writes:  []string{"first\n", "second\n", "third\n"},
+			},
+			want: struct {
+				current string
+				backups []string
+			}{
+				current: "third\n",
+				backups: []string{"second\n", "first\n"},
+			},
+		},
+		{
+			name: "rotate on interval",
+			input: struct {
+				options FileOptions
+				writes  []string
+				after   time.Duration
+			}{
+				options: FileOptions{Interval: time.Hour},
+				writes:  []string{"first\n", "second\n"},
+				after:   time.Hour,
+			},
+			want: struct {
+				current string
+				backups []string
+			}{
+				current: "second\n",
+				backups: []string{"first\n"},
+			},
+		},
+		{
+			name: "max backups",
+			input: struct {
+				options FileOptions
+				writes  []string
+				after   time.Duration
+			}{
+				options: FileOptions{MaxSize: 8, MaxBackups: 1},
+				writes:  []string{"first\n", "second\n", "third\n"},
+			},
+			want: struct {
+				current string
+				backups []string
+			}{
+				current: "third\n",
+				backups: []string{"second\n"},
+			},
+		},
+		{
+			name: "max age",
+			input: struct {
+				options FileOptions
+				writes  []string
+				after   time.Duration
+			}{
+				options: FileOptions{MaxSize: 8, MaxAge: 90 * time.Minute},
+				writes:  []string{"first\n", "second\n", "third\n"},
+				after:   time.Hour,
+			},
+			want: struct {
+				current string
+				backups []string
+			}{
+				current: "third\n",
+				backups: []string{"second\n"},
+			},
+		},
+		{
+			name: "compress",
+			input: struct {
+				options FileOptions
+				writes  []string
+				after   time.Duration
+			}{
+				options: FileOptions{MaxSize: 8, Compress: true},
+				writes:  []string{"first\n", "second\n"},
+			},
+			want: struct {
+				current string
+				backups []string
+			}{
+				current: "second\n",
+				backups: []string{"first\n"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "app.log")
+
+			w, err := NewFileWriter(filename, test.input.options)
+			if err != nil {
+				t.Fatalf("NewFileWriter() = unexpected error: %v", err)
+			}
+
+			clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			w.mu.Lock()
+			w.now = clock.now
+			w.opened = clock.now()
+			w.mu.Unlock()
+
+			for _, s := range test.input.writes {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatalf("Write() = unexpected error: %v", err)
+				}
+				clock.add(test.input.after + time.Second)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() = unexpected error: %v", err)
+			}
+
+			current, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("unexpected error reading file: %v", err)
+			}
+			if diff := cmp.Diff(test.want.current, string(current)); diff != "" {
+				t.Errorf("Write() = unexpected result (-want +got):\n%s\n", diff)
+			}
+
+			backups := readBackups(t, dir, test.input.options.Compress)
+			if diff := cmp.Diff(test.want.backups, backups); diff != "" {
+				t.Errorf("Write() = unexpected backups (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestFileWriter_Reopen(t *testing.T) {
+	t.Run("reopen after move", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+
+		w, err := NewFileWriter(filename, FileOptions{})
+		if err != nil {
+			t.Fatalf("NewFileWriter() = unexpected error: %v", err)
+		}
+		defer w.Close()
+
+		w.Write([]byte("first\n"))
+		if err := os.Rename(filename, filename+".1"); err != nil {
+			t.Fatalf("unexpected error renaming file: %v", err)
+		}
+		if err := w.Reopen(); err != nil {
+			t.Fatalf("Reopen() = unexpected error: %v", err)
+		}
+		w.Write([]byte("second\n"))
+
+		got, _ := os.ReadFile(filename)
+		if diff := cmp.Diff("second\n", string(got)); diff != "" {
+			t.Errorf("Reopen() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("keep file when reopen fails", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+
+		w, err := NewFileWriter(filename, FileOptions{})
+		if err != nil {
+			t.Fatalf("NewFileWriter() = unexpected error: %v", err)
+		}
+		defer w.Close()
+
+		if err := os.Rename(filename, filename+".1"); err != nil {
+			t.Fatalf("unexpected error renaming file: %v", err)
+		}
+		if err := os.Mkdir(filename, 0755); err != nil {
+			t.Fatalf("unexpected error creating directory: %v", err)
+		}
+		if err := w.Reopen(); err == nil {
+			t.Errorf("Reopen() = nil; want error")
+		}
+		if _, err := w.Write([]byte("first\n")); err != nil {
+			t.Fatalf("Write() = unexpected error: %v", err)
+		}
+
+		got, _ := os.ReadFile(filename + ".1")
+		if diff := cmp.Diff("first\n", string(got)); diff != "" {
+			t.Errorf("Reopen() = unexpected result (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		w, err := NewFileWriter(filepath.Join(t.TempDir(), "app.log"), FileOptions{})
+		if err != nil {
+			t.Fatalf("NewFileWriter() = unexpected error: %v", err)
+		}
+		w.Close()
+
+		if err := w.Reopen(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("Reopen() = unexpected error, want: %v, got: %v", os.ErrClosed, err)
+		}
+		if _, err := w.Write([]byte("test")); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("Write() = unexpected error, want: %v, got: %v", os.ErrClosed, err)
+		}
+	})
+}
+
+func TestFileWriter_Rotate_Error(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	w, err := NewFileWriter(filename, FileOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("NewFileWriter() = unexpected error: %v", err)
+	}
+	defer w.Close()
+	errOut := &bytes.Buffer{}
+	w.now, w.errOut = clock.now, errOut
+
+	// A non-empty directory with the name of the backup makes the
+	// rename fail.
+	if err := os.MkdirAll(filepath.Join(w.backupName(clock.now().Format(backupTimeFormat), 0), "x"), 0755); err != nil {
+		t.Fatalf("unexpected error creating directory: %v", err)
+	}
+	for _, s := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatalf("Write() = unexpected error: %v", err)
+		}
+	}
+
+	got, _ := os.ReadFile(filename)
+	if diff := cmp.Diff("first\nsecond\nthird\n", string(got)); diff != "" {
+		t.Errorf("Write() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if n := strings.Count(errOut.String(), "\n"); n != 1 {
+		t.Errorf("Write() = unexpected reports, want: 1, got: %d (%q)", n, errOut.String())
+	}
+}
+
+func TestFileWriter_Rotate_SameTime(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	w, err := NewFileWriter(filename, FileOptions{MaxSize: 8})
+	if err != nil {
+		t.Fatalf("NewFileWriter() = unexpected error: %v", err)
+	}
+	defer w.Close()
+	w.mu.Lock()
+	w.now = clock.now
+	w.mu.Unlock()
+
+	for _, s := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatalf("Write() = unexpected error: %v", err)
+		}
+	}
+
+	w.mu.Lock()
+	backups, err := w.backups()
+	w.mu.Unlock()
+	if err != nil {
+		t.Fatalf("backups() = unexpected error: %v", err)
+	}
+	var got []string
+	for _, b := range backups {
+		data, err := os.ReadFile(b.path)
+		if err != nil {
+			t.Fatalf("unexpected error reading backup: %v", err)
+		}
+		got = append(got, string(data))
+	}
+
+	if diff := cmp.Diff([]string{"third\n", "second\n", "first\n"}, got); diff != "" {
+		t.Errorf("Write() = unexpected backups (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		wantSeq int
+		wantOK  bool
+	}{
+		{
+			name:   "without sequence number",
+			input:  "2024-01-01T00-00-00.000",
+			wantOK: true,
+		},
+		{
+			name:    "with sequence number",
+			input:   "2024-01-01T00-00-00.000-2",
+			wantSeq: 2,
+			wantOK:  true,
+		},
+		{
+			name:  "invalid sequence number",
+			input: "2024-01-01T00-00-00.000x2",
+		},
+		{
+			name:  "invalid time",
+			input: "2024-01-01",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, seq, ok := parseBackupName(test.input)
+			if seq != test.wantSeq || ok != test.wantOK {
+				t.Errorf("parseBackupName() = %d, %t; want %d, %t", seq, ok, test.wantSeq, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestMultiWriter(t *testing.T) {
+	t.Run("write to all", func(t *testing.T) {
+		first, second := &bytes.Buffer{}, &bytes.Buffer{}
+		w := &multiWriter{writers: []io.Writer{first, &errWriter{}, second}}
+
+		n, err := w.Write([]byte("test"))
+		if err == nil {
+			t.Errorf("Write() = nil; want error")
+		}
+		if n != 4 {
+			t.Errorf("Write() = unexpected result, want: 4, got: %d", n)
+		}
+		if first.String() != "test" || second.String() != "test" {
+			t.Errorf("Write() = unexpected result, want: test, got: %s and %s", first.String(), second.String())
+		}
+	})
+}
+
+func readBackups(t *testing.T, dir string, compressed bool) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading directory: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() == "app.log" {
+			continue
+		}
+		if compressed != strings.HasSuffix(entry.Name(), compressSuffix) {
+			t.Errorf("unexpected backup: %s", entry.Name())
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	var backups []string
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("unexpected error opening backup: %v", err)
+		}
+		var r io.Reader = f
+		if compressed {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("unexpected error reading backup: %v", err)
+			}
+			r = gz
+		}
+		b, _ := io.ReadAll(r)
+		f.Close()
+		backups = append(backups, string(b))
+	}
+	return backups
+}
+
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+type errWriter struct{}
+
+func (w *errWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write error")
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for log sampling.
+const (
+	defaultSamplingInterval = time.Second
+)
+
+// SamplingOptions holds the configuration for log sampling.
+type SamplingOptions struct {
+	// Interval is the window during which occurrences of a message
+	// are counted. Defaults to 1 second.
+	Interval time.Duration
+	// First is the number of occurrences of a message (per key) that
+	// are logged during each interval. If 0, messages are not sampled.
+	First int
+	// Thereafter is the rate at which messages are logged after
+	// First has been reached. 1 in Thereafter messages will be logged.
+	// If 0, all messages after First are dropped.
+	Thereafter int
+	// Levels holds thresholds per level. Levels not present
+	// uses First and Thereafter.
+	Levels map[slog.Level]SamplingThreshold
+	// Keys are attribute keys which values are included together
+	// with the message when determining if records are identical.
+	Keys []string
+}
+
+// SamplingThreshold holds the thresholds for a specific level.
+type SamplingThreshold struct {
+	First      int
+	Thereafter int
+}
+
+// threshold returns the threshold for the given level.
+func (o SamplingOptions) threshold(level slog.Level) SamplingThreshold {
+	if t, ok := o.Levels[level]; ok {
+		return t
+	}
+	return SamplingThreshold{First: o.First, Thereafter: o.Thereafter}
+}
+
+// samplingHandler is a slog.Handler that samples records based on
+// their level, message and configured keys.
+type samplingHandler struct {
+	handler slog.Handler
+	sampler *sampler
+	scope   string
+}
+
+// NewSamplingHandler returns a new slog.Handler that keeps the first N
+// occurrences of a message per interval and thereafter logs 1 in M.
+// A summary of suppressed messages is logged once per interval.
+func NewSamplingHandler(handler slog.Handler, options SamplingOptions) *samplingHandler {
+	if options.Interval <= 0 {
+		options.Interval = defaultSamplingInterval
+	}
+	s := &sampler{
+		handler:  handler,
+		options:  options,
+		counters: make(map[string]*sampleCounter),
+		now:      time.Now,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go s.run()
+
+	return &samplingHandler{
+		handler: handler,
+		sampler: s,
+	}
+}
+
+// Enabled reports whether the underlying handler handles records at the given level.
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle passes the record to the underlying handler if it is not
+// to be sampled away.
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.sampler.allow(h.scope, r) {
+		return nil
+	}
+	return h.handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new samplingHandler with the given attributes
+// that shares sampling state with h. The attributes are included in
+// the key of its records, so that loggers with different attributes
+// are sampled separately.
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.scope)
+	for _, a := range attrs {
+		b.WriteByte(0)
+		b.WriteString(a.String())
+	}
+	return &samplingHandler{handler: h.handler.WithAttrs(attrs), sampler: h.sampler, scope: b.String()}
+}
+
+// WithGroup returns a new samplingHandler with the given group
+// that shares sampling state with h. The group is included in the
+// key of its records.
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{handler: h.handler.WithGroup(name), sampler: h.sampler, scope: h.scope + "\x00" + name + "."}
+}
+
+// Close stops the sampler and logs summaries of any remaining
+// suppressed messages.
+func (h *samplingHandler) Close() error {
+	h.sampler.close()
+	return nil
+}
+
+// sampler holds the state for sampling shared between a samplingHandler
+// and the handlers derived from it.
+type sampler struct {
+	handler  slog.Handler
+	options  SamplingOptions
+	mu       sync.Mutex
+	counters map[string]*sampleCounter
+	now      func() time.Time
+	once     sync.Once
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// sampleCounter keeps track of the occurrences of a message during
+// an interval.
+type sampleCounter struct {
+	level      slog.Level
+	msg        string
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether the record of a handler with the scope should
+// be logged.
+func (s *sampler) allow(scope string, r slog.Record) bool {
+	t := s.options.threshold(r.Level)
+	if t.First <= 0 {
+		return true
+	}
+	key := s.key(scope, r)
+	now := s.now()
+
+	s.mu.Lock()
+	c, ok := s.counters[key]
+	if !ok {
+		c = &sampleCounter{level: r.Level, msg: r.Message, start: now}
+		s.counters[key] = c
+	}
+	var summary *sampleCounter
+	if now.Sub(c.start) >= s.options.Interval {
+		if c.suppressed > 0 {
+			summary = &sampleCounter{level: c.level, msg: c.msg, suppressed: c.suppressed}
+		}
+		c.start, c.count, c.suppressed = now, 0, 0
+	}
+	c.count++
+	allow := c.count <= t.First || (t.Thereafter > 0 && (c.count-t.First)%t.Thereafter == 0)
+	if !allow {
+		c.suppressed++
+	}
+	s.mu.Unlock()
+
+	if summary != nil {
+		s.summarize(summary)
+	}
+	return allow
+}
+
+// key returns the key used to determine if records are identical. The
+// scope holds the attributes and groups of the handler.
+func (s *sampler) key(scope string, r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(scope)
+	b.WriteByte(0)
+	b.WriteString(r.Level.String())
+	b.WriteByte(0)
+	b.WriteString(r.Message)
+	if len(s.options.Keys) == 0 {
+		return b.String()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		for _, k := range s.options.Keys {
+			if a.Key == k {
+				b.WriteByte(0)
+				b.WriteString(k)
+				b.WriteByte('=')
+				b.WriteString(a.Value.String())
+			}
+		}
+		return true
+	})
+	return b.String()
+}
+
+// run flushes expired counters once every interval until the sampler is closed.
+func (s *sampler) run() {
+	defer close(s.doneCh)
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(false)
+		case <-s.stopCh:
+			s.flush(true)
+			return
+		}
+	}
+}
+
+// flush logs summaries for counters with suppressed messages whose
+// interval has passed, and removes them. If all is true every
+// counter is flushed regardless of interval.
+func (s *sampler) flush(all bool) {
+	now := s.now()
+	var summaries []*sampleCounter
+
+	s.mu.Lock()
+	for key, c := range s.counters {
+		if !all && now.Sub(c.start) < s.options.Interval {
+			continue
+		}
+		if c.suppressed > 0 {
+			summaries = append(summaries, c)
+		}
+		delete(s.counters, key)
+	}
+	s.mu.Unlock()
+
+	for _, c := range summaries {
+		s.summarize(c)
+	}
+}
+
+// summarize logs a summary of suppressed messages.
+func (s *sampler) summarize(c *sampleCounter) {
+	ctx := context.Background()
+	if !s.handler.Enabled(ctx, c.level) {
+		return
+	}
+	r := slog.NewRecord(s.now(), c.level, fmt.Sprintf("Suppressed %d messages.", c.suppressed), 0)
+	r.AddAttrs(slog.String("message", c.msg), slog.Int("suppressed", c.suppressed))
+	s.handler.Handle(ctx, r)
+}
+
+// close stops the sampler. It is safe to call multiple times.
+func (s *sampler) close() {
+	s.once.Do(func() {
+		close(s.stopCh)
+	})
+	<-s.doneCh
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package service
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock does not lock the file on platforms without flock, and
+// always reports it as locked.
+func tryLock(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// removeAndUnlock closes the file and then removes it, since an open
+// file cannot be removed on all platforms.
+func removeAndUnlock(f *os.File, path string) error {
+	err := f.Close()
+	return errors.Join(err, os.Remove(path))
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.pid")
+	p := newPIDFile(path)
+
+	stale, err := p.lock()
+	if err != nil {
+		t.Fatalf("lock() = unexpected error: %v", err)
+	}
+	if stale != 0 {
+		t.Errorf("lock() = stale pid %d; want 0", stale)
+	}
+	b, _ := os.ReadFile(path)
+	if diff := cmp.Diff(strconv.Itoa(os.Getpid())+"\n", string(b)); diff != "" {
+		t.Errorf("lock() = unexpected content (-want +got):\n%s\n", diff)
+	}
+
+	// The lock is held per open file, so it is held against another
+	// pidFile in the same process as well.
+	_, err = newPIDFile(path).lock()
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("lock() = %v; want %v", err, ErrLocked)
+	}
+	want := ErrLocked.Error() + ": " + path + " is locked by pid " + strconv.Itoa(os.Getpid())
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		t.Errorf("lock() = unexpected error (-want +got):\n%s\n", diff)
+	}
+
+	if err := p.unlock(); err != nil {
+		t.Fatalf("unlock() = unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unlock() = PID file not removed")
+	}
+	if err := p.unlock(); err != nil {
+		t.Errorf("unlock() = unexpected error: %v", err)
+	}
+}
+
+func TestPIDFile_Stale(t *testing.T) {
+	// A PID file left behind by a crashed process is not locked.
+	path := filepath.Join(t.TempDir(), "service.pid")
+	if err := os.WriteFile(path, []byte("4194305\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := newPIDFile(path)
+	stale, err := p.lock()
+	if err != nil {
+		t.Fatalf("lock() = unexpected error: %v", err)
+	}
+	defer p.unlock()
+
+	if stale != 4194305 {
+		t.Errorf("lock() = stale pid %d; want 4194305", stale)
+	}
+	b, _ := os.ReadFile(path)
+	if diff := cmp.Diff(strconv.Itoa(os.Getpid())+"\n", string(b)); diff != "" {
+		t.Errorf("lock() = unexpected content (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestPIDFile_Nil(t *testing.T) {
+	p := newPIDFile("")
+	if _, err := p.lock(); err != nil {
+		t.Errorf("lock() = unexpected error: %v", err)
+	}
+	if err := p.unlock(); err != nil {
+		t.Errorf("unlock() = unexpected error: %v", err)
+	}
+}
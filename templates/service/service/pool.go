@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultPoolQueueSize is the default size of the queue of a Pool.
+const defaultPoolQueueSize = 100
+
+var (
+	// ErrPoolFull is returned when a task is rejected since the queue
+	// of the pool is full.
+	ErrPoolFull = errors.New("pool queue is full")
+	// ErrPoolClosed is returned when a task is submitted to a pool that
+	// is stopping.
+	ErrPoolClosed = errors.New("pool is closed")
+	// ErrPoolDrain is returned when the tasks of a pool could not be
+	// drained before the deadline.
+	ErrPoolDrain = errors.New("pool not drained")
+	// ErrTaskPanic is returned when a task panics.
+	ErrTaskPanic = errors.New("task panicked")
+)
+
+// Task is a unit of work run by a Pool. It should return when the
+// context is done.
+type Task func(ctx context.Context) error
+
+// OverflowPolicy decides what happens when a task is submitted to a
+// pool with a full queue.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks until there is room in the queue or the
+	// context of the submit is done. This is the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the task with ErrPoolFull.
+	OverflowReject
+)
+
+// PoolOptions holds the configuration for a Pool.
+type PoolOptions struct {
+	// Logger is the logger of the pool. Defaults to NewLogger().
+	Logger logger
+	// Concurrency is the number of tasks run at the same time.
+	// Defaults to the number of CPUs.
+	Concurrency int
+	// QueueSize is the number of tasks that can wait to be run.
+	// Defaults to 100.
+	QueueSize int
+	// Overflow is the policy when the queue is full.
+	Overflow OverflowPolicy
+	// TaskTimeout is the timeout of every task. No timeout if not set.
+	TaskTimeout time.Duration
+}
+
+// PoolStats holds the queue depth and throughput of a Pool.
+type PoolStats struct {
+	Concurrency int
+	QueueSize   int
+	Queued      int
+	Running     int
+	Submitted   int64
+	Completed   int64
+	Failed      int64
+	Rejected    int64
+	Dropped     int64
+}
+
+// poolTask is a submitted Task.
+type poolTask struct {
+	ctx  context.Context
+	name string
+	run  Task
+}
+
+// Pool runs submitted tasks with a bounded concurrency and queue. It
+// implements Component, and is stopped by draining the queued and
+// running tasks within the deadline of the context passed to Stop.
+type Pool struct {
+	log         logger
+	concurrency int
+	overflow    OverflowPolicy
+	timeout     time.Duration
+	queue       chan *poolTask
+	mu          sync.RWMutex
+	closed      bool
+	stopping    chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	startOnce   sync.Once
+	stopOnce    sync.Once
+	runningMu   sync.Mutex
+	running     map[*poolTask]struct{}
+	submitted   atomic.Int64
+	completed   atomic.Int64
+	failed      atomic.Int64
+	rejected    atomic.Int64
+	dropped     atomic.Int64
+}
+
+// NewPool returns a new Pool. It must be started with Start, either
+// directly or by registering it as a component of the service.
+func NewPool(options PoolOptions) *Pool {
+	if options.Logger == nil {
+		options.Logger = NewLogger()
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = runtime.NumCPU()
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultPoolQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		log:         options.Logger,
+		concurrency: options.Concurrency,
+		overflow:    options.Overflow,
+		timeout:     options.TaskTimeout,
+		queue:       make(chan *poolTask, options.QueueSize),
+		stopping:    make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		running:     make(map[*poolTask]struct{}),
+	}
+}
+
+// Start the workers of the pool.
+func (p *Pool) Start(ctx context.Context) error {
+	p.startOnce.Do(func() {
+		for i := 0; i < p.concurrency; i++ {
+			p.wg.Add(1)
+			go p.work()
+		}
+	})
+	return nil
+}
+
+// Stop accepting tasks and drain the queued and running tasks. If the
+// context is done before the tasks are drained, the running tasks are
+// cancelled, the queued tasks are dropped and ErrPoolDrain is returned.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stopping)
+		p.mu.Lock()
+		p.closed = true
+		close(p.queue)
+		p.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	var running []string
+	p.runningMu.Lock()
+	for t := range p.running {
+		running = append(running, t.name)
+	}
+	p.runningMu.Unlock()
+	queued := len(p.queue)
+
+	for _, name := range running {
+		p.log.Error("Task not finished.", "task", name)
+	}
+	p.cancel()
+	return fmt.Errorf("%w: %d running and %d queued tasks", ErrPoolDrain, len(running), queued)
+}
+
+// Submit a task with the given name to the pool. The task is run with
+// a context that has the values of ctx, and that is cancelled when the
+// task timeout is exceeded or when the pool fails to drain. If the
+// queue is full the task is rejected or blocks according to the
+// overflow policy.
+func (p *Pool) Submit(ctx context.Context, name string, task Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	t := &poolTask{ctx: context.WithoutCancel(ctx), name: name, run: task}
+	if p.overflow == OverflowReject {
+		select {
+		case p.queue <- t:
+		default:
+			p.rejected.Add(1)
+			return ErrPoolFull
+		}
+	} else {
+		select {
+		case p.queue <- t:
+		case <-ctx.Done():
+			p.rejected.Add(1)
+			return ctx.Err()
+		case <-p.stopping:
+			return ErrPoolClosed
+		}
+	}
+	p.submitted.Add(1)
+	return nil
+}
+
+// Stats returns the queue depth and throughput of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.runningMu.Lock()
+	running := len(p.running)
+	p.runningMu.Unlock()
+
+	return PoolStats{
+		Concurrency: p.concurrency,
+		QueueSize:   cap(p.queue),
+		Queued:      len(p.queue),
+		Running:     running,
+		Submitted:   p.submitted.Load(),
+		Completed:   p.completed.Load(),
+		Failed:      p.failed.Load(),
+		Rejected:    p.rejected.Load(),
+		Dropped:     p.dropped.Load(),
+	}
+}
+
+// work runs tasks from the queue until it is closed and drained. Tasks
+// are dropped if the pool failed to drain.
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.queue {
+		if p.ctx.Err() != nil {
+			p.dropped.Add(1)
+			p.log.Error("Task dropped.", "task", t.name)
+			continue
+		}
+		p.execute(t)
+	}
+}
+
+// execute runs the task within its timeout.
+func (p *Pool) execute(t *poolTask) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+	if p.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, p.timeout)
+		defer cancelTimeout()
+	}
+
+	p.runningMu.Lock()
+	p.running[t] = struct{}{}
+	p.runningMu.Unlock()
+	defer func() {
+		p.runningMu.Lock()
+		delete(p.running, t)
+		p.runningMu.Unlock()
+	}()
+
+	if err := p.call(ctx, t); err != nil {
+		p.failed.Add(1)
+		p.log.Error("Task failed.", "task", t.name, "error", err)
+		return
+	}
+	p.completed.Add(1)
+}
+
+// call the task and recover from a panic, which is returned as an
+// error.
+func (p *Pool) call(ctx context.Context, t *poolTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.log.Error("Task panicked.", "task", t.name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = fmt.Errorf("%w: %v", ErrTaskPanic, r)
+		}
+	}()
+	return t.run(ctx)
+}
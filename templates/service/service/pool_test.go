@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPool(t *testing.T) {
+	logs := []string{}
+	p := NewPool(PoolOptions{
+		Logger:      &mockLogger{logs: &logs},
+		Concurrency: 3,
+		QueueSize:   5,
+	})
+	p.Start(context.Background())
+
+	var running, maxRunning atomic.Int32
+	for i := 0; i < 20; i++ {
+		err := p.Submit(context.Background(), "task", func(ctx context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Submit() = unexpected error: %v", err)
+		}
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() = unexpected error: %v", err)
+	}
+
+	if maxRunning.Load() > 3 {
+		t.Errorf("Submit() = %d concurrent tasks; want at most 3", maxRunning.Load())
+	}
+	want := PoolStats{Concurrency: 3, QueueSize: 5, Submitted: 20, Completed: 20}
+	if diff := cmp.Diff(want, p.Stats()); diff != "" {
+		t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if err := p.Submit(context.Background(), "task", func(ctx context.Context) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit() = %v; want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPool_Submit(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input OverflowPolicy
+		want  error
+	}{
+		{
+			name:  "reject",
+			input: OverflowReject,
+			want:  ErrPoolFull,
+		},
+		{
+			name:  "block",
+			input: OverflowBlock,
+			want:  context.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPool(PoolOptions{
+				Logger:      &mockLogger{logs: &[]string{}},
+				Concurrency: 1,
+				QueueSize:   1,
+				Overflow:    test.input,
+			})
+			task := func(ctx context.Context) error { return nil }
+
+			if err := p.Submit(context.Background(), "first", task); err != nil {
+				t.Fatalf("Submit() = unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			gotErr := p.Submit(ctx, "second", task)
+			if !errors.Is(gotErr, test.want) {
+				t.Errorf("Submit() = %v; want %v", gotErr, test.want)
+			}
+			want := PoolStats{Concurrency: 1, QueueSize: 1, Queued: 1, Submitted: 1, Rejected: 1}
+			if diff := cmp.Diff(want, p.Stats()); diff != "" {
+				t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestPool_Task(t *testing.T) {
+	type key struct{}
+
+	var tests = []struct {
+		name  string
+		input Task
+		want  struct {
+			stats PoolStats
+			logs  []string
+		}
+	}{
+		{
+			name: "context values",
+			input: func(ctx context.Context) error {
+				if ctx.Value(key{}) != "value" {
+					return errors.New("missing value")
+				}
+				return ctx.Err()
+			},
+			want: struct {
+				stats PoolStats
+				logs  []string
+			}{
+				stats: PoolStats{Concurrency: 1, QueueSize: 1, Submitted: 1, Completed: 1},
+				logs:  []string{},
+			},
+		},
+		{
+			name: "timeout",
+			input: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			want: struct {
+				stats PoolStats
+				logs  []string
+			}{
+				stats: PoolStats{Concurrency: 1, QueueSize: 1, Submitted: 1, Failed: 1},
+				logs:  []string{"Task failed.", "task", "task", "error", "context deadline exceeded"},
+			},
+		},
+		{
+			name: "panic",
+			input: func(ctx context.Context) error {
+				panic("task panic")
+			},
+			want: struct {
+				stats PoolStats
+				logs  []string
+			}{
+				stats: PoolStats{Concurrency: 1, QueueSize: 1, Submitted: 1, Failed: 1},
+				logs:  []string{"Task failed.", "task", "task", "error", "task panicked: task panic"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := []string{}
+			p := NewPool(PoolOptions{
+				Logger:      &mockLogger{logs: &logs},
+				Concurrency: 1,
+				QueueSize:   1,
+				TaskTimeout: 10 * time.Millisecond,
+			})
+			p.Start(context.Background())
+
+			// The task must not be cancelled with the context it was
+			// submitted with.
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+			if err := p.Submit(ctx, "task", test.input); err != nil {
+				t.Fatalf("Submit() = unexpected error: %v", err)
+			}
+			cancel()
+			if err := p.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop() = unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(test.want.stats, p.Stats()); diff != "" {
+				t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+			}
+			// Skip the panic and stack trace.
+			if len(logs) > 0 && logs[0] == "Task panicked." {
+				logs = logs[7:]
+			}
+			if diff := cmp.Diff(test.want.logs, logs); diff != "" {
+				t.Errorf("execute() = unexpected logs (-want +got):\n%s\n", diff)
+			}
+		})
+	}
+}
+
+func TestPool_Stop(t *testing.T) {
+	logs := []string{}
+	p := NewPool(PoolOptions{
+		Logger:      &mockLogger{logs: &logs},
+		Concurrency: 1,
+		QueueSize:   2,
+	})
+	p.Start(context.Background())
+
+	started := make(chan struct{})
+	p.Submit(context.Background(), "slow", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	p.Submit(context.Background(), "queued", func(ctx context.Context) error { return nil })
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); !errors.Is(err, ErrPoolDrain) {
+		t.Fatalf("Stop() = %v; want %v", err, ErrPoolDrain)
+	}
+	p.wg.Wait()
+
+	want := []string{
+		"Task not finished.", "task", "slow",
+		"Task failed.", "task", "slow", "error", "context canceled",
+		"Task dropped.", "task", "queued",
+	}
+	if diff := cmp.Diff(want, logs); diff != "" {
+		t.Errorf("Stop() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+	wantStats := PoolStats{Concurrency: 1, QueueSize: 2, Submitted: 2, Failed: 1, Dropped: 1}
+	if diff := cmp.Diff(wantStats, p.Stats()); diff != "" {
+		t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -0,0 +1,583 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultQueueSegmentSize is the default size of the segment before
+	// it is compacted.
+	defaultQueueSegmentSize = 64 << 20
+	// defaultQueueSyncInterval is the default interval between syncs
+	// with SyncInterval.
+	defaultQueueSyncInterval = time.Second
+	// defaultQueueVisibilityTimeout is the default duration a received
+	// message is invisible before it is delivered again.
+	defaultQueueVisibilityTimeout = 30 * time.Second
+	// defaultQueueMaxAttempts is the default number of deliveries of
+	// a message before it is moved to the dead letters.
+	defaultQueueMaxAttempts = 5
+)
+
+var (
+	// ErrQueueClosed is returned when the queue is not started or has
+	// been stopped.
+	ErrQueueClosed = errors.New("queue is closed")
+	// ErrMessageNotFound is returned when a message to acknowledge is
+	// not in the queue.
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrMessageTooLarge is returned when the data of a message exceeds
+	// the maximum size of a record of the write-ahead log.
+	ErrMessageTooLarge = errors.New("message too large")
+)
+
+// SyncPolicy decides when the writes to the queue are synced to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs after every write. This is the default.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval syncs at an interval. Writes since the last sync
+	// can be lost if the machine crashes.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system.
+	SyncNever
+)
+
+// QueueOptions holds the configuration for a Queue.
+type QueueOptions struct {
+	// Logger is the logger of the queue. Defaults to NewLogger().
+	Logger logger
+	// SegmentSize is the size of the segment file before it is
+	// compacted. Defaults to 64 MiB.
+	SegmentSize int64
+	// Sync is the sync policy of the queue.
+	Sync SyncPolicy
+	// SyncInterval is the interval between syncs with SyncInterval.
+	// Defaults to 1 second.
+	SyncInterval time.Duration
+	// VisibilityTimeout is the duration a received message is invisible
+	// to other receivers before it is delivered again, unless it is
+	// acknowledged. Defaults to 30 seconds.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the number of deliveries of a message before it is
+	// moved to the dead letters. Defaults to 5.
+	MaxAttempts int
+}
+
+// Message is a message of a Queue.
+type Message struct {
+	ID       uint64
+	Data     []byte
+	Attempts int
+}
+
+// QueueStats holds the number of messages in a Queue.
+type QueueStats struct {
+	Pending  int
+	InFlight int
+	Dead     int
+}
+
+// queueItem is a message and its delivery state.
+type queueItem struct {
+	msg       Message
+	inFlight  bool
+	visibleAt time.Time
+	dead      bool
+}
+
+// Queue is a persistent queue backed by a write-ahead log in a
+// directory. Messages are delivered at least once: a received message
+// is delivered again if it is not acknowledged within the visibility
+// timeout, and moved to the dead letters after the maximum attempts.
+// It implements Component, and the messages that are not acknowledged
+// are replayed when it is started.
+type Queue struct {
+	dir           string
+	log           logger
+	segmentSize   int64
+	sync          SyncPolicy
+	syncInterval  time.Duration
+	visibility    time.Duration
+	maxAttempts   int
+	mu            sync.Mutex
+	open          bool
+	seg           *segment
+	compactedSize int64
+	dirty         bool
+	items         map[uint64]*queueItem
+	pending       []uint64
+	nextID        uint64
+	ready         chan struct{}
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+	now           func() time.Time
+}
+
+// NewQueue returns a new Queue that stores its segment in the
+// directory. It must be started with Start, either directly or by
+// registering it as a component of the service.
+func NewQueue(dir string, options QueueOptions) *Queue {
+	if options.Logger == nil {
+		options.Logger = NewLogger()
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = defaultQueueSegmentSize
+	}
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = defaultQueueSyncInterval
+	}
+	if options.VisibilityTimeout <= 0 {
+		options.VisibilityTimeout = defaultQueueVisibilityTimeout
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultQueueMaxAttempts
+	}
+
+	return &Queue{
+		dir:          dir,
+		log:          options.Logger,
+		segmentSize:  options.SegmentSize,
+		sync:         options.Sync,
+		syncInterval: options.SyncInterval,
+		visibility:   options.VisibilityTimeout,
+		maxAttempts:  options.MaxAttempts,
+		ready:        make(chan struct{}),
+		now:          time.Now,
+	}
+}
+
+// Start the queue by replaying its segments. The messages that were
+// not acknowledged, including the ones that were in flight, are
+// pending again. The segments are compacted into a new segment.
+func (q *Queue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.open {
+		return nil
+	}
+
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return err
+	}
+	seqs, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+
+	q.items = make(map[uint64]*queueItem)
+	q.nextID = 1
+	for i, seq := range seqs {
+		if _, err := replaySegment(segmentName(q.dir, seq), i == len(seqs)-1, q.apply); err != nil {
+			return err
+		}
+	}
+
+	q.pending = q.pending[:0]
+	for _, id := range q.ids() {
+		if !q.items[id].dead {
+			q.pending = append(q.pending, id)
+		}
+	}
+
+	var seq uint64
+	if len(seqs) > 0 {
+		seq = seqs[len(seqs)-1]
+	}
+	if err := q.compact(seq); err != nil {
+		return err
+	}
+
+	q.open = true
+	q.stopCh = make(chan struct{})
+	if q.sync == SyncInterval {
+		q.wg.Add(1)
+		go q.syncLoop()
+	}
+
+	stats := q.stats()
+	q.log.Info("Queue started.", "pending", stats.Pending, "dead", stats.Dead)
+	return nil
+}
+
+// Stop the queue. The segment is synced and closed, and receivers
+// waiting for messages return ErrQueueClosed.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.open {
+		q.mu.Unlock()
+		return nil
+	}
+	q.open = false
+	close(q.stopCh)
+	q.notify()
+	err := errors.Join(q.seg.file.Sync(), q.seg.file.Close())
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	return err
+}
+
+// Enqueue a message with the data and return its ID. ErrMessageTooLarge
+// is returned if the data exceeds the maximum size of a record of the
+// write-ahead log.
+func (q *Queue) Enqueue(data []byte) (uint64, error) {
+	if len(data) > maxMessageSize {
+		return 0, fmt.Errorf("%w: %d bytes, maximum is %d bytes", ErrMessageTooLarge, len(data), maxMessageSize)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.open {
+		return 0, ErrQueueClosed
+	}
+
+	data = append([]byte(nil), data...)
+	id := q.nextID
+	if err := q.write(record{op: opEnqueue, id: id, data: data}); err != nil {
+		return 0, err
+	}
+	q.nextID++
+	q.items[id] = &queueItem{msg: Message{ID: id, Data: data}}
+	q.pending = append(q.pending, id)
+	q.notify()
+	q.maybeCompact()
+	return id, nil
+}
+
+// Receive the next pending message. It blocks until a message is
+// pending or the context is done. The message must be acknowledged
+// with Ack, or returned with Nack, within the visibility timeout.
+func (q *Queue) Receive(ctx context.Context) (Message, error) {
+	for {
+		q.mu.Lock()
+		if !q.open {
+			q.mu.Unlock()
+			return Message{}, ErrQueueClosed
+		}
+
+		now := q.now()
+		q.requeueExpired(now)
+		msg, ok, err := q.deliver(now)
+		if err != nil || ok {
+			q.mu.Unlock()
+			return msg, err
+		}
+
+		wait := q.nextVisible(now)
+		ready := q.ready
+		q.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ready:
+		case <-timeout:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return Message{}, err
+		}
+	}
+}
+
+// Ack acknowledges the message with the ID and removes it from the
+// queue. Dead letters are removed with Ack as well.
+func (q *Queue) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.open {
+		return ErrQueueClosed
+	}
+	if _, ok := q.items[id]; !ok {
+		return fmt.Errorf("%w: %d", ErrMessageNotFound, id)
+	}
+
+	if err := q.write(record{op: opAck, id: id}); err != nil {
+		return err
+	}
+	delete(q.items, id)
+	q.maybeCompact()
+	return nil
+}
+
+// Nack returns the received message with the ID to the queue to be
+// delivered again, or moves it to the dead letters if it has reached
+// the maximum attempts.
+func (q *Queue) Nack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.open {
+		return ErrQueueClosed
+	}
+	item, ok := q.items[id]
+	if !ok || !item.inFlight {
+		return fmt.Errorf("%w: %d", ErrMessageNotFound, id)
+	}
+
+	item.inFlight = false
+	if item.msg.Attempts >= q.maxAttempts {
+		return q.deadLetter(item)
+	}
+	q.pending = append(q.pending, id)
+	q.notify()
+	return nil
+}
+
+// Dead returns the dead letters, the messages that have reached the
+// maximum attempts.
+func (q *Queue) Dead() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var dead []Message
+	for _, id := range q.ids() {
+		if item := q.items[id]; item.dead {
+			dead = append(dead, item.msg)
+		}
+	}
+	return dead
+}
+
+// Compact the segment by writing the messages in the queue to a new
+// segment and removing the old one. The segment is compacted
+// automatically when it exceeds the segment size.
+func (q *Queue) Compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.open {
+		return ErrQueueClosed
+	}
+	return q.compact(q.seg.seq)
+}
+
+// Stats returns the number of messages in the queue.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats()
+}
+
+// stats returns the number of messages in the queue. The lock must be
+// held by the caller.
+func (q *Queue) stats() QueueStats {
+	var stats QueueStats
+	for _, item := range q.items {
+		switch {
+		case item.dead:
+			stats.Dead++
+		case item.inFlight:
+			stats.InFlight++
+		default:
+			stats.Pending++
+		}
+	}
+	return stats
+}
+
+// apply a replayed record to the messages.
+func (q *Queue) apply(rec record) {
+	switch rec.op {
+	case opEnqueue:
+		q.items[rec.id] = &queueItem{msg: Message{ID: rec.id, Data: rec.data, Attempts: rec.attempts}}
+		if rec.id >= q.nextID {
+			q.nextID = rec.id + 1
+		}
+	case opDeliver:
+		if item, ok := q.items[rec.id]; ok {
+			item.msg.Attempts++
+		}
+	case opAck:
+		delete(q.items, rec.id)
+	case opDead:
+		if item, ok := q.items[rec.id]; ok {
+			item.dead = true
+		}
+	}
+}
+
+// deliver the next pending message. Messages that have reached the
+// maximum attempts, from a crash or a visibility timeout, are moved to
+// the dead letters instead.
+func (q *Queue) deliver(now time.Time) (Message, bool, error) {
+	for len(q.pending) > 0 {
+		id := q.pending[0]
+		q.pending = q.pending[1:]
+		item, ok := q.items[id]
+		if !ok || item.dead || item.inFlight {
+			continue
+		}
+		if item.msg.Attempts >= q.maxAttempts {
+			if err := q.deadLetter(item); err != nil {
+				return Message{}, false, err
+			}
+			continue
+		}
+
+		if err := q.write(record{op: opDeliver, id: id}); err != nil {
+			q.pending = append([]uint64{id}, q.pending...)
+			return Message{}, false, err
+		}
+		item.msg.Attempts++
+		item.inFlight = true
+		item.visibleAt = now.Add(q.visibility)
+		return item.msg, true, nil
+	}
+	return Message{}, false, nil
+}
+
+// deadLetter moves the message to the dead letters.
+func (q *Queue) deadLetter(item *queueItem) error {
+	if err := q.write(record{op: opDead, id: item.msg.ID}); err != nil {
+		return err
+	}
+	item.dead = true
+	q.log.Error("Message moved to dead letters.", "id", item.msg.ID, "attempts", item.msg.Attempts)
+	return nil
+}
+
+// requeueExpired makes the messages in flight with an exceeded
+// visibility timeout pending again.
+func (q *Queue) requeueExpired(now time.Time) {
+	var expired []uint64
+	for id, item := range q.items {
+		if item.inFlight && !now.Before(item.visibleAt) {
+			item.inFlight = false
+			expired = append(expired, id)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+	q.pending = append(q.pending, expired...)
+}
+
+// nextVisible returns the duration until the next message in flight
+// is visible again, or 0 if there is none.
+func (q *Queue) nextVisible(now time.Time) time.Duration {
+	var next time.Duration
+	for _, item := range q.items {
+		if !item.inFlight {
+			continue
+		}
+		if d := item.visibleAt.Sub(now); next == 0 || d < next {
+			next = d
+		}
+	}
+	return next
+}
+
+// notify the receivers waiting for messages.
+func (q *Queue) notify() {
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// write the record to the segment, and sync it according to the sync
+// policy.
+func (q *Queue) write(rec record) error {
+	if err := q.seg.append(rec); err != nil {
+		return err
+	}
+	if q.sync == SyncAlways {
+		return q.seg.file.Sync()
+	}
+	q.dirty = true
+	return nil
+}
+
+// maybeCompact compacts the segment if it exceeds the segment size, or
+// twice the size of the last compaction if the messages in the queue
+// exceed the segment size.
+func (q *Queue) maybeCompact() {
+	if q.seg.size < max(q.segmentSize, 2*q.compactedSize) {
+		return
+	}
+	if err := q.compact(q.seg.seq); err != nil {
+		q.log.Error("Failed to compact queue.", "error", err)
+	}
+}
+
+// compact writes the messages to a new segment after the segment with
+// the sequence number, and removes the older segments.
+func (q *Queue) compact(seq uint64) error {
+	var records []record
+	for _, id := range q.ids() {
+		item := q.items[id]
+		records = append(records, record{op: opEnqueue, id: id, attempts: item.msg.Attempts, data: item.msg.Data})
+		if item.dead {
+			records = append(records, record{op: opDead, id: id})
+		}
+	}
+	if err := writeSegment(q.dir, seq+1, records); err != nil {
+		return err
+	}
+
+	if q.seg != nil {
+		q.seg.file.Close()
+	}
+	seg, err := openSegment(q.dir, seq+1)
+	if err != nil {
+		return err
+	}
+	q.seg, q.compactedSize, q.dirty = seg, seg.size, false
+
+	seqs, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range seqs {
+		if s <= seq {
+			if err := os.Remove(segmentName(q.dir, s)); err != nil {
+				return err
+			}
+		}
+	}
+	return syncDir(q.dir)
+}
+
+// syncLoop syncs the segment at the sync interval until the queue is
+// stopped.
+func (q *Queue) syncLoop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.dirty {
+				if err := q.seg.file.Sync(); err != nil {
+					q.log.Error("Failed to sync queue.", "error", err)
+				}
+				q.dirty = false
+			}
+			q.mu.Unlock()
+		case <-q.stopCh:
+			return
+		}
+	}
+}
+
+// ids returns the IDs of the messages in order.
+func (q *Queue) ids() []uint64 {
+	ids := make([]uint64, 0, len(q.items))
+	for id := range q.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	logs := []string{}
+	options := QueueOptions{Logger: &mockLogger{logs: &logs}}
+
+	q := NewQueue(dir, options)
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = unexpected error: %v", err)
+	}
+	for _, data := range []string{"a", "b", "c"} {
+		if _, err := q.Enqueue([]byte(data)); err != nil {
+			t.Fatalf("Enqueue() = unexpected error: %v", err)
+		}
+	}
+
+	first := receive(t, q)
+	if err := q.Ack(first.ID); err != nil {
+		t.Fatalf("Ack() = unexpected error: %v", err)
+	}
+	second := receive(t, q)
+	if diff := cmp.Diff(Message{ID: 2, Data: []byte("b"), Attempts: 1}, second); diff != "" {
+		t.Errorf("Receive() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff(QueueStats{Pending: 1, InFlight: 1}, q.Stats()); diff != "" {
+		t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if err := q.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() = unexpected error: %v", err)
+	}
+
+	// The message in flight is pending again after a restart.
+	q = NewQueue(dir, options)
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = unexpected error: %v", err)
+	}
+	defer q.Stop(context.Background())
+
+	got := []Message{receive(t, q), receive(t, q)}
+	want := []Message{
+		{ID: 2, Data: []byte("b"), Attempts: 2},
+		{ID: 3, Data: []byte("c"), Attempts: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Receive() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	id, _ := q.Enqueue([]byte("d"))
+	if id != 4 {
+		t.Errorf("Enqueue() = %d; want 4", id)
+	}
+
+	wantLogs := []string{
+		"Queue started.", "pending", "0", "dead", "0",
+		"Queue started.", "pending", "2", "dead", "0",
+	}
+	if diff := cmp.Diff(wantLogs, logs); diff != "" {
+		t.Errorf("Start() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestQueue_VisibilityTimeout(t *testing.T) {
+	q := NewQueue(t.TempDir(), QueueOptions{
+		Logger:            &mockLogger{logs: &[]string{}},
+		VisibilityTimeout: 20 * time.Millisecond,
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	q.Enqueue([]byte("a"))
+	first := receive(t, q)
+	start := time.Now()
+	second := receive(t, q)
+
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Receive() = delivered before the visibility timeout")
+	}
+	if diff := cmp.Diff(Message{ID: first.ID, Data: []byte("a"), Attempts: 2}, second); diff != "" {
+		t.Errorf("Receive() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if err := q.Ack(second.ID); err != nil {
+		t.Errorf("Ack() = unexpected error: %v", err)
+	}
+	if err := q.Ack(second.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Ack() = %v; want %v", err, ErrMessageNotFound)
+	}
+}
+
+func TestQueue_DeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	logs := []string{}
+	options := QueueOptions{
+		Logger:      &mockLogger{logs: &logs},
+		MaxAttempts: 2,
+	}
+	q := NewQueue(dir, options)
+	q.Start(context.Background())
+
+	q.Enqueue([]byte("a"))
+	for i := 0; i < 2; i++ {
+		msg := receive(t, q)
+		if err := q.Nack(msg.ID); err != nil {
+			t.Fatalf("Nack() = unexpected error: %v", err)
+		}
+	}
+	q.Stop(context.Background())
+
+	q = NewQueue(dir, options)
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	want := []Message{{ID: 1, Data: []byte("a"), Attempts: 2}}
+	if diff := cmp.Diff(want, q.Dead()); diff != "" {
+		t.Errorf("Dead() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Receive() = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := q.Ack(1); err != nil {
+		t.Fatalf("Ack() = unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(QueueStats{}, q.Stats()); diff != "" {
+		t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	wantLogs := []string{
+		"Queue started.", "pending", "0", "dead", "0",
+		"Message moved to dead letters.", "id", "1", "attempts", "2",
+		"Queue started.", "pending", "0", "dead", "1",
+	}
+	if diff := cmp.Diff(wantLogs, logs); diff != "" {
+		t.Errorf("Nack() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestQueue_Compact(t *testing.T) {
+	dir := t.TempDir()
+	q := NewQueue(dir, QueueOptions{
+		Logger:      &mockLogger{logs: &[]string{}},
+		SegmentSize: 1024,
+	})
+	q.Start(context.Background())
+	defer q.Stop(context.Background())
+
+	for i := 0; i < 100; i++ {
+		q.Enqueue([]byte("message"))
+		msg := receive(t, q)
+		q.Ack(msg.ID)
+	}
+	q.Enqueue([]byte("last"))
+
+	if q.seg.size >= 1024 {
+		t.Errorf("Compact() = segment size %d; want less than 1024", q.seg.size)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Compact() = %d files; want 1", len(entries))
+	}
+	if diff := cmp.Diff(Message{ID: 101, Data: []byte("last"), Attempts: 1}, receive(t, q)); diff != "" {
+		t.Errorf("Receive() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestQueue_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	options := QueueOptions{Logger: &mockLogger{logs: &[]string{}}}
+	q := NewQueue(dir, options)
+	q.Start(context.Background())
+	q.Enqueue([]byte("a"))
+	name := q.seg.file.Name()
+	q.Stop(context.Background())
+
+	// A partially written record from a crash.
+	f, _ := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(record{op: opEnqueue, id: 2, data: []byte("b")}.encode()[:10])
+	f.Close()
+
+	q = NewQueue(dir, options)
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = unexpected error: %v", err)
+	}
+	defer q.Stop(context.Background())
+
+	if diff := cmp.Diff(QueueStats{Pending: 1}, q.Stats()); diff != "" {
+		t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.Base(name))); !os.IsNotExist(err) {
+		t.Errorf("Start() = old segment not removed")
+	}
+}
+
+func TestQueue_Enqueue_TooLarge(t *testing.T) {
+	q := NewQueue(t.TempDir(), QueueOptions{Logger: &mockLogger{logs: &[]string{}}})
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start() = unexpected error: %v", err)
+	}
+	defer q.Stop(context.Background())
+	size := q.seg.size
+
+	if _, err := q.Enqueue(make([]byte, maxMessageSize+1)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Enqueue() = %v; want %v", err, ErrMessageTooLarge)
+	}
+	if diff := cmp.Diff(QueueStats{}, q.Stats()); diff != "" {
+		t.Errorf("Stats() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if q.seg.size != size {
+		t.Errorf("Enqueue() = %d bytes written; want 0", q.seg.size-size)
+	}
+
+	// The largest message fits in a record that can be replayed.
+	rec := record{op: opEnqueue, id: 1<<64 - 1, attempts: 1<<63 - 1, data: make([]byte, maxMessageSize)}
+	if _, _, err := readRecord(bytes.NewReader(rec.encode())); err != nil {
+		t.Errorf("readRecord() = unexpected error: %v", err)
+	}
+}
+
+func TestQueue_Receive(t *testing.T) {
+	q := NewQueue(t.TempDir(), QueueOptions{Logger: &mockLogger{logs: &[]string{}}})
+
+	if _, err := q.Enqueue([]byte("a")); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Enqueue() = %v; want %v", err, ErrQueueClosed)
+	}
+
+	q.Start(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Enqueue([]byte("a"))
+	}()
+	if diff := cmp.Diff(Message{ID: 1, Data: []byte("a"), Attempts: 1}, receive(t, q)); diff != "" {
+		t.Errorf("Receive() = unexpected result (-want +got):\n%s\n", diff)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Stop(context.Background())
+	}()
+	if _, err := q.Receive(context.Background()); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Receive() = %v; want %v", err, ErrQueueClosed)
+	}
+}
+
+func receive(t *testing.T, q *Queue) Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := q.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() = unexpected error: %v", err)
+	}
+	return msg
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// segmentSuffix is the suffix of the segment files.
+	segmentSuffix = ".wal"
+	// segmentTempSuffix is the suffix of segment files being written
+	// by a compaction.
+	segmentTempSuffix = ".tmp"
+	// recordHeaderSize is the size of the header of a record, the
+	// length and the checksum of the payload.
+	recordHeaderSize = 8
+	// maxRecordSize is the maximum size of the payload of a record.
+	maxRecordSize = 64 << 20
+	// maxMessageSize is the maximum size of the data of a message, the
+	// payload of a record without its operation, ID and attempts.
+	maxMessageSize = maxRecordSize - 1 - 2*binary.MaxVarintLen64
+)
+
+// errCorruptRecord is returned when a record of a segment is torn or
+// does not match its checksum.
+var errCorruptRecord = errors.New("corrupt record")
+
+// recordOp is the operation of a record.
+type recordOp byte
+
+const (
+	// opEnqueue adds a message, with its attempts and data.
+	opEnqueue recordOp = iota + 1
+	// opDeliver records a delivery attempt of a message.
+	opDeliver
+	// opAck removes a message.
+	opAck
+	// opDead moves a message to the dead letters.
+	opDead
+)
+
+// record is an entry of the write-ahead log.
+type record struct {
+	op       recordOp
+	id       uint64
+	attempts int
+	data     []byte
+}
+
+// encode the record as a header, with the length and checksum of the
+// payload, followed by the payload.
+func (r record) encode() []byte {
+	payload := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(r.data))
+	payload = append(payload, byte(r.op))
+	payload = binary.AppendUvarint(payload, r.id)
+	if r.op == opEnqueue {
+		payload = binary.AppendUvarint(payload, uint64(r.attempts))
+		payload = append(payload, r.data...)
+	}
+
+	b := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(payload))
+	return append(b, payload...)
+}
+
+// readRecord reads a record. It returns io.EOF at the end of the
+// segment, and errCorruptRecord for a torn or corrupt record.
+func readRecord(r io.Reader) (record, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return record{}, 0, io.EOF
+		}
+		return record{}, 0, errCorruptRecord
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size == 0 || size > maxRecordSize {
+		return record{}, 0, errCorruptRecord
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record{}, 0, errCorruptRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return record{}, 0, errCorruptRecord
+	}
+
+	rec := record{op: recordOp(payload[0])}
+	rest := payload[1:]
+	id, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return record{}, 0, errCorruptRecord
+	}
+	rec.id, rest = id, rest[n:]
+	if rec.op == opEnqueue {
+		attempts, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return record{}, 0, errCorruptRecord
+		}
+		rec.attempts, rec.data = int(attempts), rest[n:]
+	}
+	return rec, int64(recordHeaderSize + size), nil
+}
+
+// segment is an append-only file of records.
+type segment struct {
+	seq  uint64
+	file segmentFile
+	size int64
+	err  error
+}
+
+// segmentFile is the file of a segment.
+type segmentFile interface {
+	io.WriteCloser
+	Name() string
+	Sync() error
+	Truncate(size int64) error
+}
+
+// segmentName returns the file name of the segment with the sequence
+// number.
+func segmentName(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", seq, segmentSuffix))
+}
+
+// listSegments returns the sequence numbers of the segments in the
+// directory in order. Segments left behind by an interrupted
+// compaction are removed.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, segmentTempSuffix) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seq, ok := strings.CutSuffix(name, segmentSuffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, n)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// replaySegment reads the records of the segment and calls fn for
+// every record. If truncate is true, a torn or corrupt record at the
+// end of the segment, from a crash while writing, is truncated.
+// Otherwise it is an error.
+func replaySegment(name string, truncate bool, fn func(record)) (int64, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			if !truncate {
+				return 0, fmt.Errorf("%s at offset %d: %w", name, offset, err)
+			}
+			if err := f.Truncate(offset); err != nil {
+				return 0, err
+			}
+			return offset, f.Sync()
+		}
+		fn(rec)
+		offset += n
+	}
+}
+
+// openSegment opens the segment with the sequence number for appending.
+func openSegment(dir string, seq uint64) (*segment, error) {
+	f, err := os.OpenFile(segmentName(dir, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &segment{seq: seq, file: f, size: info.Size()}, nil
+}
+
+// append the records to the segment. If the write fails, the segment
+// is truncated to its previous size, so that a torn record does not
+// hide the records appended after it on replay. If it cannot be
+// truncated, further appends are refused.
+func (s *segment) append(records ...record) error {
+	if s.err != nil {
+		return s.err
+	}
+	var b []byte
+	for _, rec := range records {
+		b = append(b, rec.encode()...)
+	}
+	n, err := s.file.Write(b)
+	if err == nil {
+		s.size += int64(n)
+		return nil
+	}
+	if n > 0 {
+		if terr := s.file.Truncate(s.size); terr != nil {
+			s.err = fmt.Errorf("segment %s has a torn record: %w", s.file.Name(), terr)
+			return errors.Join(err, s.err)
+		}
+	}
+	return err
+}
+
+// writeSegment writes the records to a new segment with the sequence
+// number. The segment is written to a temporary file that is synced
+// and renamed, so that it is complete if it exists.
+func writeSegment(dir string, seq uint64, records []record) error {
+	name := segmentName(dir, seq)
+	tmp := name + segmentTempSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, rec := range records {
+		if _, err := w.Write(rec.encode()); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory so that created, renamed and removed
+// files are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
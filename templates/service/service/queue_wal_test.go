@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecord(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input record
+	}{
+		{
+			name:  "enqueue",
+			input: record{op: opEnqueue, id: 1, attempts: 2, data: []byte("data")},
+		},
+		{
+			name:  "enqueue without data",
+			input: record{op: opEnqueue, id: 300, data: []byte{}},
+		},
+		{
+			name:  "ack",
+			input: record{op: opAck, id: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := test.input.encode()
+			got, n, err := readRecord(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("readRecord() = unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(test.input, got, cmp.AllowUnexported(record{})); diff != "" {
+				t.Errorf("readRecord() = unexpected result (-want +got):\n%s\n", diff)
+			}
+			if n != int64(len(b)) {
+				t.Errorf("readRecord() = %d bytes; want %d", n, len(b))
+			}
+		})
+	}
+}
+
+func TestReadRecord(t *testing.T) {
+	valid := record{op: opAck, id: 1}.encode()
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	var tests = []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{
+			name: "end of segment",
+			want: io.EOF,
+		},
+		{
+			name:  "torn header",
+			input: valid[:4],
+			want:  errCorruptRecord,
+		},
+		{
+			name:  "torn payload",
+			input: valid[:len(valid)-1],
+			want:  errCorruptRecord,
+		},
+		{
+			name:  "checksum mismatch",
+			input: corrupt,
+			want:  errCorruptRecord,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, gotErr := readRecord(bytes.NewReader(test.input))
+			if !errors.Is(gotErr, test.want) {
+				t.Errorf("readRecord() = %v; want %v", gotErr, test.want)
+			}
+		})
+	}
+}
+
+func TestSegment_Append_Error(t *testing.T) {
+	var tests = []struct {
+		name        string
+		truncateErr error
+		want        []record
+		wantErr     bool
+	}{
+		{
+			name: "torn record is truncated",
+			want: []record{
+				{op: opEnqueue, id: 1, data: []byte("a")},
+				{op: opEnqueue, id: 3, data: []byte("c")},
+			},
+		},
+		{
+			name:        "appends are refused if not truncated",
+			truncateErr: errors.New("truncate error"),
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			seg, err := openSegment(dir, 1)
+			if err != nil {
+				t.Fatalf("openSegment() = unexpected error: %v", err)
+			}
+			file := &failingFile{File: seg.file.(*os.File), truncateErr: test.truncateErr}
+			seg.file = file
+			defer seg.file.Close()
+
+			if err := seg.append(record{op: opEnqueue, id: 1, data: []byte("a")}); err != nil {
+				t.Fatalf("append() = unexpected error: %v", err)
+			}
+			file.fail = true
+			if err := seg.append(record{op: opEnqueue, id: 2, data: []byte("b")}); err == nil {
+				t.Fatalf("append() = expected error")
+			}
+			file.fail = false
+			err = seg.append(record{op: opEnqueue, id: 3, data: []byte("c")})
+			if test.wantErr != (err != nil) {
+				t.Fatalf("append() = unexpected error: %v", err)
+			}
+			if test.wantErr {
+				return
+			}
+
+			var got []record
+			size, err := replaySegment(file.Name(), false, func(rec record) {
+				got = append(got, rec)
+			})
+			if err != nil {
+				t.Fatalf("replaySegment() = unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(record{})); diff != "" {
+				t.Errorf("replaySegment() = unexpected result (-want +got):\n%s\n", diff)
+			}
+			if size != seg.size {
+				t.Errorf("replaySegment() = %d bytes; want %d", size, seg.size)
+			}
+		})
+	}
+}
+
+// failingFile is a segment file that writes half of the data and
+// returns an error when it fails.
+type failingFile struct {
+	*os.File
+	fail        bool
+	truncateErr error
+}
+
+func (f *failingFile) Write(b []byte) (int, error) {
+	if !f.fail {
+		return f.File.Write(b)
+	}
+	n, _ := f.File.Write(b[:len(b)/2])
+	return n, errors.New("write error")
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.truncateErr != nil {
+		return f.truncateErr
+	}
+	return f.File.Truncate(size)
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultJobStopTimeout is the default timeout for running jobs to
+// return when the scheduler is stopped.
+const defaultJobStopTimeout = 15 * time.Second
+
+var (
+	// ErrJobExists is returned when a job with the same name is already
+	// scheduled.
+	ErrJobExists = errors.New("job already scheduled")
+	// ErrJobPanic is returned when a job panics.
+	ErrJobPanic = errors.New("job panicked")
+)
+
+// Job is a function run on a schedule by the service. It should
+// return when the context is done.
+type Job func(ctx context.Context) error
+
+// OverlapPolicy decides what happens when a job is due while the
+// previous run has not finished.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run. This is the default.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs the job when the previous run has finished. At
+	// most one run is queued, and runs that are due while one is queued
+	// are skipped.
+	OverlapQueue
+	// OverlapAllow runs the job concurrently with the previous run.
+	OverlapAllow
+)
+
+// JobOptions holds the configuration for a job.
+type JobOptions struct {
+	// Location is the time zone the schedule is evaluated in. Defaults
+	// to the local time zone.
+	Location *time.Location
+	// Jitter is the maximum random delay added to every run.
+	Jitter time.Duration
+	// Timeout is the timeout of every run. No timeout if not set.
+	Timeout time.Duration
+	// Overlap is the overlap policy of the job.
+	Overlap OverlapPolicy
+}
+
+// JobStats holds the run history of a job.
+type JobStats struct {
+	Name         string
+	Runs         int
+	Failures     int
+	Skipped      int
+	Running      int
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	NextRun      time.Time
+}
+
+// job is a scheduled Job.
+type job struct {
+	run      Job
+	name     string
+	schedule schedule
+	jitter   time.Duration
+	timeout  time.Duration
+	overlap  OverlapPolicy
+	sem      chan struct{}
+	pending  chan struct{}
+	mu       sync.Mutex
+	stats    JobStats
+}
+
+// scheduler runs jobs on their schedules.
+type scheduler struct {
+	mu      sync.Mutex
+	jobs    []*job
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	now     func() time.Time
+}
+
+// newScheduler returns a new scheduler.
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		ctx:    ctx,
+		cancel: cancel,
+		now:    time.Now,
+	}
+}
+
+// Schedule a job with the service under the given name. The schedule
+// is a cron expression with 5 or 6 fields, a predefined schedule such
+// as @hourly or @daily, or an interval such as @every 10m. The jobs
+// are scheduled after the components are started, and running jobs
+// are cancelled when the service is stopped.
+func (s service) Schedule(name, spec string, j Job, options ...JobOptions) error {
+	return s.scheduler.add(name, spec, j, options...)
+}
+
+// Jobs returns the run history of the scheduled jobs, sorted by name.
+func (s service) Jobs() []JobStats {
+	return s.scheduler.stats()
+}
+
+// add a job.
+func (s *scheduler) add(name, spec string, j Job, options ...JobOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, added := range s.jobs {
+		if added.name == name {
+			return fmt.Errorf("%w: %s", ErrJobExists, name)
+		}
+	}
+
+	var opts JobOptions
+	for _, option := range options {
+		opts = option
+	}
+	sched, err := parseSchedule(spec, opts.Location)
+	if err != nil {
+		return err
+	}
+
+	s.jobs = append(s.jobs, &job{
+		run:      j,
+		name:     name,
+		schedule: sched,
+		jitter:   opts.Jitter,
+		timeout:  opts.Timeout,
+		overlap:  opts.Overlap,
+		sem:      make(chan struct{}, 1),
+		pending:  make(chan struct{}, 1),
+		stats:    JobStats{Name: name},
+	})
+	return nil
+}
+
+// start scheduling the jobs. The jobs are not scheduled if the
+// scheduler has been stopped.
+func (s *scheduler) start(log logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.schedule(j, log)
+		}()
+	}
+}
+
+// stop scheduling the jobs, cancel the running jobs and wait for them
+// to return within the stop timeout.
+func (s *scheduler) stop(log logger) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(defaultJobStopTimeout):
+		err := errors.New("timeout waiting for jobs to stop")
+		log.Error("Failed to stop jobs.", "error", err)
+		return err
+	}
+}
+
+// stats returns the run history of the jobs, sorted by name.
+func (s *scheduler) stats() []JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]JobStats, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		stats = append(stats, j.stats)
+		j.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, k int) bool {
+		return stats[i].Name < stats[k].Name
+	})
+	return stats
+}
+
+// schedule waits for the next time of the job and runs it, until the
+// scheduler is stopped.
+func (s *scheduler) schedule(j *job, log logger) {
+	for {
+		now := s.now()
+		next := j.schedule.next(now)
+		if next.IsZero() {
+			log.Error("Job has no next run.", "job", j.name)
+			return
+		}
+		if j.jitter > 0 {
+			next = next.Add(rand.N(j.jitter))
+		}
+		j.update(func(stats *JobStats) {
+			stats.NextRun = next
+		})
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.trigger(j, log)
+	}
+}
+
+// trigger a run of the job according to its overlap policy.
+func (s *scheduler) trigger(j *job, log logger) {
+	switch j.overlap {
+	case OverlapSkip:
+		select {
+		case j.sem <- struct{}{}:
+		default:
+			j.update(func(stats *JobStats) {
+				stats.Skipped++
+			})
+			log.Info("Job skipped.", "job", j.name, "reason", "previous run not finished")
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-j.sem }()
+			s.execute(j, log)
+		}()
+	case OverlapQueue:
+		select {
+		case j.pending <- struct{}{}:
+		default:
+			j.update(func(stats *JobStats) {
+				stats.Skipped++
+			})
+			log.Info("Job skipped.", "job", j.name, "reason", "run already queued")
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			select {
+			case j.sem <- struct{}{}:
+				<-j.pending
+			case <-s.ctx.Done():
+				<-j.pending
+				return
+			}
+			defer func() { <-j.sem }()
+			s.execute(j, log)
+		}()
+	case OverlapAllow:
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.execute(j, log)
+		}()
+	}
+}
+
+// execute runs the job within its timeout and records the run.
+func (s *scheduler) execute(j *job, log logger) {
+	ctx, cancel := s.ctx, context.CancelFunc(func() {})
+	if j.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+	}
+	defer cancel()
+
+	start := s.now()
+	j.update(func(stats *JobStats) {
+		stats.Running++
+		stats.LastRun = start
+	})
+	log.Info("Job started.", "job", j.name)
+
+	err := j.call(ctx, log)
+	duration := s.now().Sub(start)
+
+	// A run cancelled by the scheduler stopping is not a failure.
+	cancelled := err != nil && s.ctx.Err() != nil
+	j.update(func(stats *JobStats) {
+		stats.Running--
+		stats.Runs++
+		stats.LastDuration = duration
+		stats.LastError = ""
+		if err != nil {
+			stats.LastError = err.Error()
+		}
+		if err != nil && !cancelled {
+			stats.Failures++
+		}
+	})
+	if cancelled {
+		log.Info("Job cancelled.", "job", j.name, "duration", duration)
+		return
+	}
+	if err != nil {
+		log.Error("Job failed.", "job", j.name, "duration", duration, "error", err)
+		return
+	}
+	log.Info("Job finished.", "job", j.name, "duration", duration)
+}
+
+// call the job and recover from a panic, which is returned as an error.
+func (j *job) call(ctx context.Context, log logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Job panicked.", "job", j.name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = fmt.Errorf("%w: %v", ErrJobPanic, r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+// update the stats of the job.
+func (j *job) update(fn func(stats *JobStats)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.stats)
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScheduler(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input struct {
+			job     func(ctx context.Context, run int32) error
+			options JobOptions
+		}
+		want struct {
+			failures bool
+			skipped  bool
+			maxRuns  int32
+		}
+	}{
+		{
+			name: "run on interval",
+			input: struct {
+				job     func(ctx context.Context, run int32) error
+				options JobOptions
+			}{
+				job: func(ctx context.Context, run int32) error {
+					return nil
+				},
+			},
+			want: struct {
+				failures bool
+				skipped  bool
+				maxRuns  int32
+			}{
+				maxRuns: 1,
+			},
+		},
+		{
+			name: "failures and panics",
+			input: struct {
+				job     func(ctx context.Context, run int32) error
+				options JobOptions
+			}{
+				job: func(ctx context.Context, run int32) error {
+					if run%2 == 0 {
+						panic("job panic")
+					}
+					return errors.New("job error")
+				},
+			},
+			want: struct {
+				failures bool
+				skipped  bool
+				maxRuns  int32
+			}{
+				failures: true,
+				maxRuns:  1,
+			},
+		},
+		{
+			name: "skip overlapping runs",
+			input: struct {
+				job     func(ctx context.Context, run int32) error
+				options JobOptions
+			}{
+				job: func(ctx context.Context, run int32) error {
+					time.Sleep(25 * time.Millisecond)
+					return nil
+				},
+			},
+			want: struct {
+				failures bool
+				skipped  bool
+				maxRuns  int32
+			}{
+				skipped: true,
+				maxRuns: 1,
+			},
+		},
+		{
+			name: "queue overlapping runs",
+			input: struct {
+				job     func(ctx context.Context, run int32) error
+				options JobOptions
+			}{
+				job: func(ctx context.Context, run int32) error {
+					time.Sleep(25 * time.Millisecond)
+					return nil
+				},
+				options: JobOptions{Overlap: OverlapQueue},
+			},
+			want: struct {
+				failures bool
+				skipped  bool
+				maxRuns  int32
+			}{
+				skipped: true,
+				maxRuns: 1,
+			},
+		},
+		{
+			name: "allow overlapping runs",
+			input: struct {
+				job     func(ctx context.Context, run int32) error
+				options JobOptions
+			}{
+				job: func(ctx context.Context, run int32) error {
+					time.Sleep(25 * time.Millisecond)
+					return nil
+				},
+				options: JobOptions{Overlap: OverlapAllow},
+			},
+			want: struct {
+				failures bool
+				skipped  bool
+				maxRuns  int32
+			}{
+				maxRuns: 2,
+			},
+		},
+		{
+			name: "timeout",
+			input: struct {
+				job     func(ctx context.Context, run int32) error
+				options JobOptions
+			}{
+				job: func(ctx context.Context, run int32) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+				// Runs are allowed to overlap, so that a run that is
+				// delayed past the next one is not skipped.
+				options: JobOptions{Timeout: 5 * time.Millisecond, Jitter: time.Millisecond, Overlap: OverlapAllow},
+			},
+			want: struct {
+				failures bool
+				skipped  bool
+				maxRuns  int32
+			}{
+				failures: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := []string{}
+			log := &mockLogger{logs: &logs}
+			s := newScheduler()
+
+			var runs, running, maxRunning atomic.Int32
+			if err := s.add("job", "@every 10ms", func(ctx context.Context) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				if n > maxRunning.Load() {
+					maxRunning.Store(n)
+				}
+				return test.input.job(ctx, runs.Add(1))
+			}, test.input.options); err != nil {
+				t.Fatalf("add() = unexpected error: %v", err)
+			}
+			s.start(log)
+			time.Sleep(100 * time.Millisecond)
+			if err := s.stop(log); err != nil {
+				t.Fatalf("stop() = unexpected error: %v", err)
+			}
+
+			stats := s.stats()[0]
+			if stats.Runs == 0 || stats.Runs != int(runs.Load()) {
+				t.Errorf("stats() = %d runs; want %d", stats.Runs, runs.Load())
+			}
+			if test.want.failures != (stats.Failures > 0) {
+				t.Errorf("stats() = %d failures of %d runs", stats.Failures, stats.Runs)
+			}
+			if test.want.skipped != (stats.Skipped > 0) {
+				t.Errorf("stats() = %d skipped", stats.Skipped)
+			}
+			if test.want.maxRuns == 1 && maxRunning.Load() != 1 {
+				t.Errorf("job = %d concurrent runs; want 1", maxRunning.Load())
+			}
+			if test.want.maxRuns > 1 && maxRunning.Load() < test.want.maxRuns {
+				t.Errorf("job = %d concurrent runs; want at least %d", maxRunning.Load(), test.want.maxRuns)
+			}
+		})
+	}
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	logs := []string{}
+	log := &mockLogger{logs: &logs}
+	s := newScheduler()
+
+	cancelled := make(chan struct{})
+	s.add("job", "@every 10ms", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	s.start(log)
+	time.Sleep(15 * time.Millisecond)
+
+	if err := s.stop(log); err != nil {
+		t.Fatalf("stop() = unexpected error: %v", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Errorf("stop() = job not cancelled")
+	}
+
+	want := []string{
+		"Job started.", "job", "job",
+		"Job cancelled.", "job", "job", "duration",
+	}
+	if diff := cmp.Diff(want, logs); diff != "" {
+		t.Errorf("stop() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestService_Schedule(t *testing.T) {
+	s := New()
+	job := func(ctx context.Context) error { return nil }
+
+	if err := s.Schedule("backup", "0 3 * * *", job); err != nil {
+		t.Fatalf("Schedule() = unexpected error: %v", err)
+	}
+	if err := s.Schedule("backup", "0 3 * * *", job); !errors.Is(err, ErrJobExists) {
+		t.Errorf("Schedule() = %v; want %v", err, ErrJobExists)
+	}
+	if err := s.Schedule("cleanup", "0 3 * *", job); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("Schedule() = %v; want %v", err, ErrInvalidSchedule)
+	}
+
+	if diff := cmp.Diff([]JobStats{{Name: "backup"}}, s.Jobs()); diff != "" {
+		t.Errorf("Jobs() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
@@ -1,21 +1,51 @@
 package service
 
 import (
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+
+	"github.com/RedeployAB/go-template/templates/service/version"
 )
 
 // service ...
 type service struct {
-	log    logger
-	stopCh chan os.Signal
-	errCh  chan error
+	log          logger
+	level        *slog.LevelVar
+	statusSocket string
+	components   *components
+	supervisor   *supervisor
+	scheduler    *scheduler
+	notifier     *notifier
+	pidFile      *pidFile
+	lifecycle    *lifecycle
+	stopCh       chan os.Signal
+	errCh        chan error
+}
+
+// lifecycle is the state of the service that is shared between the
+// start and the shutdown, so that systemd is never notified that the
+// service is ready after it has been notified that it is stopping.
+type lifecycle struct {
+	mu       sync.Mutex
+	stopping bool
 }
 
 // Options holds the configuration for the service.
 type Options struct {
-	Logger logger
+	Logger       logger
+	LogLevel     *slog.LevelVar
+	StatusSocket string
+	PIDFile      string
+}
+
+// Settings holds the settings of the service that can be updated
+// while it is running.
+type Settings struct {
+	LogLevel slog.Level
 }
 
 // Option is a function that configures the service.
@@ -24,8 +54,13 @@ type Option func(*service)
 // New returns a new service.
 func New(options ...Option) *service {
 	s := &service{
-		stopCh: make(chan os.Signal),
-		errCh:  make(chan error),
+		components: newComponents(),
+		supervisor: newSupervisor(),
+		scheduler:  newScheduler(),
+		notifier:   newNotifier(),
+		lifecycle:  &lifecycle{},
+		stopCh:     make(chan os.Signal),
+		errCh:      make(chan error),
 	}
 	for _, option := range options {
 		option(s)
@@ -38,23 +73,63 @@ func New(options ...Option) *service {
 	return s
 }
 
-// Start the service.
+// Start the service, its registered components and then its
+// supervised workers and scheduled jobs. When they are started,
+// systemd is notified that the service is ready, unless the service
+// has begun to stop while its components were starting. If a component
+// fails to start or reports a failure, or a worker fails and is not
+// restarted, the service is stopped and the error is returned. If the service is configured with
+// a PID file, it is locked before anything else is started, and
+// ErrLocked is returned if another instance holds the lock. The logger
+// is closed when the service stops, if it can be closed.
 func (s service) Start() error {
+	defer closeLogger(s.log)
+	stale, err := s.pidFile.lock()
+	if err != nil {
+		return err
+	}
+	defer s.unlockPIDFile()
+	if stale > 0 {
+		s.log.Info("Removed stale PID file.", "pid", stale)
+	}
+
+	if len(s.statusSocket) > 0 {
+		l, err := net.Listen("unix", s.statusSocket)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go s.serveStatus(l)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.notifier.watchdog(done, func() bool { return s.status() == statusOK }, s.log)
+
 	go func() {
-		// Add service startup code here.
-		// Send errors to s.errCh.
+		if err := s.components.start(s.log); err != nil {
+			s.errCh <- err
+			return
+		}
+		s.ready()
 	}()
 
 	go func() {
 		s.stop()
 	}()
 
-	s.log.Info("Service started.")
+	s.log.Info("Service started.", "version", version.Get().Version)
 	for {
 		select {
 		case err := <-s.errCh:
 			close(s.errCh)
 			return err
+		case err := <-s.supervisor.err():
+			s.shutdown()
+			return err
+		case err := <-s.components.err():
+			s.shutdown()
+			return err
 		case sig := <-s.stopCh:
 			s.log.Info("Service stopped.", "reason", sig.String())
 			close(s.stopCh)
@@ -63,15 +138,57 @@ func (s service) Start() error {
 	}
 }
 
+// Update the settings of the running service. The log level is only
+// updated if the service is configured with a LogLevel.
+func (s service) Update(settings Settings) {
+	if s.level != nil {
+		s.level.Set(settings.LogLevel)
+	}
+}
+
+// ready starts the supervised workers and scheduled jobs and notifies
+// systemd that the service is ready, unless the shutdown has begun.
+func (s service) ready() {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+	if s.lifecycle.stopping {
+		return
+	}
+	s.supervisor.start(s.log)
+	s.scheduler.start(s.log)
+	s.notify(sdReady)
+}
+
 // stop the service.
 func (s service) stop() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-stop
+	s.shutdown()
+	s.stopCh <- sig
+}
 
-	// Add service shutdown logic here.
+// shutdown notifies systemd, cancels the scheduled jobs, stops the
+// supervised workers and then the components, and releases the PID
+// file. Errors are logged by the scheduler, the supervisor and for
+// each component.
+func (s service) shutdown() {
+	s.lifecycle.mu.Lock()
+	s.lifecycle.stopping = true
+	s.notify(sdStopping)
+	s.lifecycle.mu.Unlock()
 
-	s.stopCh <- sig
+	_ = s.scheduler.stop(s.log)
+	_ = s.supervisor.stop(s.log)
+	_ = s.components.stop(s.log)
+	s.unlockPIDFile()
+}
+
+// unlockPIDFile removes and unlocks the PID file and logs errors.
+func (s service) unlockPIDFile() {
+	if err := s.pidFile.unlock(); err != nil {
+		s.log.Error("Failed to remove PID file.", "error", err)
+	}
 }
 
 // WithOptions configures the service with the given Options.
@@ -80,5 +197,14 @@ func WithOptions(options Options) Option {
 		if options.Logger != nil {
 			s.log = options.Logger
 		}
+		if options.LogLevel != nil {
+			s.level = options.LogLevel
+		}
+		if len(options.StatusSocket) > 0 {
+			s.statusSocket = options.StatusSocket
+		}
+		if len(options.PIDFile) > 0 {
+			s.pidFile = newPIDFile(options.PIDFile)
+		}
 	}
 }
@@ -1,12 +1,19 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/RedeployAB/go-template/templates/service/version"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
@@ -28,11 +35,15 @@ func TestNew(t *testing.T) {
 			name: "with options",
 			input: []Option{
 				WithOptions(Options{
-					Logger: NewLogger(),
+					Logger:       NewLogger(),
+					StatusSocket: "/run/service.sock",
+					PIDFile:      "/run/service.pid",
 				}),
 			},
 			want: &service{
-				log: NewLogger(),
+				log:          NewLogger(),
+				statusSocket: "/run/service.sock",
+				pidFile:      &pidFile{path: "/run/service.pid"},
 			},
 		},
 	}
@@ -44,7 +55,7 @@ func TestNew(t *testing.T) {
 				t.Errorf("New(%v) = nil; want %v", test.input, test.want)
 			}
 
-			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(service{}), cmpopts.IgnoreUnexported(slog.Logger{}), cmpopts.IgnoreFields(service{}, "stopCh", "errCh")); diff != "" {
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(service{}, pidFile{}), cmpopts.IgnoreUnexported(slog.Logger{}), cmpopts.IgnoreFields(pidFile{}, "mu"), cmpopts.IgnoreFields(service{}, "components", "supervisor", "scheduler", "lifecycle", "stopCh", "errCh")); diff != "" {
 				t.Errorf("New(%v) = unexpected result (-want +got):\n%s\n", test.input, diff)
 			}
 		})
@@ -58,8 +69,12 @@ func TestService_Start(t *testing.T) {
 			log: &mockLogger{
 				logs: &logs,
 			},
-			stopCh: make(chan os.Signal),
-			errCh:  make(chan error),
+			components: newComponents(),
+			supervisor: newSupervisor(),
+			scheduler:  newScheduler(),
+			lifecycle:  &lifecycle{},
+			stopCh:     make(chan os.Signal),
+			errCh:      make(chan error),
 		}
 		go func() {
 			time.Sleep(time.Millisecond * 100)
@@ -69,6 +84,8 @@ func TestService_Start(t *testing.T) {
 
 		want := []string{
 			"Service started.",
+			"version",
+			version.Get().Version,
 			"Service stopped.",
 			"reason",
 			"interrupt",
@@ -78,24 +95,188 @@ func TestService_Start(t *testing.T) {
 			t.Errorf("Start() = unexpected result (-want +got):\n%s\n", diff)
 		}
 	})
+
+	t.Run("notify systemd", func(t *testing.T) {
+		socket, messages := listenNotify(t)
+		srv := &service{
+			log:        &mockLogger{logs: &[]string{}},
+			components: newComponents(),
+			supervisor: newSupervisor(),
+			scheduler:  newScheduler(),
+			notifier:   &notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}},
+			lifecycle:  &lifecycle{},
+			stopCh:     make(chan os.Signal),
+			errCh:      make(chan error),
+		}
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+		}()
+		srv.Start()
+
+		got := []string{<-messages, <-messages}
+		if diff := cmp.Diff([]string{sdReady, sdStopping}, got); diff != "" {
+			t.Errorf("Start() = unexpected notifications (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("stopped while starting", func(t *testing.T) {
+		socket, messages := listenNotify(t)
+		srv := New(WithOptions(Options{
+			Logger: &mockLogger{logs: &[]string{}},
+		}))
+		srv.notifier = &notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+		srv.Register("database", &mockComponent{name: "database", calls: &[]string{}, startDelay: time.Second})
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+		}()
+		srv.Start()
+		time.Sleep(time.Millisecond * 100)
+
+		var got []string
+		for len(messages) > 0 {
+			got = append(got, <-messages)
+		}
+		if diff := cmp.Diff([]string{sdStopping}, got); diff != "" {
+			t.Errorf("Start() = unexpected notifications (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("worker fails", func(t *testing.T) {
+		logs := []string{}
+		srv := New(WithOptions(Options{
+			Logger: &mockLogger{
+				logs: &logs,
+			},
+			StatusSocket: filepath.Join(t.TempDir(), "service.sock"),
+		}))
+		srv.Supervise("worker", func(ctx context.Context) error {
+			return errors.New("worker error")
+		}, WorkerOptions{Restart: RestartNever})
+
+		err := srv.Start()
+		if diff := cmp.Diff("worker worker: worker error", err.Error()); diff != "" {
+			t.Errorf("Start() = unexpected error (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("component fails", func(t *testing.T) {
+		calls := []string{}
+		failing := &mockComponent{name: "database", calls: &calls, errCh: make(chan error, 1)}
+		srv := New(WithOptions(Options{
+			Logger: &mockLogger{logs: &[]string{}},
+		}))
+		srv.Register("database", failing)
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			failing.errCh <- errors.New("connection lost")
+		}()
+
+		err := srv.Start()
+		if diff := cmp.Diff("component database: connection lost", err.Error()); diff != "" {
+			t.Errorf("Start() = unexpected error (-want +got):\n%s\n", diff)
+		}
+		if diff := cmp.Diff([]string{"start database", "stop database"}, calls); diff != "" {
+			t.Errorf("Start() = unexpected calls (-want +got):\n%s\n", diff)
+		}
+	})
+
+	t.Run("two instances", func(t *testing.T) {
+		errCh := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			srv := New(WithOptions(Options{
+				Logger: &mockLogger{logs: &[]string{}},
+			}))
+			go func() {
+				errCh <- srv.Start()
+			}()
+		}
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+		}()
+
+		for i := 0; i < 2; i++ {
+			if err := <-errCh; err != nil {
+				t.Errorf("Start() = unexpected error: %v", err)
+			}
+		}
+	})
+
+	t.Run("another instance is running", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "service.pid")
+		other := newPIDFile(path)
+		if _, err := other.lock(); err != nil {
+			t.Fatalf("lock() = unexpected error: %v", err)
+		}
+		defer other.unlock()
+
+		srv := New(WithOptions(Options{
+			Logger:       &mockLogger{logs: &[]string{}},
+			StatusSocket: filepath.Join(t.TempDir(), "service.sock"),
+			PIDFile:      path,
+		}))
+
+		if err := srv.Start(); !errors.Is(err, ErrLocked) {
+			t.Errorf("Start() = %v; want %v", err, ErrLocked)
+		}
+	})
 }
 
 type mockLogger struct {
+	mu   sync.Mutex
 	logs *[]string
 }
 
 func (l *mockLogger) Info(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	messages := []string{msg}
 	for _, v := range args {
-		messages = append(messages, v.(string))
+		switch v := v.(type) {
+		case string:
+			messages = append(messages, v)
+		case int:
+			messages = append(messages, strconv.Itoa(v))
+		case uint64:
+			messages = append(messages, strconv.FormatUint(v, 10))
+		case error:
+			messages = append(messages, v.Error())
+		}
 	}
 	*l.logs = append(*l.logs, messages...)
 }
 
 func (l *mockLogger) Error(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	messages := []string{msg}
 	for _, v := range args {
-		messages = append(messages, v.(string))
+		switch v := v.(type) {
+		case string:
+			messages = append(messages, v)
+		case int:
+			messages = append(messages, strconv.Itoa(v))
+		case uint64:
+			messages = append(messages, strconv.FormatUint(v, 10))
+		case error:
+			messages = append(messages, v.Error())
+		}
 	}
 	*l.logs = append(*l.logs, messages...)
 }
+
+func TestService_Update(t *testing.T) {
+	level := &slog.LevelVar{}
+	s := New(WithOptions(Options{
+		Logger:   NewLogger(WithLevel(level)),
+		LogLevel: level,
+	}))
+
+	s.Update(Settings{LogLevel: slog.LevelDebug})
+
+	if diff := cmp.Diff(slog.LevelDebug, level.Level()); diff != "" {
+		t.Errorf("Update() = unexpected log level (-want +got):\n%s\n", diff)
+	}
+}
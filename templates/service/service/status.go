@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// errNoStatusSocket is returned by Healthcheck when no status socket is
+// configured.
+var errNoStatusSocket = errors.New("status socket is not configured")
+
+// statusOK is the status of a healthy service.
+const statusOK = "ok"
+
+// serveStatus responds with the status of the service to every
+// connection on the listener until it is closed.
+func (s service) serveStatus(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		io.WriteString(conn, s.status()+"\n")
+		conn.Close()
+	}
+}
+
+// status returns the status of the service. The service is not
+// healthy while a supervised worker is restarting or has failed.
+func (s service) status() string {
+	if s.supervisor != nil {
+		if name, state, ok := s.supervisor.status(); ok {
+			return "worker " + name + " " + string(state)
+		}
+	}
+	return statusOK
+}
+
+// Healthcheck connects to the status socket of a local service
+// configured with options, and returns an error if the service is
+// not healthy. It is used by the healthcheck command, since the
+// container image has neither a shell nor other tools.
+func Healthcheck(ctx context.Context, options Options) error {
+	if len(options.StatusSocket) == 0 {
+		return errNoStatusSocket
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", options.StatusSocket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil {
+		return err
+	}
+	if status := strings.TrimSpace(string(b)); status != statusOK {
+		return fmt.Errorf("unhealthy: %s", status)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthcheck(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   func(l net.Listener)
+		wantErr bool
+	}{
+		{
+			name: "healthy",
+			input: func(l net.Listener) {
+				service{}.serveStatus(l)
+			},
+		},
+		{
+			name: "unhealthy",
+			input: func(l net.Listener) {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				io.WriteString(conn, "stopping\n")
+				conn.Close()
+			},
+			wantErr: true,
+		},
+		{
+			name:    "not running",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address := filepath.Join(t.TempDir(), "service.sock")
+			if test.input != nil {
+				l, err := net.Listen("unix", address)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer l.Close()
+				go test.input(l)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotErr := Healthcheck(ctx, Options{StatusSocket: address})
+			if test.wantErr && gotErr == nil {
+				t.Errorf("Healthcheck() = nil; want error")
+			}
+			if !test.wantErr && gotErr != nil {
+				t.Errorf("Healthcheck() = unexpected error: %v", gotErr)
+			}
+		})
+	}
+	t.Run("not configured", func(t *testing.T) {
+		if err := Healthcheck(context.Background(), Options{}); !errors.Is(err, errNoStatusSocket) {
+			t.Errorf("Healthcheck() = %v; want %v", err, errNoStatusSocket)
+		}
+	})
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultWorkerMaxRestarts is the default maximum number of restarts
+	// of a worker within the restart window.
+	defaultWorkerMaxRestarts = 5
+	// defaultWorkerRestartWindow is the default window in which the
+	// restarts of a worker are counted.
+	defaultWorkerRestartWindow = time.Minute
+	// defaultWorkerMinBackoff is the default backoff before the first
+	// restart of a worker.
+	defaultWorkerMinBackoff = 500 * time.Millisecond
+	// defaultWorkerMaxBackoff is the default maximum backoff between
+	// restarts of a worker.
+	defaultWorkerMaxBackoff = 30 * time.Second
+	// defaultWorkerStopTimeout is the default timeout for stopping the
+	// workers.
+	defaultWorkerStopTimeout = 15 * time.Second
+)
+
+var (
+	// ErrWorkerExists is returned when a worker with the same name is
+	// already supervised.
+	ErrWorkerExists = errors.New("worker already supervised")
+	// ErrWorkerPanic is returned when a worker panics.
+	ErrWorkerPanic = errors.New("worker panicked")
+	// ErrWorkerRestarts is returned when a worker exceeds the maximum
+	// number of restarts within the restart window.
+	ErrWorkerRestarts = errors.New("worker exceeded maximum restarts")
+)
+
+// Worker is a long running function supervised by the service. It
+// should run until the context is done. A returned error or a panic
+// is a failure.
+type Worker func(ctx context.Context) error
+
+// RestartPolicy decides when a worker is restarted.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts the worker when it fails. This is
+	// the default.
+	RestartOnFailure RestartPolicy = iota
+	// RestartAlways restarts the worker whenever it returns.
+	RestartAlways
+	// RestartNever never restarts the worker.
+	RestartNever
+)
+
+// WorkerOptions holds the configuration for a worker.
+type WorkerOptions struct {
+	// Restart is the restart policy of the worker.
+	Restart RestartPolicy
+	// MaxRestarts is the maximum number of restarts within the
+	// RestartWindow. When it is exceeded the worker is not restarted
+	// and the service is stopped.
+	MaxRestarts int
+	// RestartWindow is the window in which restarts are counted.
+	RestartWindow time.Duration
+	// MinBackoff is the backoff before the first restart. It is
+	// doubled for every restart within the restart window.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff between restarts.
+	MaxBackoff time.Duration
+}
+
+// workerState is the state of a supervised worker.
+type workerState string
+
+const (
+	workerStarting   workerState = "starting"
+	workerRunning    workerState = "running"
+	workerRestarting workerState = "restarting"
+	workerStopped    workerState = "stopped"
+	workerFailed     workerState = "failed"
+)
+
+// worker is a supervised Worker.
+type worker struct {
+	run           Worker
+	name          string
+	restart       RestartPolicy
+	maxRestarts   int
+	restartWindow time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	mu            sync.RWMutex
+	state         workerState
+	restarts      []time.Time
+}
+
+// supervisor runs workers and restarts them one for one according to
+// their restart policies.
+type supervisor struct {
+	mu      sync.Mutex
+	workers []*worker
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	errCh   chan error
+	now     func() time.Time
+}
+
+// newSupervisor returns a new supervisor.
+func newSupervisor() *supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &supervisor{
+		ctx:    ctx,
+		cancel: cancel,
+		errCh:  make(chan error, 1),
+		now:    time.Now,
+	}
+}
+
+// Supervise a worker with the service under the given name. The
+// workers are started after the components, and stopped before them.
+// A worker that fails and is not restarted stops the service.
+func (s service) Supervise(name string, w Worker, options ...WorkerOptions) error {
+	return s.supervisor.add(name, w, options...)
+}
+
+// add a worker.
+func (s *supervisor) add(name string, w Worker, options ...WorkerOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, added := range s.workers {
+		if added.name == name {
+			return fmt.Errorf("%w: %s", ErrWorkerExists, name)
+		}
+	}
+
+	wrk := &worker{
+		run:           w,
+		name:          name,
+		maxRestarts:   defaultWorkerMaxRestarts,
+		restartWindow: defaultWorkerRestartWindow,
+		minBackoff:    defaultWorkerMinBackoff,
+		maxBackoff:    defaultWorkerMaxBackoff,
+		state:         workerStarting,
+	}
+	for _, option := range options {
+		wrk.restart = option.Restart
+		if option.MaxRestarts > 0 {
+			wrk.maxRestarts = option.MaxRestarts
+		}
+		if option.RestartWindow > 0 {
+			wrk.restartWindow = option.RestartWindow
+		}
+		if option.MinBackoff > 0 {
+			wrk.minBackoff = option.MinBackoff
+		}
+		if option.MaxBackoff > 0 {
+			wrk.maxBackoff = option.MaxBackoff
+		}
+	}
+	s.workers = append(s.workers, wrk)
+	return nil
+}
+
+// start the workers. The workers are not started if the supervisor
+// has been stopped.
+func (s *supervisor) start(log logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+
+	for _, w := range s.workers {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.supervise(w, log)
+		}()
+	}
+}
+
+// stop the workers and wait for them to return within the stop
+// timeout.
+func (s *supervisor) stop(log logger) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(defaultWorkerStopTimeout):
+		err := errors.New("timeout waiting for workers to stop")
+		log.Error("Failed to stop workers.", "error", err)
+		return err
+	}
+}
+
+// err returns a channel that receives the error of the first worker
+// that fails and is not restarted.
+func (s *supervisor) err() <-chan error {
+	return s.errCh
+}
+
+// supervise runs the worker and restarts it according to its restart
+// policy until the supervisor is stopped.
+func (s *supervisor) supervise(w *worker, log logger) {
+	for {
+		w.setState(workerRunning)
+		log.Info("Worker started.", "worker", w.name)
+		err := w.call(s.ctx, log)
+
+		if s.ctx.Err() != nil {
+			w.setState(workerStopped)
+			log.Info("Worker stopped.", "worker", w.name)
+			return
+		}
+		if err == nil && w.restart != RestartAlways {
+			w.setState(workerStopped)
+			log.Info("Worker stopped.", "worker", w.name)
+			return
+		}
+		if err != nil {
+			log.Error("Worker failed.", "worker", w.name, "error", err)
+			if w.restart == RestartNever {
+				s.fail(w, fmt.Errorf("worker %s: %w", w.name, err))
+				return
+			}
+		}
+
+		restarts := w.restarted(s.now())
+		if restarts > w.maxRestarts {
+			s.fail(w, fmt.Errorf("%w: %s restarted %d times within %s", ErrWorkerRestarts, w.name, w.maxRestarts, w.restartWindow))
+			return
+		}
+
+		w.setState(workerRestarting)
+		backoff := w.backoff(restarts)
+		log.Info("Worker restarting.", "worker", w.name, "backoff", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			w.setState(workerStopped)
+			log.Info("Worker stopped.", "worker", w.name)
+			return
+		}
+	}
+}
+
+// fail marks the worker as failed and reports the error. Only the
+// first error is reported.
+func (s *supervisor) fail(w *worker, err error) {
+	w.setState(workerFailed)
+	select {
+	case s.errCh <- err:
+	default:
+	}
+}
+
+// status returns the name and state of the first worker that is not
+// running or stopped, and false if there is none.
+func (s *supervisor) status() (string, workerState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.workers {
+		if state := w.getState(); state == workerRestarting || state == workerFailed {
+			return w.name, state, true
+		}
+	}
+	return "", "", false
+}
+
+// call the worker and recover from a panic, which is returned as an
+// error.
+func (w *worker) call(ctx context.Context, log logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Worker panicked.", "worker", w.name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = fmt.Errorf("%w: %v", ErrWorkerPanic, r)
+		}
+	}()
+	return w.run(ctx)
+}
+
+// restarted records a restart at the given time and returns the number
+// of restarts within the restart window.
+func (w *worker) restarted(now time.Time) int {
+	restarts := w.restarts[:0]
+	for _, t := range w.restarts {
+		if now.Sub(t) < w.restartWindow {
+			restarts = append(restarts, t)
+		}
+	}
+	w.restarts = append(restarts, now)
+	return len(w.restarts)
+}
+
+// backoff returns the backoff before the given restart. The backoff
+// is doubled for every restart up to the maximum backoff, and half of
+// it is random to spread out restarts.
+func (w *worker) backoff(restarts int) time.Duration {
+	d := w.minBackoff
+	for i := 1; i < restarts && d < w.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.maxBackoff {
+		d = w.maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// setState sets the state of the worker.
+func (w *worker) setState(state workerState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+}
+
+// getState returns the state of the worker.
+func (w *worker) getState() workerState {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.state
+}
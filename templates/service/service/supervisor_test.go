@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSupervisor(t *testing.T) {
+	errWorker := errors.New("worker error")
+
+	var tests = []struct {
+		name  string
+		input struct {
+			worker  func(calls int32) error
+			options WorkerOptions
+		}
+		want struct {
+			calls int32
+			err   error
+		}
+	}{
+		{
+			name: "restart on failure",
+			input: struct {
+				worker  func(calls int32) error
+				options WorkerOptions
+			}{
+				worker: func(calls int32) error {
+					if calls < 3 {
+						return errWorker
+					}
+					return nil
+				},
+			},
+			want: struct {
+				calls int32
+				err   error
+			}{
+				calls: 3,
+			},
+		},
+		{
+			name: "restart on panic",
+			input: struct {
+				worker  func(calls int32) error
+				options WorkerOptions
+			}{
+				worker: func(calls int32) error {
+					if calls < 2 {
+						panic("worker panic")
+					}
+					return nil
+				},
+			},
+			want: struct {
+				calls int32
+				err   error
+			}{
+				calls: 2,
+			},
+		},
+		{
+			name: "restart always",
+			input: struct {
+				worker  func(calls int32) error
+				options WorkerOptions
+			}{
+				worker: func(calls int32) error {
+					return nil
+				},
+				options: WorkerOptions{Restart: RestartAlways, MaxRestarts: 2},
+			},
+			want: struct {
+				calls int32
+				err   error
+			}{
+				calls: 3,
+				err:   ErrWorkerRestarts,
+			},
+		},
+		{
+			name: "restart never",
+			input: struct {
+				worker  func(calls int32) error
+				options WorkerOptions
+			}{
+				worker: func(calls int32) error {
+					return errWorker
+				},
+				options: WorkerOptions{Restart: RestartNever},
+			},
+			want: struct {
+				calls int32
+				err   error
+			}{
+				calls: 1,
+				err:   errWorker,
+			},
+		},
+		{
+			name: "maximum restarts exceeded",
+			input: struct {
+				worker  func(calls int32) error
+				options WorkerOptions
+			}{
+				worker: func(calls int32) error {
+					panic("worker panic")
+				},
+				options: WorkerOptions{MaxRestarts: 3},
+			},
+			want: struct {
+				calls int32
+				err   error
+			}{
+				calls: 4,
+				err:   ErrWorkerRestarts,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := []string{}
+			log := &mockLogger{logs: &logs}
+			s := newSupervisor()
+
+			var calls atomic.Int32
+			done := make(chan struct{})
+			options := test.input.options
+			options.MinBackoff, options.MaxBackoff = time.Millisecond, 2*time.Millisecond
+			s.add("worker", func(ctx context.Context) error {
+				err := test.input.worker(calls.Add(1))
+				if err == nil && test.input.options.Restart != RestartAlways {
+					close(done)
+				}
+				return err
+			}, options)
+			s.start(log)
+
+			var gotErr error
+			select {
+			case gotErr = <-s.err():
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("timeout waiting for worker")
+			}
+			s.stop(log)
+
+			if diff := cmp.Diff(test.want.calls, calls.Load()); diff != "" {
+				t.Errorf("supervise() = unexpected calls (-want +got):\n%s\n", diff)
+			}
+			if !errors.Is(gotErr, test.want.err) {
+				t.Errorf("supervise() = unexpected error: %v; want %v", gotErr, test.want.err)
+			}
+		})
+	}
+}
+
+func TestSupervisor_Stop(t *testing.T) {
+	logs := []string{}
+	log := &mockLogger{logs: &logs}
+	s := newSupervisor()
+	s.add("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.start(log)
+	time.Sleep(10 * time.Millisecond)
+
+	if err := s.stop(log); err != nil {
+		t.Errorf("stop() = unexpected error: %v", err)
+	}
+
+	want := []string{
+		"Worker started.", "worker", "worker",
+		"Worker stopped.", "worker", "worker",
+	}
+	if diff := cmp.Diff(want, logs); diff != "" {
+		t.Errorf("stop() = unexpected logs (-want +got):\n%s\n", diff)
+	}
+
+	s.start(log)
+	if diff := cmp.Diff(want, logs); diff != "" {
+		t.Errorf("start() = unexpected logs after stop (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestSupervisor_Status(t *testing.T) {
+	s := newSupervisor()
+	s.add("consumer", func(ctx context.Context) error { return nil })
+	s.add("producer", func(ctx context.Context) error { return nil })
+
+	if name, state, ok := s.status(); ok {
+		t.Errorf("status() = %s %s; want no status", name, state)
+	}
+
+	s.workers[1].setState(workerRestarting)
+	name, state, ok := s.status()
+	if !ok {
+		t.Fatalf("status() = no status; want status")
+	}
+	if diff := cmp.Diff("worker producer restarting", "worker "+name+" "+string(state)); diff != "" {
+		t.Errorf("status() = unexpected result (-want +got):\n%s\n", diff)
+	}
+	if diff := cmp.Diff("worker producer restarting", service{supervisor: s}.status()); diff != "" {
+		t.Errorf("status() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestWorker_Restarted(t *testing.T) {
+	w := &worker{restartWindow: time.Minute}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	got := []int{
+		w.restarted(now),
+		w.restarted(now.Add(30 * time.Second)),
+		w.restarted(now.Add(45 * time.Second)),
+		w.restarted(now.Add(100 * time.Second)),
+	}
+
+	if diff := cmp.Diff([]int{1, 2, 3, 2}, got); diff != "" {
+		t.Errorf("restarted() = unexpected result (-want +got):\n%s\n", diff)
+	}
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input int
+		want  time.Duration
+	}{
+		{
+			name:  "first restart",
+			input: 1,
+			want:  time.Second,
+		},
+		{
+			name:  "third restart",
+			input: 3,
+			want:  4 * time.Second,
+		},
+		{
+			name:  "maximum backoff",
+			input: 10,
+			want:  10 * time.Second,
+		},
+	}
+
+	w := &worker{minBackoff: time.Second, maxBackoff: 10 * time.Second}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := w.backoff(test.input)
+				if got < test.want/2 || got > test.want {
+					t.Fatalf("backoff(%d) = %s; want between %s and %s", test.input, got, test.want/2, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// defaultVersion is the version used when no version is set with
+// -ldflags or by the module.
+const defaultVersion = "dev"
+
+// Set at build time with -ldflags, for example:
+//
+//	-ldflags="-X <module>/version.version=1.0.0 -X <module>/version.buildTime=2024-01-01T00:00:00Z"
+//
+// The revision is read from the build information if it is not set.
+var (
+	version   string
+	revision  string
+	buildTime string
+)
+
+// Info holds the version and build information of the binary.
+type Info struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// String returns the Info formatted as a single line.
+func (i Info) String() string {
+	var b strings.Builder
+	b.WriteString(i.Version)
+	if len(i.Revision) > 0 {
+		b.WriteString(" (revision " + i.Revision)
+		if i.Modified {
+			b.WriteString(", modified")
+		}
+		b.WriteString(")")
+	}
+	if len(i.BuildTime) > 0 {
+		b.WriteString(" built " + i.BuildTime)
+	}
+	b.WriteString(" with " + i.GoVersion)
+	return b.String()
+}
+
+// info is read once since the build information does not change.
+var info = sync.OnceValue(func() Info {
+	return newInfo(version, revision, buildTime, readBuildInfo)
+})
+
+// Get returns the version and build information of the binary.
+func Get() Info {
+	return info()
+}
+
+// readBuildInfo wraps around debug.ReadBuildInfo.
+func readBuildInfo() (*debug.BuildInfo, bool) {
+	return debug.ReadBuildInfo()
+}
+
+// newInfo returns a new Info from the values set with -ldflags and the
+// build information. Values set with -ldflags take precedence.
+func newInfo(version, revision, buildTime string, readBuildInfo func() (*debug.BuildInfo, bool)) Info {
+	i := Info{
+		Version:   version,
+		Revision:  revision,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := readBuildInfo(); ok {
+		if len(i.Version) == 0 && len(bi.Main.Version) > 0 && bi.Main.Version != "(devel)" {
+			i.Version = bi.Main.Version
+		}
+		if len(bi.GoVersion) > 0 {
+			i.GoVersion = bi.GoVersion
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if len(i.Revision) == 0 {
+					i.Revision = s.Value
+				}
+			case "vcs.modified":
+				i.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if len(i.Version) == 0 {
+		i.Version = defaultVersion
+	}
+	return i
+}